@@ -0,0 +1,42 @@
+package cobrashell
+
+import "strings"
+
+// expandAliasLine expands an alias in the first word of line. The first word
+// is replaced verbatim by its expansion, so the rest of the line — including
+// any pipes — is left untouched. A quoted first word never matches an alias,
+// mirroring POSIX shells. Expansion is not recursive.
+func expandAliasLine(aliases map[string]string, line string) string {
+	if len(aliases) == 0 {
+		return line
+	}
+	name, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+	expansion, ok := aliases[name]
+	if !ok {
+		return line
+	}
+	return expansion + rest
+}
+
+// expandAlias expands an alias in tokens[0], returning a new slice with the
+// alias replaced by its expansion split with tokenize, so that completion
+// sees the same words execution of the expandAliasLine result would. tokens
+// is returned unchanged when it is empty, no alias matches, or the
+// expansion cannot be parsed.
+func expandAlias(aliases map[string]string, tokens []string, tokenize func(string) ([]string, error)) []string {
+	if len(tokens) == 0 {
+		return tokens
+	}
+	expansion, ok := aliases[tokens[0]]
+	if !ok {
+		return tokens
+	}
+	expanded, err := tokenize(expansion)
+	if err != nil {
+		return tokens
+	}
+	return append(expanded, tokens[1:]...)
+}
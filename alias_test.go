@@ -0,0 +1,123 @@
+package cobrashell
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/shlex"
+)
+
+func TestExpandAliasLine(t *testing.T) {
+	aliases := map[string]string{"gp": "get pods", "g": "greet --name bob"}
+	cases := []struct {
+		line, want string
+	}{
+		{"gp", "get pods"},
+		{"gp -n kube-system", "get pods -n kube-system"},
+		{"gp\t-A", "get pods\t-A"},
+		{"gp | grep web", "get pods | grep web"},
+		{"gpx", "gpx"},
+		{"'gp'", "'gp'"},
+		{"echo gp", "echo gp"},
+	}
+	for _, tc := range cases {
+		if got := expandAliasLine(aliases, tc.line); got != tc.want {
+			t.Errorf("expandAliasLine(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestExpandAliasLine_NoAliases(t *testing.T) {
+	if got := expandAliasLine(nil, "gp"); got != "gp" {
+		t.Errorf("expandAliasLine(nil, gp) = %q, want gp", got)
+	}
+}
+
+func TestExpandAlias_Tokens(t *testing.T) {
+	aliases := map[string]string{"gp": `get pods --selector "app=web"`}
+	got := expandAlias(aliases, []string{"gp", "-n", "x"}, shlex.Split)
+	want := []string{"get", "pods", "--selector", "app=web", "-n", "x"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expandAlias = %q, want %q", got, want)
+	}
+	if got := expandAlias(aliases, []string{"get"}, shlex.Split); !slices.Equal(got, []string{"get"}) {
+		t.Errorf("expandAlias non-alias = %q, want [get]", got)
+	}
+	if got := expandAlias(aliases, nil, shlex.Split); len(got) != 0 {
+		t.Errorf("expandAlias(nil) = %q, want empty", got)
+	}
+}
+
+func TestEmbeddedCompleter_Do_AliasExpandsContext(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd: newTestRoot(),
+		Aliases: map[string]string{"s": "serve"},
+	})
+	c := &embeddedCompleter{shell: sh}
+
+	line := []rune("s --po")
+	candidates, length := c.Do(line, len(line))
+	if length != 4 {
+		t.Errorf("length = %d, want 4 (len of '--po')", length)
+	}
+	if len(candidates) != 1 || string(candidates[0]) != "rt" {
+		t.Errorf("Do(%q) = %q, want [rt]", string(line), candidates)
+	}
+}
+
+func TestEmbeddedCompleter_Do_AliasBeingTypedNotExpanded(t *testing.T) {
+	// While the alias itself is the partial word, completion runs against
+	// the literal text, not the expansion.
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd: newTestRoot(),
+		Aliases: map[string]string{"ver": "serve"},
+	})
+	c := &embeddedCompleter{shell: sh}
+
+	line := []rune("ver")
+	candidates, _ := c.Do(line, len(line))
+	if len(candidates) != 1 || string(candidates[0]) != "sion" {
+		t.Errorf("Do(%q) = %q, want [sion]", string(line), candidates)
+	}
+}
+
+func TestIntegration_CompleterDo_AliasExpandsContext(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Aliases = map[string]string{"hi": "greet"}
+	c := &completer{shell: sh}
+
+	line := []rune("hi --na")
+	candidates, length := c.Do(line, len(line))
+	if length != 4 {
+		t.Errorf("length = %d, want 4 (len of '--na')", length)
+	}
+	found := false
+	for _, cand := range candidates {
+		if string(cand) == "me" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("suffix 'me' not found in candidates %q", candidates)
+	}
+}
+
+func TestIntegration_Execute_AliasExpanded(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	var gotTokens []string
+	sh := newIntegrationShell()
+	sh.cfg.Aliases = map[string]string{"hi": "greet --name"}
+	sh.cfg.Hooks.BeforeExec = func(tokens []string) error {
+		gotTokens = tokens
+		return nil
+	}
+	sh.execute("hi bob")
+	if want := []string{"greet", "--name", "bob"}; !slices.Equal(gotTokens, want) {
+		t.Errorf("BeforeExec tokens = %q, want %q", gotTokens, want)
+	}
+}
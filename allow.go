@@ -0,0 +1,44 @@
+package cobrashell
+
+import (
+	"io"
+	"slices"
+)
+
+// commandAllowed reports whether a command whose first word is name may run
+// under allowed (Config.AllowedCommands). An empty list allows everything.
+func commandAllowed(allowed []string, name string) bool {
+	return len(allowed) == 0 || slices.Contains(allowed, name)
+}
+
+// filterAllowed restricts the completions of a command line to allowed. For
+// the first word (no contextArgs) only the allowed command names are kept;
+// after a command that is not allowed nothing is offered.
+func filterAllowed(allowed, contextArgs, candidates []string) []string {
+	if len(allowed) == 0 {
+		return candidates
+	}
+	if len(contextArgs) > 0 {
+		if !commandAllowed(allowed, contextArgs[0]) {
+			return nil
+		}
+		return candidates
+	}
+	var kept []string
+	for _, cand := range candidates {
+		if commandAllowed(allowed, cand) {
+			kept = append(kept, cand)
+		}
+	}
+	return kept
+}
+
+// notPermitted reports that tokens, a command line of a shell restricted by
+// allowed, does not start with a permitted command, and if so says so on w.
+func notPermitted(w io.Writer, allowed, tokens []string) bool {
+	if commandAllowed(allowed, tokens[0]) {
+		return false
+	}
+	writeErrTo(w, "cobra-shell: command %q not permitted\n", tokens[0])
+	return true
+}
@@ -0,0 +1,76 @@
+package cobrashell
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestFilterAllowed(t *testing.T) {
+	allowed := []string{"get", "describe"}
+	got := filterAllowed(allowed, nil, []string{"delete", "describe", "get", "--help"})
+	assertSameElements(t, got, []string{"describe", "get"})
+
+	if got := filterAllowed(allowed, []string{"get"}, []string{"pods", "nodes"}); len(got) != 2 {
+		t.Errorf("after an allowed command: got %v, want both candidates", got)
+	}
+	if got := filterAllowed(allowed, []string{"delete"}, []string{"pods"}); len(got) != 0 {
+		t.Errorf("after a disallowed command: got %v, want none", got)
+	}
+	if got := filterAllowed(nil, nil, []string{"delete"}); len(got) != 1 {
+		t.Errorf("without an allowlist: got %v, want the candidates unchanged", got)
+	}
+}
+
+func TestIntegration_AllowedCommands(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.AllowedCommands = []string{"greet"}
+	sh.cfg.Aliases = map[string]string{"boom": "fail"}
+
+	stderr := captureStderr(t, func() { sh.executeOne("boom") })
+	if !strings.Contains(stderr, `command "fail" not permitted`) {
+		t.Errorf("stderr = %q, want a not-permitted error for the expanded alias", stderr)
+	}
+	if sh.lastExitCode != 1 {
+		t.Errorf("lastExitCode = %d, want 1", sh.lastExitCode)
+	}
+	if out := captureStdout(t, func() { sh.executeOne("greet") }); !strings.Contains(out, "Hello, world!") {
+		t.Errorf("allowed command output = %q, want the greeting", out)
+	}
+
+	c := &completer{shell: sh}
+	line := []rune("")
+	got, _ := c.Do(line, 0)
+	if len(got) != 1 || string(got[0]) != "greet" {
+		t.Errorf("Do(%q) = %q, want only [greet]", string(line), got)
+	}
+	line = []rune("fail ")
+	if got, _ := c.Do(line, len(line)); len(got) != 0 {
+		t.Errorf("Do(%q) = %q, want nothing after a disallowed command", string(line), got)
+	}
+}
+
+func TestEmbedded_AllowedCommands(t *testing.T) {
+	ran := false
+	root := newTestRoot()
+	root.AddCommand(&cobra.Command{Use: "wipe", Run: func(*cobra.Command, []string) { ran = true }})
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root, AllowedCommands: []string{"serve", "version"}})
+
+	stderr := captureStderr(t, func() { sh.execute("wipe") })
+	if ran || !strings.Contains(stderr, "not permitted") {
+		t.Errorf("disallowed command ran=%v, stderr %q; want it blocked", ran, stderr)
+	}
+
+	c := &embeddedCompleter{shell: sh}
+	line := []rune("")
+	got, _ := c.Do(line, 0)
+	var names []string
+	for _, r := range got {
+		names = append(names, string(r))
+	}
+	assertSameElements(t, names, []string{"serve", "version"})
+}
@@ -0,0 +1,72 @@
+package cobrashell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// printBanner prints Config.Banner, when set, to stdout (see renderBanner).
+// The {version} placeholder runs "binary --version" once, bounded by
+// CompletionTimeout, and only when the banner uses it.
+func (s *Shell) printBanner() {
+	if s.cfg.Banner == "" {
+		return
+	}
+	version := ""
+	if strings.Contains(s.cfg.Banner, "{version}") {
+		version = s.binaryVersion()
+	}
+	banner := renderBanner(s.cfg.Banner, binaryName(s.binary), version, isTerminal(s.stdout()))
+	if !strings.HasSuffix(banner, "\n") {
+		banner += "\n"
+	}
+	fmt.Fprint(s.stdout(), banner)
+}
+
+// renderBanner expands {binary} and {version} in tmpl, and the color tokens
+// of PromptTemplate ({red}, {bold}, {reset}, ...), which become escape codes
+// when color is set and are removed otherwise.
+func renderBanner(tmpl, binary, version string, color bool) string {
+	pairs := []string{"{binary}", binary, "{version}", version}
+	for token, code := range promptColors {
+		if !color {
+			code = ""
+		}
+		pairs = append(pairs, token, code)
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+// binaryVersion returns the version reported by "binary --version": the
+// last word of the first line of its output (see binaryVersionLine), so that
+// cobra's "app version 1.2.3" yields "1.2.3".
+func (s *Shell) binaryVersion() string {
+	fields := strings.Fields(s.binaryVersionLine())
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// binaryVersionLine returns the first line printed by "binary --version",
+// bounded by CompletionTimeout, or "" when the binary prints nothing or
+// fails.
+func (s *Shell) binaryVersionLine() string {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.CompletionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.binary, "--version")
+	cmd.Dir = s.cfg.WorkingDir
+	cmd.Env = s.buildEnv()
+	cmd.Stderr = io.Discard
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	first, _, _ := strings.Cut(out.String(), "\n")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,62 @@
+package cobrashell
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderBanner(t *testing.T) {
+	tmpl := "{bold}{binary}{reset} {version}"
+	if got := renderBanner(tmpl, "app", "1.0", true); got != ColorBold+"app"+ColorReset+" 1.0" {
+		t.Errorf("renderBanner with color = %q", got)
+	}
+	if got := renderBanner(tmpl, "app", "1.0", false); got != "app 1.0" {
+		t.Errorf("renderBanner without color = %q, want %q", got, "app 1.0")
+	}
+}
+
+func TestRun_Banner(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	s := New(Config{
+		BinaryPath:  testBinary,
+		Banner:      "Welcome to {binary} {version}",
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+	})
+	s.cfg.Hooks.OnStart = func(*Shell) { fmt.Println("on start") }
+
+	out := captureStdout(t, func() {
+		if err := s.runInteractive(io.NopCloser(strings.NewReader("exit\n"))); err != nil {
+			t.Errorf("runInteractive: %v", err)
+		}
+	})
+	banner := strings.Index(out, "Welcome to testbin 1.2.3\n")
+	if banner < 0 {
+		t.Fatalf("output = %q, want the expanded banner", out)
+	}
+	if onStart := strings.Index(out, "on start"); onStart < banner {
+		t.Errorf("output = %q, want the banner before OnStart's output", out)
+	}
+}
+
+func TestRunDemo_Banner(t *testing.T) {
+	sh := &Shell{
+		cfg:    Config{Prompt: "> ", Banner: "Welcome to {binary}", DemoScript: []DemoStep{{Command: "exit"}}},
+		binary: "/usr/bin/true",
+	}
+	out := captureStdout(t, func() { _ = sh.runDemo() })
+	if !strings.HasPrefix(out, "Welcome to true\n") {
+		t.Errorf("output = %q, want it to start with the banner", out)
+	}
+}
+
+func TestRunLines_NoBanner(t *testing.T) {
+	sh := &Shell{cfg: Config{Banner: "Welcome to {binary}"}, binary: "/usr/bin/true"}
+	if out := captureStdout(t, func() { _ = sh.runLines(strings.NewReader("")) }); out != "" {
+		t.Errorf("output = %q, want no banner when reading from a pipe", out)
+	}
+}
@@ -0,0 +1,175 @@
+package cobrashell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+)
+
+// builtin describes an enabled shell built-in for help output.
+type builtin struct {
+	name  string
+	short string
+}
+
+// builtins returns the shell built-ins enabled by the current Config, in the
+// order they are listed in help output.
+func (s *Shell) builtins() []builtin {
+	var list []builtin
+	if s.cfg.EnvBuiltin != "" {
+		list = append(list, builtin{s.cfg.EnvBuiltin, "Manage session-scoped environment variables"})
+	}
+	if s.cfg.UseBuiltin != "" {
+		list = append(list, builtin{s.cfg.UseBuiltin, "Switch the wrapped binary"})
+	}
+	if s.cfg.JobsBuiltin != "" {
+		list = append(list, builtin{s.cfg.JobsBuiltin, "List background jobs started with a trailing &"})
+	}
+	if s.cfg.ContextBuiltin != "" {
+		list = append(list,
+			builtin{s.cfg.ContextBuiltin, "Enter a command context; later commands run inside it"},
+			builtin{contextUpBuiltinName, "Leave the innermost command context"})
+	}
+	if s.cfg.ExplainBuiltin {
+		list = append(list, builtin{explainBuiltinName, "Show how a line would be run, without running it"})
+	}
+	if s.cfg.VersionBuiltin != "" {
+		list = append(list, builtin{s.cfg.VersionBuiltin, "Show the cobra-shell and binary versions"})
+	}
+	if s.cfg.CompletionSourceBuiltin {
+		list = append(list, builtin{completionSourceBuiltinName, "Show or force where Tab completions come from"})
+	}
+	if s.cfg.HelpBuiltin != "" {
+		list = append(list, builtin{s.cfg.HelpBuiltin, "Show this summary of shell features"})
+	}
+	return list
+}
+
+// printBuiltinsHelp appends the "Shell built-ins" section to the binary's
+// root help output. It prints nothing when no built-in is enabled.
+func (s *Shell) printBuiltinsHelp() {
+	list := s.builtins()
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintf(s.stdout(), "\nShell built-ins:\n")
+	for _, b := range list {
+		fmt.Fprintf(s.stdout(), "  %-12s %s\n", b.name, b.short)
+	}
+}
+
+// handleHelpBuiltin checks whether tokens[0] matches Config.HelpBuiltin. If
+// so, it prints a summary of the shell's meta features and returns true.
+func (s *Shell) handleHelpBuiltin(tokens []string) bool {
+	if s.cfg.HelpBuiltin == "" || tokens[0] != s.cfg.HelpBuiltin {
+		return false
+	}
+	s.printShellHelp()
+	return true
+}
+
+// printShellHelp prints the features enabled by the current Config. Sections
+// for disabled features are omitted.
+func (s *Shell) printShellHelp() {
+	fmt.Fprintf(s.stdout(), "cobra-shell: interactive shell for %s\n\n", s.binary)
+	fmt.Fprintf(s.stdout(), "Type a %s command without the binary name, e.g. \"--help\".\n", binaryName(s.binary))
+	fmt.Fprintf(s.stdout(), "Exit with \"exit\" or Ctrl-D.\n")
+
+	fmt.Fprintf(s.stdout(), "\nShell built-ins:\n")
+	for _, b := range s.builtins() {
+		fmt.Fprintf(s.stdout(), "  %-12s %s\n", b.name, b.short)
+	}
+
+	if len(s.cfg.Aliases) > 0 {
+		names := make([]string, 0, len(s.cfg.Aliases))
+		for name := range s.cfg.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(s.stdout(), "\nAliases:\n")
+		for _, name := range names {
+			fmt.Fprintf(s.stdout(), "  %-12s %s\n", name, s.cfg.Aliases[name])
+		}
+	}
+
+	fmt.Fprintf(s.stdout(), "\nPipes:\n")
+	fmt.Fprintf(s.stdout(), "  Output can be piped to system commands, e.g. \"get pods | grep web\".\n")
+}
+
+// handleUseBuiltin checks whether tokens[0] matches Config.UseBuiltin. If so,
+// it switches the wrapped binary to the one named by tokens[1] and returns
+// true. If UseBuiltin is empty or the first token does not match, it returns
+// false and the caller should proceed with normal execution.
+//
+// An unresolvable binary prints an error and leaves the current binary active.
+func (s *Shell) handleUseBuiltin(tokens []string) bool {
+	name := s.cfg.UseBuiltin
+	if name == "" || tokens[0] != name {
+		return false
+	}
+
+	if len(tokens) == 1 {
+		fmt.Fprintln(s.stdout(), s.binary)
+		return true
+	}
+	if tokens[1] == "--help" || tokens[1] == "-h" {
+		fmt.Fprintf(s.stdout(), "Switch the wrapped binary.\n"+
+			"Without arguments, print the active binary.\n\n"+
+			"Usage:\n  %s [BINARY]\n", name)
+		return true
+	}
+	if len(tokens) != 2 {
+		s.writeErr("Error: accepts at most 1 arg, received %d\n\nUsage:\n  %s [BINARY]\n",
+			len(tokens)-1, name)
+		return true
+	}
+
+	binary, err := resolveBinary(tokens[1])
+	if err == nil {
+		err = checkExecutable(binary)
+	}
+	if err != nil {
+		s.writeErr("cobra-shell: resolve binary %q: %v\n", tokens[1], err)
+		return true
+	}
+	s.switchBinary(binary)
+	s.binaryArg = tokens[1]
+	return true
+}
+
+// checkExecutable reports an error unless path is a regular file that can
+// be executed. On Windows, where files carry no execute bit, any regular
+// file is accepted.
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("not a regular file")
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o111 == 0 {
+		return errors.New("not executable")
+	}
+	return nil
+}
+
+// switchBinary makes binary the wrapped binary. Defaulted Prompt and
+// HistoryFile values follow the new binary; configured values are kept.
+func (s *Shell) switchBinary(binary string) {
+	s.binary = binary
+	if s.compCache != nil {
+		s.compCache = loadCompletionCache(s.cfg.PersistentCompletionCache, binary, s.cfg.WorkingDir)
+	}
+	if s.promptDefaulted {
+		s.cfg.Prompt = binaryName(binary) + defaultPrompt
+	}
+	if s.historyDefaulted {
+		s.cfg.HistoryFile = defaultHistoryFilePath(binary)
+		if s.rl != nil {
+			s.rl.SetHistoryPath(s.cfg.HistoryFile)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package cobrashell
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// captureStdout runs fn with os.Stdout redirected to a pipe and returns
+// everything written to it.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stdout, fn)
+}
+
+// captureStderr runs fn with os.Stderr redirected to a pipe and returns
+// everything written to it.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stderr, fn)
+}
+
+func captureFile(t *testing.T, target **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	orig := *target
+	*target = w
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	defer func() {
+		*target = orig
+	}()
+	fn()
+	_ = w.Close()
+	return <-done
+}
+
+// --- handleUseBuiltin ---
+
+func makeUseShell() *Shell {
+	return &Shell{
+		cfg:              Config{UseBuiltin: "use", Prompt: defaultPrompt},
+		binary:           "/usr/bin/env",
+		sessionEnv:       make(map[string]string),
+		promptDefaulted:  true,
+		historyDefaulted: true,
+	}
+}
+
+func TestHandleUseBuiltin_Disabled(t *testing.T) {
+	s := makeUseShell()
+	s.cfg.UseBuiltin = ""
+	if s.handleUseBuiltin([]string{"use", "/usr/bin/true"}) {
+		t.Error("handleUseBuiltin with empty UseBuiltin should return false")
+	}
+}
+
+func TestHandleUseBuiltin_SwitchesBinary(t *testing.T) {
+	s := makeUseShell()
+	if !s.handleUseBuiltin([]string{"use", "/usr/bin/true"}) {
+		t.Fatal("handleUseBuiltin should return true")
+	}
+	if s.binary != "/usr/bin/true" {
+		t.Errorf("binary = %q, want /usr/bin/true", s.binary)
+	}
+	if s.cfg.Prompt != "true> " {
+		t.Errorf("Prompt = %q, want %q", s.cfg.Prompt, "true> ")
+	}
+	if !strings.HasSuffix(s.cfg.HistoryFile, ".true_history") {
+		t.Errorf("HistoryFile = %q, want suffix .true_history", s.cfg.HistoryFile)
+	}
+}
+
+func TestHandleUseBuiltin_KeepsConfiguredPrompt(t *testing.T) {
+	s := makeUseShell()
+	s.cfg.Prompt = "ops> "
+	s.promptDefaulted = false
+	s.handleUseBuiltin([]string{"use", "/usr/bin/true"})
+	if s.cfg.Prompt != "ops> " {
+		t.Errorf("Prompt = %q, want configured %q", s.cfg.Prompt, "ops> ")
+	}
+}
+
+func TestHandleUseBuiltin_InvalidBinary(t *testing.T) {
+	s := makeUseShell()
+	var handled bool
+	stderr := captureStderr(t, func() {
+		handled = s.handleUseBuiltin([]string{"use", "cobra-shell-no-such-binary"})
+	})
+	if !handled {
+		t.Error("handleUseBuiltin should return true for an invalid binary")
+	}
+	if s.binary != "/usr/bin/env" {
+		t.Errorf("binary = %q, want unchanged /usr/bin/env", s.binary)
+	}
+	if !strings.Contains(stderr, "cobra-shell-no-such-binary") {
+		t.Errorf("stderr = %q, want error naming the binary", stderr)
+	}
+}
+
+func TestHandleUseBuiltin_InvalidPath(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"./cobra-shell-no-such-binary", dir}
+	if runtime.GOOS != "windows" {
+		paths = append(paths, plain)
+	}
+	for _, path := range paths {
+		s := makeUseShell()
+		stderr := captureStderr(t, func() { s.handleUseBuiltin([]string{"use", path}) })
+		if s.binary != "/usr/bin/env" {
+			t.Errorf("use %s: binary = %q, want unchanged /usr/bin/env", path, s.binary)
+		}
+		if !strings.Contains(stderr, path) {
+			t.Errorf("use %s: stderr = %q, want error naming the path", path, stderr)
+		}
+	}
+}
+
+func TestPrintBuiltinsHelp_ListsEnabled(t *testing.T) {
+	s := makeUseShell()
+	s.cfg.EnvBuiltin = "env"
+	out := captureStdout(t, s.printBuiltinsHelp)
+	if !strings.Contains(out, "env") || !strings.Contains(out, "use") {
+		t.Errorf("printBuiltinsHelp output = %q, want env and use listed", out)
+	}
+}
+
+func TestPrintBuiltinsHelp_NoneEnabled(t *testing.T) {
+	s := makeUseShell()
+	s.cfg.UseBuiltin = ""
+	if out := captureStdout(t, s.printBuiltinsHelp); out != "" {
+		t.Errorf("printBuiltinsHelp output = %q, want empty", out)
+	}
+}
+
+// --- help built-in ---
+
+func TestHandleHelpBuiltin_Disabled(t *testing.T) {
+	s := &Shell{binary: "/usr/bin/myapp"}
+	if s.handleHelpBuiltin([]string{":help"}) {
+		t.Error("handleHelpBuiltin should return false when HelpBuiltin is empty")
+	}
+}
+
+func TestHandleHelpBuiltin_MentionsEnvOnlyWhenEnabled(t *testing.T) {
+	s := &Shell{cfg: Config{HelpBuiltin: ":help"}, binary: "/usr/bin/myapp"}
+	out := captureStdout(t, func() {
+		if !s.handleHelpBuiltin([]string{":help"}) {
+			t.Error("handleHelpBuiltin should handle its own name")
+		}
+	})
+	if strings.Contains(out, "environment") {
+		t.Errorf("help output mentions the env built-in although it is disabled:\n%s", out)
+	}
+	if !strings.Contains(out, "exit") || !strings.Contains(out, "Pipes") {
+		t.Errorf("help output missing exit or pipe info:\n%s", out)
+	}
+
+	s.cfg.EnvBuiltin = "setenv"
+	out = captureStdout(t, func() { s.handleHelpBuiltin([]string{":help"}) })
+	if !strings.Contains(out, "setenv") {
+		t.Errorf("help output does not mention the env built-in name:\n%s", out)
+	}
+}
+
+func TestHandleHelpBuiltin_ListsAliases(t *testing.T) {
+	s := &Shell{
+		cfg:    Config{HelpBuiltin: ":help", Aliases: map[string]string{"gp": "get pods"}},
+		binary: "/usr/bin/myapp",
+	}
+	out := captureStdout(t, func() { s.handleHelpBuiltin([]string{":help"}) })
+	if !strings.Contains(out, "Aliases:") || !strings.Contains(out, "get pods") {
+		t.Errorf("help output missing aliases:\n%s", out)
+	}
+}
@@ -0,0 +1,84 @@
+package cobrashell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+)
+
+// bundleVersion is the format version written by ExportBundle.
+const bundleVersion = 1
+
+// maxBundleHistory bounds the history entries carried in a bundle.
+const maxBundleHistory = 1000
+
+// bundle is the JSON form of a session exported by ExportBundle.
+type bundle struct {
+	Version int               `json:"version"`
+	Env     map[string]string `json:"env,omitempty"`
+	Aliases map[string]string `json:"aliases,omitempty"`
+	History []string          `json:"history,omitempty"`
+}
+
+// ExportBundle writes the session state to w as a single JSON document: the
+// session env (see [Shell.SetEnv]), the configured aliases, and the most
+// recent 1000 entries of the history file, oldest first. The bundle can be
+// restored on another machine with [Shell.ImportBundle].
+func (s *Shell) ExportBundle(w io.Writer) error {
+	b := bundle{
+		Version: bundleVersion,
+		Env:     s.sessionEnvMap(),
+		Aliases: s.cfg.Aliases,
+	}
+	if s.cfg.HistoryFile != "" {
+		b.History = readHistoryFile(s.cfg.HistoryFile)
+		if n := len(b.History); n > maxBundleHistory {
+			b.History = b.History[n-maxBundleHistory:]
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b); err != nil {
+		return fmt.Errorf("cobra-shell: export bundle: %w", err)
+	}
+	return nil
+}
+
+// ImportBundle restores session state written by [Shell.ExportBundle]. Env
+// variables and aliases from the bundle are added to the current ones,
+// replacing those with the same name. History entries are merged into the
+// history file ahead of its own entries, with duplicates removed; a shell
+// that is already running picks them up the next time Run starts.
+//
+// Nothing is changed when the bundle cannot be read or has an unsupported
+// version.
+func (s *Shell) ImportBundle(r io.Reader) error {
+	var b bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return fmt.Errorf("cobra-shell: import bundle: %w", err)
+	}
+	if b.Version != bundleVersion {
+		return fmt.Errorf("cobra-shell: import bundle: unsupported version %d", b.Version)
+	}
+
+	if len(b.History) > 0 && s.cfg.HistoryFile != "" {
+		entries := append(b.History, readHistoryFile(s.cfg.HistoryFile)...)
+		if err := writeHistoryFile(s.cfg.HistoryFile, mergeHistory(entries)); err != nil {
+			return fmt.Errorf("cobra-shell: import bundle: write history: %w", err)
+		}
+	}
+	for k, v := range b.Env {
+		s.SetEnv(k, v)
+	}
+	if len(b.Aliases) > 0 {
+		// Copy rather than write into the caller's Config.Aliases map.
+		aliases := maps.Clone(s.cfg.Aliases)
+		if aliases == nil {
+			aliases = make(map[string]string, len(b.Aliases))
+		}
+		maps.Copy(aliases, b.Aliases)
+		s.cfg.Aliases = aliases
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package cobrashell
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBundle_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := New(Config{
+		BinaryPath:  "/usr/bin/true",
+		HistoryFile: filepath.Join(dir, "src_history"),
+		Aliases:     map[string]string{"gp": "get pods"},
+	})
+	src.SetEnv("KUBECONFIG", "/tmp/kube")
+	if err := os.WriteFile(src.cfg.HistoryFile, []byte("get pods\nget nodes\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := src.ExportBundle(&buf); err != nil {
+		t.Fatalf("ExportBundle: %v", err)
+	}
+
+	dstAliases := map[string]string{"gp": "get pods -A", "gs": "get svc"}
+	dst := New(Config{
+		BinaryPath:  "/usr/bin/true",
+		HistoryFile: filepath.Join(dir, "dst_history"),
+		Aliases:     dstAliases,
+	})
+	dst.SetEnv("EXISTING", "1")
+	if err := os.WriteFile(dst.cfg.HistoryFile, []byte("get nodes\nversion\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.ImportBundle(&buf); err != nil {
+		t.Fatalf("ImportBundle: %v", err)
+	}
+
+	if got, want := dst.SessionEnv(), []string{"EXISTING=1", "KUBECONFIG=/tmp/kube"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SessionEnv = %q, want %q", got, want)
+	}
+	if want := map[string]string{"gp": "get pods", "gs": "get svc"}; !reflect.DeepEqual(dst.cfg.Aliases, want) {
+		t.Errorf("Aliases = %v, want %v", dst.cfg.Aliases, want)
+	}
+	if dstAliases["gp"] != "get pods -A" {
+		t.Error("ImportBundle modified the caller's Aliases map")
+	}
+	if got, want := readHistoryFile(dst.cfg.HistoryFile), []string{"get pods", "get nodes", "version"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+}
+
+func TestImportBundle_RejectsUnknownVersion(t *testing.T) {
+	s := New(Config{BinaryPath: "/usr/bin/true", HistoryFile: filepath.Join(t.TempDir(), "history")})
+	err := s.ImportBundle(strings.NewReader(`{"version": 99, "env": {"A": "1"}}`))
+	if err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("ImportBundle = %v, want a version error", err)
+	}
+	if len(s.SessionEnv()) != 0 {
+		t.Errorf("SessionEnv = %q after a rejected bundle, want empty", s.SessionEnv())
+	}
+}
@@ -0,0 +1,93 @@
+package cobrashell
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// completionCache is the persistent completion cache configured by
+// Config.PersistentCompletionCache. On disk it is a single JSON document
+// tagged with the binary it was built from and the directory the binary ran
+// in; a cache whose binary path, modification time, or size differ from the
+// current binary, or whose directory differs from the current one, is
+// discarded, since file-argument completions depend on the directory.
+type completionCache struct {
+	mu   sync.Mutex
+	path string
+	data cacheFile
+}
+
+// cacheFile is the on-disk form of a completionCache.
+type cacheFile struct {
+	Binary  string                 `json:"binary"`
+	ModTime int64                  `json:"modTime"` // UnixNano
+	Size    int64                  `json:"size"`
+	Dir     string                 `json:"dir"` // absolute working directory
+	Entries map[string]cachedEntry `json:"entries"`
+}
+
+// cachedEntry is one cached __completeNoDesc result.
+type cachedEntry struct {
+	Candidates []string `json:"candidates"`
+	Directive  int      `json:"directive"`
+}
+
+// loadCompletionCache reads the cache at path for binary running in dir
+// (Config.WorkingDir; "" for the shell's own directory). A missing,
+// unreadable, or stale cache yields an empty cache for binary; it is
+// replaced on the next write.
+func loadCompletionCache(path, binary, dir string) *completionCache {
+	c := &completionCache{path: path, data: cacheFile{Binary: binary}}
+	if abs, err := filepath.Abs(dir); err == nil {
+		c.data.Dir = abs
+	}
+	if info, err := os.Stat(binary); err == nil {
+		c.data.ModTime = info.ModTime().UnixNano()
+		c.data.Size = info.Size()
+	}
+
+	var onDisk cacheFile
+	if b, err := os.ReadFile(path); err == nil && json.Unmarshal(b, &onDisk) == nil &&
+		onDisk.Binary == c.data.Binary && onDisk.ModTime == c.data.ModTime && onDisk.Size == c.data.Size && onDisk.Dir == c.data.Dir {
+		c.data.Entries = onDisk.Entries
+	}
+	if c.data.Entries == nil {
+		c.data.Entries = make(map[string]cachedEntry)
+	}
+	return c
+}
+
+// cacheKey identifies a completion request. NUL cannot appear in arguments,
+// so it separates them unambiguously.
+func cacheKey(contextArgs []string, toComplete string) string {
+	return strings.Join(append(append([]string(nil), contextArgs...), toComplete), "\x00")
+}
+
+// get returns the cached result for a request.
+func (c *completionCache) get(contextArgs []string, toComplete string) (cachedEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.data.Entries[cacheKey(contextArgs, toComplete)]
+	return e, ok
+}
+
+// put stores a result and rewrites the cache file. Write errors are ignored:
+// the cache is an optimisation and must never interfere with completion.
+func (c *completionCache) put(contextArgs []string, toComplete string, candidates []string, directive int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data.Entries[cacheKey(contextArgs, toComplete)] = cachedEntry{Candidates: candidates, Directive: directive}
+
+	b, err := json.Marshal(c.data)
+	if err != nil {
+		return
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, c.path)
+}
@@ -0,0 +1,111 @@
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func countInvocations(t *testing.T, log string) int {
+	t.Helper()
+	b, err := os.ReadFile(log)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(b), "\n")
+}
+
+func TestIntegration_PersistentCompletionCache(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+	cachePath := filepath.Join(t.TempDir(), "completions.json")
+	session := func() *completer {
+		sh := New(Config{BinaryPath: script, HistoryFile: os.DevNull, PersistentCompletionCache: cachePath})
+		if sh.initErr != nil {
+			t.Fatalf("New: %v", sh.initErr)
+		}
+		return &completer{shell: sh}
+	}
+
+	got, _ := session().complete(nil, "gr")
+	assertSameElements(t, got, []string{"greet"})
+	if n := countInvocations(t, log); n != 1 {
+		t.Fatalf("binary invocations after first completion = %d, want 1", n)
+	}
+
+	// A new session loads the cache and answers without spawning.
+	got, _ = session().complete(nil, "gr")
+	assertSameElements(t, got, []string{"greet"})
+	if n := countInvocations(t, log); n != 1 {
+		t.Errorf("binary invocations after cached completion = %d, want 1", n)
+	}
+
+	// Changing the binary invalidates the cache.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(script, later, later); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = session().complete(nil, "gr")
+	assertSameElements(t, got, []string{"greet"})
+	if n := countInvocations(t, log); n != 2 {
+		t.Errorf("binary invocations after binary change = %d, want 2", n)
+	}
+}
+
+func TestIntegration_PersistentCompletionCache_WorkingDir(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+	cachePath := filepath.Join(t.TempDir(), "completions.json")
+	session := func(dir string) *completer {
+		sh := New(Config{BinaryPath: script, HistoryFile: os.DevNull, PersistentCompletionCache: cachePath, WorkingDir: dir})
+		if sh.initErr != nil {
+			t.Fatalf("New: %v", sh.initErr)
+		}
+		return &completer{shell: sh}
+	}
+
+	first, second := t.TempDir(), t.TempDir()
+	_, _ = session(first).complete(nil, "gr")
+	_, _ = session(first).complete(nil, "gr")
+	if n := countInvocations(t, log); n != 1 {
+		t.Fatalf("binary invocations in the same directory = %d, want 1", n)
+	}
+
+	// Completions cached in another directory are not reused.
+	got, _ := session(second).complete(nil, "gr")
+	assertSameElements(t, got, []string{"greet"})
+	if n := countInvocations(t, log); n != 2 {
+		t.Errorf("binary invocations after changing WorkingDir = %d, want 2", n)
+	}
+}
+
+func TestLoadCompletionCache_MissingOrCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if err := os.WriteFile(bin, []byte("x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing.json"), corrupt} {
+		c := loadCompletionCache(path, bin, "")
+		if _, ok := c.get(nil, ""); ok {
+			t.Errorf("loadCompletionCache(%s) has entries, want empty", path)
+		}
+		c.put(nil, "", []string{"a"}, 4)
+		if e, ok := loadCompletionCache(path, bin, "").get(nil, ""); !ok || e.Directive != 4 {
+			t.Errorf("entry not persisted to %s: %+v, %v", path, e, ok)
+		}
+	}
+}
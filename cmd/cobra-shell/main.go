@@ -2,7 +2,7 @@
 //
 // Usage:
 //
-//	cobra-shell --binary <path> [--prompt <string>] [--history <file>] [--timeout <duration>] [--env-builtin <name>]
+//	cobra-shell --binary <path> [--prompt <string>] [--history <file>] [--timeout <duration>] [--env-builtin <name>] [--use-builtin <name>] [--exit-code] [--command <line>]
 //
 // Examples:
 //
@@ -10,6 +10,9 @@
 //	cobra-shell --binary gh
 //	cobra-shell --binary ./myapp --timeout 2s
 //	cobra-shell --binary ./myapp --env-builtin env
+//	cobra-shell --binary kubectl --use-builtin use
+//	cobra-shell --binary ./myapp --exit-code < script.txt
+//	cobra-shell --binary ./myapp --command "greet --name bob"
 package main
 
 import (
@@ -28,6 +31,9 @@ func main() {
 		history    string
 		timeout    time.Duration
 		envBuiltin string
+		useBuiltin string
+		exitCode   bool
+		command    string
 	)
 
 	root := &cobra.Command{
@@ -43,11 +49,12 @@ completion (via __completeNoDesc) and persistent command history.`,
 			if prompt != "" {
 				top += " " + prompt
 			}
-			return cobrashell.New(cobrashell.Config{
+			sh := cobrashell.New(cobrashell.Config{
 				BinaryPath:        binary,
 				HistoryFile:       history,
 				CompletionTimeout: timeout,
 				EnvBuiltin:        envBuiltin,
+				UseBuiltin:        useBuiltin,
 				PrePrompt:         top + "\n",
 				DynamicPrompt: func(exitCode int) string {
 					color := cobrashell.ColorGreen
@@ -56,7 +63,21 @@ completion (via __completeNoDesc) and persistent command history.`,
 					}
 					return "╰─" + cobrashell.Colorize("❯", color) + " "
 				},
-			}).Run()
+			})
+			if command != "" {
+				code, err := sh.Exec(command)
+				if err != nil {
+					return err
+				}
+				os.Exit(code)
+			}
+			if err := sh.Run(); err != nil {
+				return err
+			}
+			if exitCode {
+				os.Exit(sh.LastExitCode())
+			}
+			return nil
 		},
 	}
 
@@ -65,6 +86,9 @@ completion (via __completeNoDesc) and persistent command history.`,
 	root.Flags().StringVar(&history, "history", "", "History file path (default: ~/.<binary>_history)")
 	root.Flags().DurationVar(&timeout, "timeout", 500*time.Millisecond, "Tab completion timeout")
 	root.Flags().StringVar(&envBuiltin, "env-builtin", "", `Enable a built-in env command with this name (e.g. "env"). Supports: list, set KEY VALUE, unset KEY`)
+	root.Flags().StringVar(&useBuiltin, "use-builtin", "", `Enable a built-in command with this name (e.g. "use") that switches the wrapped binary`)
+	root.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with the exit code of the last command run in the session")
+	root.Flags().StringVarP(&command, "command", "c", "", "Run this command line, then exit with its exit code")
 	_ = root.MarkFlagRequired("binary")
 
 	if err := root.Execute(); err != nil {
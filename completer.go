@@ -5,10 +5,10 @@ import (
 	"context"
 	"io"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
-
-	"github.com/google/shlex"
+	"time"
 )
 
 // ShellCompDirective bitmask values, as defined by cobra (1 << iota from 1).
@@ -16,12 +16,28 @@ const (
 	compDirectiveError      = 1  // Completion failed; suppress results.
 	compDirectiveNoSpace    = 2  // Do not append a space after the completion. (unused by readline)
 	compDirectiveNoFileComp = 4  // Suppress file completion fallback.
+	compDirectiveFilterExt  = 8  // Candidates are file extensions to filter by.
+	compDirectiveFilterDirs = 16 // Complete directory names only.
 )
 
+// activeHelpPrefix marks an ActiveHelp message line in cobra's completion
+// output (cobra's activeHelpMarker).
+const activeHelpPrefix = "_activeHelp_ "
+
 // completer implements readline.AutoCompleter by invoking the wrapped binary's
 // __completeNoDesc command on every Tab press.
 type completer struct {
-	shell *Shell
+	shell  *Shell
+	replay bool // set by ReplayCompletions; suppresses recording
+
+	manPage       []string // subcommands parsed from the man page; see manPageFallback
+	manPageBinary string   // binary manPage was read for; empty until read
+
+	flagValues map[string]flagValueEntry // FlagValueCommands output by binary and command
+
+	spinner io.Writer // destination of the CompletionSpinner; nil disables it
+
+	requests completionRequests // in-flight request and CompletionDebounce state
 }
 
 // Do implements readline.AutoCompleter. readline calls it with the full current
@@ -29,16 +45,30 @@ type completer struct {
 //
 // It returns the list of completion candidates (each replacing the last
 // `length` runes before the cursor) and the number of runes to replace.
+// Candidates are computed against the text before the cursor; when the
+// cursor is inside a word, they are fitted to the rest of it (see
+// fitWordTail).
 func (c *completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
-	// Work only with the portion of the line up to the cursor.
-	segment := string(line[:pos])
+	newLine, length = c.do(line, pos)
+	if newLine = fitWordTail(newLine, wordTail(line, pos)); newLine == nil {
+		return nil, 0
+	}
+	return newLine, length
+}
+
+// do computes the completions of line[:pos] for Do.
+func (c *completer) do(line []rune, pos int) (newLine [][]rune, length int) {
+	// Work only with the portion of the line up to the cursor, and within it
+	// only with the command after the last separator.
+	segments := splitCommands(string(line[:pos]), c.shell.commandSeparator())
+	segment := segments[len(segments)-1]
 
 	// Detect whether the segment ends with whitespace so we know whether the
 	// partial word is empty (user tabbed after a space) or non-empty.
 	endsWithSpace := len(segment) > 0 &&
 		(segment[len(segment)-1] == ' ' || segment[len(segment)-1] == '\t')
 
-	tokens, err := shlex.Split(segment)
+	tokens, err := c.shell.tokenize(segment)
 	if err != nil {
 		// Unclosed quote or other parse error — no completions.
 		return nil, 0
@@ -56,7 +86,7 @@ func (c *completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 			}
 		}
 		suffix := afterNthPipe(segment, pipeCount)
-		rightTokens, err2 := shlex.Split(suffix)
+		rightTokens, err2 := c.shell.tokenize(suffix)
 		if err2 != nil {
 			return nil, 0
 		}
@@ -77,12 +107,73 @@ func (c *completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 		toComplete = tokens[len(tokens)-1]
 	}
 
+	// "$NA" or "${NA": complete an environment variable name.
+	if strings.HasPrefix(toComplete, "$") {
+		c.shell.lastSource = sourceStatic
+		return suffixes(c.shell.envVarCandidates(toComplete), toComplete)
+	}
+
+	// History is searched for the words as typed, before expansion.
+	typedArgs := contextArgs
+
+	// Complete against the expanded command when the first word is an alias.
+	// Only contextArgs is expanded: toComplete is what the user literally
+	// typed, so the suffix arithmetic below stays correct.
+	contextArgs = expandAlias(c.shell.cfg.Aliases, contextArgs, c.shell.tokenize)
+
 	// Intercept the env built-in before delegating to the binary.
 	if c.shell.cfg.EnvBuiltin != "" && len(contextArgs) >= 1 && contextArgs[0] == c.shell.cfg.EnvBuiltin {
+		c.shell.lastSource = sourceStatic
 		return c.doEnvBuiltin(contextArgs[1:], toComplete)
 	}
+	// Inside a context, complete the command the line will actually run;
+	// the context built-in itself completes the commands it can enter.
+	if cb := c.shell.cfg.ContextBuiltin; cb != "" && len(contextArgs) >= 1 && contextArgs[0] == cb {
+		contextArgs = contextArgs[1:]
+	}
+	contextArgs = c.shell.withContext(contextArgs)
 
-	candidates, directive := c.complete(contextArgs, toComplete)
+	// For "--flag=partial" cobra completes the value alone, so the word
+	// being completed — for suffixes and local files — is what follows "=".
+	word := toComplete
+	if name, value, ok := strings.Cut(toComplete, "="); ok && strings.HasPrefix(name, "-") {
+		word = value
+	}
+
+	// After a standalone "--" every argument is positional. cobra's
+	// __complete already knows this; the shell's own flag hints and the
+	// --help fallback do not, so they are skipped or filtered here.
+	afterDash := slices.Contains(contextArgs, "--")
+
+	var hints []string
+	hinted := false
+	if !afterDash {
+		if hints, hinted = c.timeFlagHints(contextArgs, toComplete); !hinted {
+			hints, hinted = c.flagValueHints(contextArgs, toComplete)
+		}
+	}
+
+	var candidates []string
+	var directive int
+	if hinted {
+		candidates = hints
+		word = toComplete
+		c.shell.lastSource = sourceStatic
+	} else {
+		candidates, directive = c.complete(contextArgs, toComplete)
+		candidates = trimCandidateSuffix(candidates, c.shell.cfg.CompletionTrimSuffix, word)
+		candidates = fileFallback(c.shell.cfg.WorkingDir, candidates, directive, word)
+		if c.shell.cfg.HistoryCompletions && word == toComplete && directive&compDirectiveError == 0 {
+			history := historyArgValues(readHistoryFile(c.shell.cfg.HistoryFile), c.shell.tokenize, typedArgs, toComplete)
+			candidates = dedupe(append(candidates, history...))
+		}
+		if afterDash {
+			candidates = slices.DeleteFunc(slices.Clone(candidates), func(cand string) bool {
+				return strings.HasPrefix(cand, "-")
+			})
+		}
+	}
+	candidates = filterAllowed(c.shell.cfg.AllowedCommands, contextArgs, candidates)
 	if directive&compDirectiveError != 0 || len(candidates) == 0 {
 		return nil, 0
 	}
@@ -91,52 +182,293 @@ func (c *completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 	// the part after the already-typed text — because readline appends them
 	// verbatim (buf.WriteRunes). Returning full words causes doubling, e.g.
 	// typing "pl" + Tab would produce "plplayer" instead of "player".
-	prefix := []rune(toComplete)
-	result := make([][]rune, len(candidates))
-	for i, s := range candidates {
-		result[i] = []rune(s)[len(prefix):]
+	prefix := []rune(word)
+	if filter := c.shell.cfg.CompletionFilter; filter != nil {
+		candidates = filter(contextArgs, toComplete, slices.Clone(candidates))
+	}
+	result := make([][]rune, 0, len(candidates))
+	for _, s := range candidates {
+		if r := []rune(s); len(r) >= len(prefix) {
+			result = append(result, r[len(prefix):])
+		}
+	}
+	if len(result) == 0 {
+		return nil, 0
 	}
 	return result, len(prefix)
 }
 
-// complete tries __completeNoDesc first. If the binary does not support it
-// (non-zero exit), it falls back to --help parsing via helpFallback.
+// wordTail returns the part of the word under the cursor that follows it:
+// the runes of line from pos up to the next space or tab.
+func wordTail(line []rune, pos int) []rune {
+	end := pos
+	for end < len(line) && line[end] != ' ' && line[end] != '\t' {
+		end++
+	}
+	return line[pos:end]
+}
+
+// fitWordTail adapts the suffixes in newLine to a cursor inside a word whose
+// remaining text is tail. readline inserts a suffix at the cursor without
+// removing anything after it, so only candidates that end with tail can be
+// completed: their suffix is inserted without the tail, which is already
+// there. Other candidates would corrupt the word and are dropped, as is an
+// empty suffix (the word is already complete). It returns nil when nothing
+// is left.
+func fitWordTail(newLine [][]rune, tail []rune) [][]rune {
+	if len(tail) == 0 {
+		return newLine
+	}
+	var fitted [][]rune
+	for _, s := range newLine {
+		if n := len(s) - len(tail); n > 0 && slices.Equal(s[n:], tail) {
+			fitted = append(fitted, s[:n])
+		}
+	}
+	return fitted
+}
+
+// trimCandidateSuffix removes suffix (Config.CompletionTrimSuffix) from the
+// end of each candidate. A candidate is kept whole when trimming would leave
+// it shorter than toComplete, since it must still extend what was typed.
+func trimCandidateSuffix(candidates []string, suffix, toComplete string) []string {
+	if suffix == "" {
+		return candidates
+	}
+	trimmed := make([]string, len(candidates))
+	for i, cand := range candidates {
+		if t := strings.TrimSuffix(cand, suffix); len(t) >= len(toComplete) {
+			cand = t
+		}
+		trimmed[i] = cand
+	}
+	return trimmed
+}
+
+// fileFallback applies cobra's file-completion directives. A shell given no
+// candidates completes local file paths unless the directive includes
+// compDirectiveNoFileComp; compDirectiveFilterExt turns the candidates into
+// the allowed extensions and compDirectiveFilterDirs restricts the result to
+// directories. Paths are resolved against dir (see fileCandidates). Other
+// results are returned unchanged.
+func fileFallback(dir string, candidates []string, directive int, toComplete string) []string {
+	switch {
+	case directive&compDirectiveError != 0:
+		return candidates
+	case directive&compDirectiveFilterExt != 0:
+		return fileCandidates(dir, toComplete, false, candidates)
+	case directive&compDirectiveFilterDirs != 0:
+		return fileCandidates(dir, toComplete, true, nil)
+	case len(candidates) == 0 && directive&compDirectiveNoFileComp == 0:
+		return fileCandidates(dir, toComplete, false, nil)
+	}
+	return candidates
+}
+
+// dedupe returns candidates without repeated entries, keeping the first
+// occurrence of each so that the source's ordering is preserved.
+func dedupe(candidates []string) []string {
+	seen := make(map[string]bool, len(candidates))
+	out := candidates[:0:0]
+	for _, cand := range candidates {
+		if !seen[cand] {
+			seen[cand] = true
+			out = append(out, cand)
+		}
+	}
+	return out
+}
+
+// complete resolves the candidates for a request (see resolve), drops
+// duplicates, and records the request when CompletionRecordFile is set.
 func (c *completer) complete(contextArgs []string, toComplete string) ([]string, int) {
+	candidates, directive := c.resolve(contextArgs, toComplete)
+	candidates = dedupe(candidates)
+	if c.shell.cfg.CompletionRecordFile != "" && !c.replay {
+		c.record(contextArgs, toComplete, candidates, directive)
+	}
+	return candidates, directive
+}
+
+// resolve consults the persistent completion cache, when configured, and
+// otherwise tries __completeNoDesc. If the binary does not support it
+// (non-zero exit), it falls back to --help parsing via helpFallback, unless
+// DisableHelpFallback is set, and, when that yields nothing and
+// ManPageFallback is enabled, to the man page. Only __completeNoDesc results
+// are cached.
+//
+// A successful __completeNoDesc with no candidates is a definitive answer —
+// nothing matches — and is returned as is; the fallbacks are only for
+// binaries that cannot answer at all.
+//
+// A source forced with the completion-source built-in is used alone,
+// bypassing the cache and the fallback chain. The source that answered is
+// recorded for the built-in.
+func (c *completer) resolve(contextArgs []string, toComplete string) ([]string, int) {
+	switch c.shell.forcedSource {
+	case sourceHelp:
+		c.shell.lastSource = sourceHelp
+		return c.helpFallback(contextArgs, toComplete)
+	case sourceMan:
+		c.shell.lastSource = sourceMan
+		return c.manPageFallback(contextArgs, toComplete), 0
+	}
+
+	cache := c.shell.compCache
+	if c.replay || c.shell.forcedSource == sourceComplete {
+		cache = nil // replays and forced lookups check the live binary
+	}
+	if cache != nil {
+		if e, ok := cache.get(contextArgs, toComplete); ok {
+			c.shell.lastSource = sourceCache
+			return e.Candidates, e.Directive
+		}
+	}
+
+	c.shell.lastSource = sourceComplete
 	candidates, directive, ok := c.tryComplete(contextArgs, toComplete)
 	if ok {
+		if cache != nil && directive&compDirectiveError == 0 {
+			cache.put(contextArgs, toComplete, candidates, directive)
+		}
 		return candidates, directive
 	}
-	return c.helpFallback(contextArgs, toComplete)
+	if c.shell.forcedSource == sourceComplete {
+		return nil, 0
+	}
+
+	if !c.shell.cfg.DisableHelpFallback {
+		c.shell.lastSource = sourceHelp
+		candidates, directive = c.helpFallback(contextArgs, toComplete)
+	}
+	if len(candidates) == 0 && c.shell.cfg.ManPageFallback {
+		c.shell.lastSource = sourceMan
+		candidates = c.manPageFallback(contextArgs, toComplete)
+	}
+	return candidates, directive
 }
 
 // tryComplete invokes __completeNoDesc and parses the result.
 // ok is false when the binary exits non-zero, indicating it does not support
 // __completeNoDesc; in that case the caller should try the --help fallback.
+//
+// With CompletionRetries, a failed request that started the binary is
+// repeated after a short, doubling pause. All attempts share one
+// CompletionTimeout, so retries never make Tab wait longer than a single
+// request could.
+//
+// A request still running when another starts is canceled and answers with
+// compDirectiveError, so that its stale candidates are dropped. Within
+// CompletionDebounce, a request identical to the previous one, for the same
+// binary, working directory and environment, reuses its result without
+// running the binary.
 func (c *completer) tryComplete(contextArgs []string, toComplete string) (candidates []string, directive int, ok bool) {
 	args := make([]string, 0, 1+len(contextArgs)+1)
 	args = append(args, "__completeNoDesc")
 	args = append(args, contextArgs...)
 	args = append(args, toComplete)
 
+	key := requestKey(c.shell.binary, c.shell.cfg.WorkingDir, c.shell.effectiveEnv(), args)
+	if res, ok := c.requests.recent(key, c.shell.cfg.CompletionDebounce); ok {
+		return res.candidates, res.directive, true
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), c.shell.cfg.CompletionTimeout)
 	defer cancel()
+	req := c.requests.begin(cancel)
 
-	cmd := exec.CommandContext(ctx, c.shell.binary, args...)
-	cmd.Env = c.shell.buildEnv()
-	cmd.Stderr = io.Discard
-
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
+	if c.spinner != nil {
+		stop := startSpinner(c.spinner, c.shell.cfg.CompletionTimeout/2)
+		defer func() {
+			if stop() && c.shell.rl != nil {
+				c.shell.rl.Refresh()
+			}
+		}()
+	}
 
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	var stdout, stderr bytes.Buffer
+	var err error
+	backoff := completionRetryBackoff
+	for attempt := 0; ; attempt++ {
+		stdout.Reset()
+		stderr.Reset()
+		err = c.runComplete(ctx, args, &stdout, &stderr)
+		if err == nil || isSpawnFailure(err) || attempt >= c.shell.cfg.CompletionRetries ||
+			!sleepContext(ctx, backoff) {
+			break
+		}
+		backoff *= 2
+	}
+	if c.requests.end(req) {
+		return nil, compDirectiveError, true
+	}
+	if elapsed := time.Since(start); c.shell.cfg.OnSlowCompletion != nil && elapsed > c.shell.cfg.CompletionTimeout/2 {
+		c.shell.cfg.OnSlowCompletion(elapsed)
+	}
+	c.shell.unreachable = isSpawnFailure(err)
+	if err != nil {
 		// Non-zero exit: binary does not support __completeNoDesc.
 		return nil, 0, false
 	}
 
-	candidates, directive = parseCompletions(buf.String())
+	output := stdout.String()
+	if c.shell.cfg.CompletionReadStderr && !hasDirective(output) {
+		// The binary wrote its completions (or at least the directive line)
+		// to stderr. Parse stdout and stderr together so candidates split
+		// across both streams are still recovered.
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		output += stderr.String()
+	}
+
+	candidates, directive = parseCompletions(output)
+	if c.shell.cfg.CompletionDebounce > 0 {
+		c.requests.remember(key, completionResult{candidates, directive})
+	}
 	return candidates, directive, true
 }
 
+// completionRetryBackoff is the pause before the first CompletionRetries
+// retry; it doubles for each further one.
+const completionRetryBackoff = 25 * time.Millisecond
+
+// sleepContext waits for d and reports true, or returns false as soon as ctx
+// is done.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// runComplete runs the binary once with args, the __completeNoDesc request,
+// bounded by ctx, and collects its stdout, and its stderr when
+// CompletionReadStderr is set.
+func (c *completer) runComplete(ctx context.Context, args []string, stdout, stderr *bytes.Buffer) error {
+	cmd := exec.CommandContext(ctx, c.shell.binary, args...)
+	cmd.Dir = c.shell.cfg.WorkingDir
+	cmd.Env = c.shell.buildEnv()
+	cmd.Stderr = io.Discard
+	if c.shell.cfg.CompletionReadStderr {
+		cmd.Stderr = stderr
+	}
+
+	if c.shell.cfg.PTYCompletion {
+		return runCaptureWithPTY(cmd, stdout)
+	}
+	if c.shell.cfg.IsolateCompletionTTY {
+		detachTTY(cmd)
+	}
+	cmd.Stdout = stdout
+	return cmd.Run()
+}
+
 // parseCompletions parses the stdout of a __completeNoDesc invocation.
 //
 // Format:
@@ -148,7 +480,9 @@ func (c *completer) tryComplete(contextArgs []string, toComplete string) (candid
 // where N is the ShellCompDirective bitmask. Lines before the directive line
 // are the completion candidates; the directive line always starts with ':'.
 // Scanning from the end makes the parser robust against binaries that emit
-// extra output before the candidates.
+// extra output before the candidates. ActiveHelp messages, which cobra emits
+// as candidate lines prefixed with "_activeHelp_ ", are not candidates and
+// are skipped.
 func parseCompletions(output string) (candidates []string, directive int) {
 	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
 
@@ -163,7 +497,7 @@ func parseCompletions(output string) (candidates []string, directive int) {
 		}
 		directive = n
 		for _, c := range lines[:i] {
-			if c != "" {
+			if c != "" && !strings.HasPrefix(c, activeHelpPrefix) {
 				candidates = append(candidates, c)
 			}
 		}
@@ -174,13 +508,32 @@ func parseCompletions(output string) (candidates []string, directive int) {
 	return nil, 0
 }
 
+// hasDirective reports whether output contains a ":N" directive line as
+// emitted by __completeNoDesc.
+func hasDirective(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) < 2 || line[0] != ':' {
+			continue
+		}
+		if _, err := strconv.Atoi(line[1:]); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // afterNthPipe returns the raw substring of s after the n-th standalone '|'
 // (one bounded by whitespace or string edges, matching shlex token behaviour).
+// Pipes inside $(...) and `...` expressions are not counted.
 // Returns "" if fewer than n standalone pipes are found.
 func afterNthPipe(s string, n int) string {
 	count := 0
-	for i, ch := range s {
-		if ch != '|' {
+	for i := 0; i < len(s); i++ {
+		if end, ok := substitutionEnd(s, i); ok {
+			i = end
+			continue
+		}
+		if s[i] != '|' {
 			continue
 		}
 		leftOk := i == 0 || s[i-1] == ' ' || s[i-1] == '\t'
@@ -200,7 +553,8 @@ func afterNthPipe(s string, n int) string {
 // partial word being completed.
 //
 // Completion sources:
-//   - No subArgs: offer "list", "set", "unset" filtered by toComplete prefix.
+//   - No subArgs: offer "list", "effective", "set", "unset", "clear" filtered by
+//     toComplete prefix.
 //   - subArgs[0] == "unset": offer current session keys filtered by prefix.
 //   - All other cases: no candidates.
 func (c *completer) doEnvBuiltin(subArgs []string, toComplete string) (newLine [][]rune, length int) {
@@ -208,11 +562,15 @@ func (c *completer) doEnvBuiltin(subArgs []string, toComplete string) (newLine [
 
 	switch {
 	case len(subArgs) == 0:
-		for _, name := range []string{"list", "set", "unset"} {
+		for _, name := range []string{"list", "effective", "set", "unset", "clear"} {
 			if strings.HasPrefix(name, toComplete) {
 				candidates = append(candidates, name)
 			}
 		}
+	case subArgs[0] == "list" && len(subArgs) == 1:
+		if strings.HasPrefix("--json", toComplete) {
+			candidates = append(candidates, "--json")
+		}
 	case subArgs[0] == "unset" && len(subArgs) == 1:
 		for _, key := range envBuiltinKeys(c.shell.SessionEnv()) {
 			if strings.HasPrefix(key, toComplete) {
@@ -221,6 +579,13 @@ func (c *completer) doEnvBuiltin(subArgs []string, toComplete string) (newLine [
 		}
 	}
 
+	return suffixes(candidates, toComplete)
+}
+
+// suffixes converts candidates that all extend toComplete into readline's
+// AutoCompleter result: the part of each after toComplete, and the length
+// of toComplete. No candidates yields nil, 0.
+func suffixes(candidates []string, toComplete string) (newLine [][]rune, length int) {
 	if len(candidates) == 0 {
 		return nil, 0
 	}
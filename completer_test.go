@@ -0,0 +1,261 @@
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCompletions(t *testing.T) {
+	candidates, directive := parseCompletions("greet\nserve\n:4\n")
+	assertSameElements(t, candidates, []string{"greet", "serve"})
+	if directive != 4 {
+		t.Errorf("directive = %d, want 4", directive)
+	}
+}
+
+func TestParseCompletions_NoDirective(t *testing.T) {
+	if candidates, directive := parseCompletions("Usage: tool\n"); candidates != nil || directive != 0 {
+		t.Errorf("parseCompletions without directive = %v, %d; want nil, 0", candidates, directive)
+	}
+}
+
+func TestParseCompletions_SkipsActiveHelp(t *testing.T) {
+	output := "start\n" +
+		"_activeHelp_ Start the server in the background\n" +
+		"stop\n" +
+		"_activeHelp_ \n" +
+		":36\n"
+	candidates, directive := parseCompletions(output)
+	assertSameElements(t, candidates, []string{"start", "stop"})
+	if directive != 36 {
+		t.Errorf("directive = %d, want 36", directive)
+	}
+}
+
+func TestParseCompletions_OnlyActiveHelp(t *testing.T) {
+	candidates, _ := parseCompletions("_activeHelp_ This command takes no arguments\n:4\n")
+	if len(candidates) != 0 {
+		t.Errorf("candidates = %v, want none", candidates)
+	}
+}
+
+func TestTrimCandidateSuffix(t *testing.T) {
+	got := trimCandidateSuffix([]string{"default/", "kube-system/", "plain"}, "/", "")
+	assertSameElements(t, got, []string{"default", "kube-system", "plain"})
+
+	// Trimming must not leave a candidate shorter than the typed word.
+	got = trimCandidateSuffix([]string{"default/"}, "/", "default/")
+	assertSameElements(t, got, []string{"default/"})
+
+	got = trimCandidateSuffix([]string{"default/"}, "", "")
+	assertSameElements(t, got, []string{"default/"})
+}
+
+func TestIntegration_CompleterDo_TrimSuffix(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CompletionTrimSuffix = "/"
+	c := &completer{shell: sh}
+
+	line := []rune("greet --namespace kube")
+	got, length := c.Do(line, len(line))
+	if length != len("kube") {
+		t.Errorf("length = %d, want %d", length, len("kube"))
+	}
+	if len(got) != 1 || string(got[0]) != "-system" {
+		t.Errorf("Do(%q) = %q, want [-system]", string(line), got)
+	}
+}
+
+func TestFitWordTail(t *testing.T) {
+	runes := func(ss ...string) [][]rune {
+		var out [][]rune
+		for _, s := range ss {
+			out = append(out, []rune(s))
+		}
+		return out
+	}
+	tests := []struct {
+		suffixes []string
+		tail     string
+		want     []string
+	}{
+		{[]string{"me", "mespace"}, "", []string{"me", "mespace"}},
+		{[]string{"ame", "amespace"}, "me", []string{"a"}},
+		{[]string{"me"}, "me", nil},
+		{[]string{"mespace"}, "me", nil},
+	}
+	for _, tt := range tests {
+		got := fitWordTail(runes(tt.suffixes...), []rune(tt.tail))
+		var names []string
+		for _, g := range got {
+			names = append(names, string(g))
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("fitWordTail(%q, %q) = %q, want %q", tt.suffixes, tt.tail, names, tt.want)
+		}
+	}
+}
+
+func TestCompleterDo_CursorMidLine(t *testing.T) {
+	c := makeEnvCompleter("env")
+	tests := []struct {
+		line   string
+		pos    int
+		want   []string
+		length int
+	}{
+		// The word before the cursor completes; the text after it is kept.
+		{"env li KEY", len("env li"), []string{"st"}, 2},
+		// Inside a word, only the missing middle is inserted.
+		{"env l", len("env l"), []string{"ist"}, 1},
+		{"env lst", len("env l"), []string{"i"}, 1},
+		// An already complete word offers nothing rather than doubling.
+		{"env list", len("env li"), nil, 0},
+		{"env setx", len("env se"), nil, 0},
+	}
+	for _, tt := range tests {
+		got, length := c.Do([]rune(tt.line), tt.pos)
+		var names []string
+		for _, g := range got {
+			names = append(names, string(g))
+		}
+		if !slices.Equal(names, tt.want) || length != tt.length {
+			t.Errorf("Do(%q, %d) = %q, %d; want %q, %d", tt.line, tt.pos, names, length, tt.want, tt.length)
+		}
+	}
+}
+
+func TestIntegration_CompleterDo_CursorMidWord(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	c := &completer{shell: newIntegrationShell()}
+
+	line := []rune("greet --nme bob")
+	got, length := c.Do(line, len("greet --n"))
+	if length != len("--n") || len(got) != 1 || string(got[0]) != "a" {
+		t.Errorf("Do(%q) = %q, %d; want [a], %d", string(line), got, length, len("--n"))
+	}
+}
+
+func TestIntegration_CompleterDo_CompletionFilter(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	c := &completer{shell: sh}
+	var gotArgs []string
+	var gotWord string
+	sh.cfg.CompletionFilter = func(contextArgs []string, toComplete string, candidates []string) []string {
+		gotArgs, gotWord = contextArgs, toComplete
+		out := candidates[:0]
+		for _, cand := range candidates {
+			if cand != "stop" {
+				out = append(out, strings.ToUpper(cand[:2])+cand[2:])
+			}
+		}
+		return out
+	}
+
+	line := []rune("serve st")
+	got, length := c.Do(line, len(line))
+	if length != len("st") || len(got) != 1 || string(got[0]) != "art" {
+		t.Errorf("Do(%q) = %q, %d; want [art] with stop dropped", string(line), got, length)
+	}
+	if len(gotArgs) != 1 || gotArgs[0] != "serve" || gotWord != "st" {
+		t.Errorf("filter got %q, %q; want [serve], st", gotArgs, gotWord)
+	}
+
+	sh.cfg.CompletionFilter = func(_ []string, _ string, candidates []string) []string {
+		for i, cand := range candidates {
+			candidates[i] = strings.ToUpper(cand)
+		}
+		return candidates
+	}
+	line = []rune("gr")
+	if got, _ := c.Do(line, len(line)); len(got) != 1 || string(got[0]) != "EET" {
+		t.Errorf("Do(%q) with an uppercasing filter = %q, want [EET]", string(line), got)
+	}
+
+	sh.cfg.CompletionFilter = func([]string, string, []string) []string { return nil }
+	if got, length := c.Do(line, len(line)); got != nil || length != 0 {
+		t.Errorf("Do(%q) with an emptying filter = %q, %d; want nil, 0", string(line), got, length)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	got := dedupe([]string{"start", "stop", "start", "status", "stop"})
+	want := []string{"start", "stop", "status"}
+	if len(got) != len(want) {
+		t.Fatalf("dedupe = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("dedupe = %v, want %v (first-seen order)", got, want)
+			break
+		}
+	}
+}
+
+func TestCompleterComplete_Dedupes(t *testing.T) {
+	sh := &Shell{cfg: Config{CompletionTimeout: defaultCompletionTimeout}, sessionEnv: make(map[string]string)}
+	sh.compCache = loadCompletionCache(filepath.Join(t.TempDir(), "cache.json"), "", "")
+	sh.compCache.put(nil, "st", []string{"start", "stop", "start"}, 4)
+	c := &completer{shell: sh}
+
+	got, _ := c.complete(nil, "st")
+	if len(got) != 2 || got[0] != "start" || got[1] != "stop" {
+		t.Errorf("complete = %v, want [start stop]", got)
+	}
+}
+
+func TestIntegration_TryComplete_RetriesTransientFailure(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	marker := filepath.Join(t.TempDir(), "failed")
+	sh := newIntegrationShell()
+	sh.cfg.Env = []string{"TESTBIN_FAIL_ONCE=" + marker}
+	c := &completer{shell: sh}
+
+	if _, _, ok := c.tryComplete(nil, "gr"); ok {
+		t.Fatal("first request succeeded; the flaky binary should fail once")
+	}
+
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	sh.cfg.CompletionRetries = 2
+	candidates, _, ok := c.tryComplete(nil, "gr")
+	if !ok || len(candidates) != 1 || candidates[0] != "greet" {
+		t.Errorf("tryComplete with retries = %v, ok=%v; want [greet], ok", candidates, ok)
+	}
+}
+
+func TestTryComplete_RetriesBoundedByTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /usr/bin/false")
+	}
+	sh := &Shell{
+		cfg:        Config{CompletionTimeout: 200 * time.Millisecond, CompletionRetries: 1000},
+		binary:     "/usr/bin/false",
+		sessionEnv: make(map[string]string),
+	}
+	c := &completer{shell: sh}
+
+	start := time.Now()
+	if _, _, ok := c.tryComplete(nil, ""); ok {
+		t.Fatal("tryComplete against a failing binary reported ok")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("retries took %v, want them bounded by CompletionTimeout", elapsed)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSessionReportingBinary writes a fake binary whose completions report
+// whether it leads its own session and whether it can open /dev/tty.
+func writeSessionReportingBinary(t *testing.T) string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "fakebin")
+	body := `#!/bin/sh
+if [ "$(ps -o sid= -p $$ | tr -d ' ')" = "$$" ]; then echo session-leader; else echo inherited-session; fi
+if (exec 3</dev/tty) 2>/dev/null; then echo tty; else echo no-tty; fi
+echo :4
+`
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestTryComplete_IsolateCompletionTTY(t *testing.T) {
+	sh := newIntegrationShell()
+	sh.binary = writeSessionReportingBinary(t)
+	c := &completer{shell: sh}
+
+	sh.cfg.IsolateCompletionTTY = true
+	got, _, ok := c.tryComplete(nil, "")
+	if !ok {
+		t.Fatal("tryComplete failed")
+	}
+	assertSameElements(t, got, []string{"session-leader", "no-tty"})
+
+	sh.cfg.IsolateCompletionTTY = false
+	got, _, _ = c.tryComplete(nil, "")
+	if len(got) == 0 || got[0] != "inherited-session" {
+		t.Errorf("without IsolateCompletionTTY, got %v; want the shell's session", got)
+	}
+}
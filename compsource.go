@@ -0,0 +1,69 @@
+package cobrashell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// completionSourceBuiltinName is the command name of the completion-source
+// built-in.
+const completionSourceBuiltinName = "completion-source"
+
+// Completion sources reported and forced by the completion-source built-in.
+const (
+	sourceComplete = "complete" // the binary's __completeNoDesc
+	sourceCache    = "cache"    // PersistentCompletionCache
+	sourceHelp     = "help"     // --help parsing; see helpFallback
+	sourceMan      = "man"      // the man page; see manPageFallback
+	sourceStatic   = "static"   // answered by the shell: built-ins, TimeFlagNames, FlagValueCommands
+)
+
+// forceableSources are the sources "completion-source force" accepts, in
+// the order they are listed in its usage message.
+var forceableSources = []string{sourceComplete, sourceHelp, sourceMan}
+
+// handleCompletionSourceBuiltin checks whether tokens[0] is the
+// completion-source built-in and Config.CompletionSourceBuiltin is set. If
+// so, it reports the source of the last completion, or forces or un-forces
+// one, and returns true.
+//
+//	completion-source               print the last and the forced source
+//	completion-source force SOURCE  use only SOURCE from now on
+//	completion-source auto          go back to the normal fallback chain
+func (s *Shell) handleCompletionSourceBuiltin(tokens []string) bool {
+	if !s.cfg.CompletionSourceBuiltin || tokens[0] != completionSourceBuiltinName {
+		return false
+	}
+	s.lastExitCode = 0
+	switch {
+	case len(tokens) == 1:
+		last := s.lastSource
+		if last == "" {
+			last = "none yet"
+		}
+		forced := s.forcedSource
+		if forced == "" {
+			forced = "auto"
+		}
+		fmt.Fprintf(s.stdout(), "last:   %s\n", last)
+		fmt.Fprintf(s.stdout(), "forced: %s\n", forced)
+	case len(tokens) == 2 && tokens[1] == "auto":
+		s.forcedSource = ""
+	case len(tokens) == 3 && tokens[1] == "force" && isForceableSource(tokens[2]):
+		s.forcedSource = tokens[2]
+	default:
+		s.writeErr("Usage:\n  %s\n  %s force {%s}\n  %s auto\n", completionSourceBuiltinName,
+			completionSourceBuiltinName, strings.Join(forceableSources, "|"), completionSourceBuiltinName)
+		s.lastExitCode = 1
+	}
+	return true
+}
+
+func isForceableSource(source string) bool {
+	for _, f := range forceableSources {
+		if f == source {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package cobrashell
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIntegration_CompletionSourceBuiltin(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CompletionSourceBuiltin = true
+	c := &completer{shell: sh}
+
+	out := captureStdout(t, func() { sh.execute("completion-source") })
+	if out != "last:   none yet\nforced: auto\n" {
+		t.Errorf("initial report = %q", out)
+	}
+
+	line := []rune("gr")
+	c.Do(line, len(line))
+	out = captureStdout(t, func() { sh.execute("completion-source") })
+	if !strings.Contains(out, "last:   complete\n") {
+		t.Errorf("after a __completeNoDesc completion, report = %q", out)
+	}
+
+	sh.execute("completion-source force help")
+	if sh.forcedSource != sourceHelp {
+		t.Fatalf("forcedSource = %q, want %q", sh.forcedSource, sourceHelp)
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+	sh.binary = script
+	got, _ := c.Do(line, len(line))
+	if len(got) != 1 || string(got[0]) != "eet" {
+		t.Errorf("forced help: Do(gr) = %q, want [eet]", got)
+	}
+	if !invokedWithHelp(t, log) || strings.Contains(readFile(t, log), "__completeNoDesc") {
+		t.Errorf("forced help should run only --help; invocations:\n%s", readFile(t, log))
+	}
+	out = captureStdout(t, func() { sh.execute("completion-source") })
+	if out != "last:   help\nforced: help\n" {
+		t.Errorf("forced report = %q", out)
+	}
+
+	sh.execute("completion-source auto")
+	if sh.forcedSource != "" {
+		t.Errorf("forcedSource after auto = %q, want empty", sh.forcedSource)
+	}
+}
+
+func TestCompletionSourceBuiltin_Usage(t *testing.T) {
+	sh := newIntegrationShell()
+	sh.cfg.CompletionSourceBuiltin = true
+	stderr := captureStderr(t, func() { sh.execute("completion-source force bogus") })
+	if !strings.Contains(stderr, "Usage:") || sh.lastExitCode != 1 {
+		t.Errorf("stderr %q, exit %d; want usage and exit 1", stderr, sh.lastExitCode)
+	}
+	if sh.forcedSource != "" {
+		t.Errorf("forcedSource = %q after an invalid source", sh.forcedSource)
+	}
+}
+
+func TestCompletionSourceBuiltin_Disabled(t *testing.T) {
+	sh := newIntegrationShell()
+	if sh.handleCompletionSourceBuiltin([]string{"completion-source"}) {
+		t.Error("built-in handled without CompletionSourceBuiltin")
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(b)
+}
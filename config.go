@@ -15,7 +15,12 @@
 //	}
 package cobrashell
 
-import "time"
+import (
+	"io"
+	"time"
+
+	"github.com/chzyer/readline"
+)
 
 // Config holds the configuration for a [Shell].
 //
@@ -28,10 +33,47 @@ type Config struct {
 	// exec.LookPath (bare name) or filepath.Abs (path with separator).
 	BinaryPath string
 
+	// WorkingDir, when non-empty, is the directory the binary runs in for
+	// commands, pipelines, background jobs and completion requests, and the
+	// base for relative paths in local file completion. New reports an error
+	// from Run when it is not an existing directory. Defaults to "" (the
+	// shell's own working directory).
+	WorkingDir string
+
+	// Stdout and Stderr, when non-nil, receive everything the shell prints
+	// in place of os.Stdout and os.Stderr: the prompt and line editing,
+	// built-in output, cobra-shell's own messages, and the output of the
+	// commands it runs, e.g. to capture or tee the session when hosting the
+	// shell in a larger TUI. A child writing to a writer that is not a file
+	// gets a pipe, so it does not see a terminal. Defaults to nil (os.Stdout
+	// and os.Stderr).
+	Stdout io.Writer
+	Stderr io.Writer
+
 	// Prompt is the string printed at the start of each input line.
 	// Defaults to "> " if empty.
 	Prompt string
 
+	// UnreachablePrompt, when non-empty, replaces Prompt and PromptTemplate
+	// while the binary cannot be run: the last command or completion failed
+	// to start it at all (missing binary, lost mount, ...), as opposed to it
+	// running and exiting non-zero. The normal prompt returns after the next
+	// successful start. PromptFunc and DynamicPrompt, when set, take
+	// precedence.
+	UnreachablePrompt string
+
+	// Banner, when non-empty, is printed once when the interactive shell or
+	// a DemoScript starts, before OnStart runs and the first prompt is
+	// shown, e.g.
+	// "{bold}{binary} {version}{reset} - type 'help' for commands". {binary}
+	// is the basename of the binary and {version} the last word of the
+	// first line printed by "binary --version", run once at startup when
+	// the banner uses it. The color tokens of PromptTemplate are supported
+	// and dropped when stdout is not a terminal. It is not printed when
+	// commands are read from a pipe or file, nor by Exec, so that scripted
+	// output stays clean.
+	Banner string
+
 	// PrePrompt, when non-empty, is printed to stdout before each readline
 	// prompt. Use this to display a context line above the input line, for
 	// example a box-drawing top border. The string should end with "\n".
@@ -40,8 +82,27 @@ type Config struct {
 	// HistoryFile is the path to the file used to persist command history
 	// across sessions. Defaults to ~/.{basename}_history, where basename is
 	// derived from filepath.Base(BinaryPath) with any extension stripped.
+	// A missing parent directory is created when Run starts; if that fails,
+	// a warning is printed and history is kept in memory only.
 	HistoryFile string
 
+	// AdditionalHistoryFiles lists history files whose entries are merged
+	// into the active history when the shell starts, e.g. to seed history
+	// from another machine or tool. Entries are read in order (files in the
+	// order listed, lines in file order) and placed before the active
+	// history, as if they were older. Duplicate entries collapse to their
+	// most recent position. The source files are never modified; the merged
+	// result is written to HistoryFile.
+	AdditionalHistoryFiles []string
+
+	// HistoryCompletions, when true, adds to the candidates for an argument
+	// the values previously passed at the same position to the same command,
+	// as recorded in HistoryFile. For example, after "deploy --env prod",
+	// tabbing "deploy --env " offers "prod" alongside the binary's own
+	// candidates. History values follow the binary's, most recent first.
+	// Defaults to false.
+	HistoryCompletions bool
+
 	// Env contains additional environment variables, in "KEY=VALUE" form, to
 	// set when invoking the binary for both command execution and tab
 	// completion. They are appended to the current process environment; they
@@ -54,9 +115,261 @@ type Config struct {
 	// a higher value. Defaults to 500ms.
 	CompletionTimeout time.Duration
 
+	// CompletionRetries is how many times a failed __completeNoDesc request
+	// is repeated, after a short pause that doubles each time, before
+	// falling back to --help parsing. It helps network-backed binaries whose
+	// completion fails transiently. All attempts share one CompletionTimeout.
+	// A binary without __completeNoDesc fails every attempt, so keep it low
+	// for those. Defaults to 0 (no retries).
+	CompletionRetries int
+
+	// CompletionDebounce, when positive, coalesces repeated completion
+	// requests: a __completeNoDesc request identical to the previous one and
+	// made within this window reuses its result instead of running the
+	// binary again, e.g. while Tab is held down. This spares network-backed
+	// binaries. Independently of it, a request still in flight when another
+	// starts is always canceled. Defaults to 0 (every request runs).
+	CompletionDebounce time.Duration
+
+	// OnSlowCompletion, when non-nil, is called after a __completeNoDesc
+	// request that took more than half of CompletionTimeout, with the time it
+	// took. Use it to give feedback (a hint or spinner) when Tab feels
+	// unresponsive. It is also called for requests that hit the timeout.
+	OnSlowCompletion func(elapsed time.Duration)
+
+	// CompletionSpinner, when true, animates a spinner at the cursor while a
+	// __completeNoDesc request has been running for more than half of
+	// CompletionTimeout, and erases it when the request returns, so that a
+	// slow Tab visibly works. It is shown only when stdout is a terminal.
+	// Defaults to false.
+	CompletionSpinner bool
+
+	// CompletionReadStderr, when true, captures the stderr of the
+	// __completeNoDesc subprocess in addition to stdout. If stdout contains
+	// no ":N" directive line, completions are parsed from the combined
+	// stdout+stderr output instead. Enable this for non-standard Cobra setups
+	// that write their completion output to stderr. Defaults to false
+	// (stderr is discarded).
+	CompletionReadStderr bool
+
+	// CompletionRecordFile, when non-empty, is the path of a file to which
+	// every completion request and its result are appended as JSON lines.
+	// A recording can later be checked against the current behaviour of the
+	// binary with [Shell.ReplayCompletions], enabling golden-file tests of
+	// completion. Recording errors are silently ignored.
+	CompletionRecordFile string
+
+	// CompletionTrimSuffix, when non-empty, is removed from the end of every
+	// candidate the binary returns before it is inserted, for binaries that
+	// mark candidates with a trailing "/" or ".yaml" the user does not want
+	// typed. A candidate that would become shorter than the word being
+	// completed is inserted whole. Local file completions are not trimmed.
+	// Defaults to "" (no trimming).
+	CompletionTrimSuffix string
+
+	// CompletionFilter, when non-nil, post-processes the candidates of every
+	// completion, from any source, just before they are inserted: it may
+	// reorder, drop, or rewrite them. contextArgs are the words before the
+	// one being completed, after alias and context expansion; toComplete is
+	// that word as typed. Only the part of each returned candidate past the
+	// typed word is inserted, so candidates shorter than it are dropped.
+	// Returning no candidates suppresses the completion.
+	CompletionFilter func(contextArgs []string, toComplete string, candidates []string) []string
+
+	// PTYCompletion, when true, runs the __completeNoDesc subprocess with its
+	// stdin and stdout attached to a pseudo-terminal instead of pipes. Use it
+	// for binaries that suppress or alter completions when stdout is not a
+	// TTY. Spawning a PTY per Tab press is heavier than a plain subprocess,
+	// so this is opt-in. Stderr is still captured separately. Ignored on
+	// Windows. Defaults to false.
+	PTYCompletion bool
+
+	// WarmupOnStart, when true, runs a throwaway __completeNoDesc "" in the
+	// background as Run starts, so that a binary with a slow cold start has
+	// its executable and libraries in the OS cache (and any connection pools
+	// it keeps warm) before the first real command or Tab press. Run does not
+	// wait for it, and its output and exit status are ignored. Defaults to
+	// false.
+	WarmupOnStart bool
+
+	// IsolateCompletionTTY, when true, starts the __completeNoDesc subprocess
+	// in a new session (setsid) so that it has no controlling terminal. A
+	// binary that opens /dev/tty during completion then fails to, instead of
+	// writing over the prompt where stderr redirection cannot catch it.
+	// Ignored with PTYCompletion, whose subprocess gets the pseudo-terminal
+	// as its controlling terminal, and on Windows. Defaults to false.
+	IsolateCompletionTTY bool
+
+	// CommandSeparator separates several commands on one input line, e.g.
+	// "greet ; fail ; echo done". Each command runs in order whatever the exit
+	// code of the previous one, and fires its own BeforeExec/AfterExec hooks;
+	// a separator also ends a pipeline. Like "|", the separator must stand
+	// alone between spaces and is ignored inside quotes. An "exit" command
+	// in any segment ends the session after the segments before it have
+	// run. Defaults to ";".
+	CommandSeparator string
+
+	// DisableCommandSeparator, when true, turns off CommandSeparator, so a
+	// standalone separator is passed to the binary like any other argument.
+	// Defaults to false.
+	DisableCommandSeparator bool
+
+	// CommentPrefix starts a comment line when commands are read from a pipe
+	// or file rather than typed: such lines are skipped, after leading
+	// whitespace is trimmed. Point it at another prefix, e.g. "//", for
+	// binaries to which "#" is meaningful, or at an empty string to turn
+	// comment lines off so that every line is run. It is a pointer so that
+	// an empty prefix can be told apart from an unset one. Defaults to nil
+	// ("#").
+	CommentPrefix *string
+
+	// Tokenizer, when non-nil, splits a command into arguments in place of
+	// POSIX shell quoting (shlex), for binaries whose arguments follow other
+	// conventions. It is used both to run a command and to find the words
+	// before the cursor for completion; a tokenizer error makes the command
+	// fail to parse and yields no completions. Command separators, aliases
+	// and "|" are still recognised before it runs. Defaults to nil (shlex).
+	Tokenizer func(line string) ([]string, error)
+
+	// CommandSubstitution, when true, replaces $(...) and `...` expressions
+	// in a command's arguments with the trimmed output of running them
+	// through the platform shell in WorkingDir, so "greet --name $(whoami)"
+	// works outside pipelines too. Expressions run only after the command
+	// has passed AllowedCommands, confirmation and BeforeExec, which see
+	// them as typed; built-ins such as explain never run them. The output
+	// is inserted as literal text and split on whitespace unless the
+	// expression is inside double quotes. If a substitution command fails,
+	// an error is printed and the command is not run. Expressions in single
+	// quotes are left alone. Defaults to false.
+	CommandSubstitution bool
+
+	// PreprocessLine, when non-nil, rewrites every input line before it is
+	// split into commands and tokenised. It receives the raw line and the
+	// previous non-blank line as it was run (after its own rewriting), and
+	// returns the line to run; returning "" runs nothing. It replaces
+	// HistoryExpansion. Defaults to nil.
+	PreprocessLine func(line, prev string) string
+
+	// HistoryExpansion, when true and PreprocessLine is nil, expands "!!" in
+	// an input line to the previous line and "!$" to that line's last
+	// argument, as in bash. Designators in single quotes or escaped with a
+	// backslash are left alone; using one before any line has run prints an
+	// error and runs nothing. Defaults to false.
+	HistoryExpansion bool
+
+	// PasteMode, when set, enables the terminal's bracketed paste mode so
+	// that a pasted block containing line breaks is received as a whole
+	// instead of running line by line as it arrives. [PasteConfirm] lists the
+	// pasted lines and asks y/n before running them, [PasteLines] runs them
+	// in turn without asking, and [PasteReject] discards them with a notice.
+	// Single-line pastes are inserted at the prompt as usual. Any other value
+	// is an error returned by Run. Defaults to "" (bracketed paste off).
+	PasteMode string
+
+	// CaptureOutput, when true, copies the combined stdout and stderr of each
+	// command into a buffer readable with [Shell.LastOutput], for tools that
+	// build on the shell and need to inspect what the last command printed.
+	// The most recent 1 MiB is kept. Outside PTY mode the binary then writes
+	// to pipes rather than the terminal, which may disable its colors.
+	// Defaults to false.
+	CaptureOutput bool
+
+	// TimeFlagNames lists flags whose values are points in time, e.g.
+	// {"since", "until"} (leading dashes are optional). When completing the
+	// value of one of them, as "--since <Tab>" or "--since=<Tab>", the
+	// binary is not consulted; instead relative durations (5m, 1h, 24h, ...)
+	// and absolute timestamps for today, yesterday, and the current hour are
+	// offered.
+	TimeFlagNames []string
+
+	// FlagValueCommands maps a flag name to a command of the binary whose
+	// output lists the flag's values, e.g. {"namespace": {"get",
+	// "namespaces", "-o", "name"}} (leading dashes are optional). When
+	// completing the value of the flag, as "--namespace <Tab>" or
+	// "--namespace=<Tab>", the command is run with CompletionTimeout and each
+	// non-empty line of its stdout is offered in place of __completeNoDesc.
+	// Output is reused for 10 seconds. If the command fails, normal
+	// completion applies.
+	FlagValueCommands map[string][]string
+
+	// PersistentCompletionCache, when non-empty, is the path of a file that
+	// caches __completeNoDesc results across sessions, for binaries with
+	// stable completions such as static subcommand trees. The cache is loaded
+	// by New and rewritten whenever a new result is added. It is tied to the
+	// binary's path, modification time, and size, and to WorkingDir, since
+	// file-argument completions depend on it: when any of them change the
+	// cache is discarded. Cached results do not reflect Env or session
+	// variables, so leave it unset for binaries whose completions depend on
+	// them. Defaults to "" (no cache).
+	PersistentCompletionCache string
+
+	// AllowedCommands, when non-empty, restricts the shell to the listed
+	// top-level commands of the binary, e.g. []string{"get", "describe"}
+	// for a read-only jump host. A command line whose first word (after
+	// alias expansion and inside the active context) is not listed is
+	// rejected with "command not permitted", and completion offers only the
+	// listed commands. Shell built-ins are not affected. Defaults to nil
+	// (every command is allowed).
+	AllowedCommands []string
+
+	// DisableHelpFallback, when true, turns off the --help parsing used when
+	// the binary does not support __completeNoDesc, so completion never runs
+	// "binary ... --help" behind the user's back. Use it for deployments
+	// where every binary is a Cobra binary. Defaults to false.
+	DisableHelpFallback bool
+
+	// HelpUsageEnums, when true, lets the --help fallback also offer the
+	// values of brace groups such as "{fast|slow}" written in the help's
+	// Usage: section when completing a positional argument. Off by default
+	// because braces in free-form usage text are not always value lists.
+	HelpUsageEnums bool
+
+	// ErrorHints are messages printed after a command that exits non-zero,
+	// when its stderr matches the hint's pattern, e.g. {Pattern:
+	// "(?i)unauthorized", Message: "hint: try 'env set TOKEN ...'"}. Every
+	// matching hint is printed, in order. Patterns are compiled by New; an
+	// invalid pattern is reported by Run. Matching needs a copy of stderr,
+	// so outside PTY mode the binary's stderr becomes a pipe; in PTY mode,
+	// where stdout and stderr are merged, patterns see both.
+	ErrorHints []ErrorHint
+
+	// CommandNotFoundCode, when non-zero, is the exit code with which the
+	// binary reports an unknown command, for Hooks.OnCommandNotFound.
+	// Defaults to 0 (match on CommandNotFoundPattern only).
+	CommandNotFoundCode int
+
+	// CommandNotFoundPattern is a regular expression matched against the
+	// stderr of a failed command to tell that the binary did not know the
+	// command, for Hooks.OnCommandNotFound. Matching needs a copy of stderr,
+	// as with ErrorHints. An invalid pattern is reported by Run. Defaults to
+	// cobra's `unknown command "` error when CommandNotFoundCode is also
+	// unset, and to no pattern otherwise.
+	CommandNotFoundPattern string
+
+	// ConfirmPatterns are regular expressions ([regexp] syntax) matched
+	// against each command line after alias expansion, e.g. `^delete\b`.
+	// When one matches, the shell asks "Run '<line>'? [y/N]" and runs the
+	// command only on "y" or "yes"; a declined command exits with code 1
+	// without running BeforeExec. Without a terminal (pipe mode) there is no
+	// one to ask and matching commands are not run. Patterns are compiled by
+	// New; an invalid pattern is reported by Run.
+	ConfirmPatterns []string
+
+	// ManPageFallback, when true, adds a last-resort completion source for
+	// binaries that support neither __completeNoDesc nor a parseable --help:
+	// top-level subcommand names are extracted from the binary's man page
+	// (the SYNOPSIS and COMMANDS sections of "man {basename}"). Parsing is
+	// best-effort. Defaults to false.
+	ManPageFallback bool
+
+	// ManPageFile, when non-empty, is a plain-text man page read instead of
+	// running man when ManPageFallback is enabled.
+	ManPageFile string
+
 	// EnvBuiltin, when non-empty, enables a built-in command for managing
 	// session-scoped environment variables. The value becomes the command
-	// name (e.g. "env"). Supported subcommands: list, set KEY VALUE, unset KEY.
+	// name (e.g. "env"). Supported subcommands: list, set KEY VALUE, unset KEY,
+	// clear.
 	//
 	// The built-in is intercepted before the binary is spawned, so it works
 	// even for binaries that have their own "env" subcommand — simply choose
@@ -65,6 +378,112 @@ type Config struct {
 	// Defaults to "" (disabled).
 	EnvBuiltin string
 
+	// EnvExpand, when true, makes the env built-in's set subcommand expand
+	// $VAR and ${VAR} references in the value against the environment the
+	// binary would see (os.Environ, Config.Env, and session variables). An
+	// undefined variable expands to the empty string. Defaults to false:
+	// values are stored literally.
+	EnvExpand bool
+
+	// UseBuiltin, when non-empty, enables a built-in command for switching the
+	// wrapped binary at runtime. The value becomes the command name (e.g.
+	// "use"); "use helm" re-resolves the new binary exactly like BinaryPath
+	// and makes it the target of subsequent commands and completions.
+	//
+	// When Prompt or HistoryFile were left at their defaults, they follow the
+	// active binary: the prompt becomes "{basename}> " and history switches to
+	// ~/.{basename}_history. Explicitly configured values are left untouched.
+	// If the new binary cannot be resolved an error is printed and the current
+	// binary stays active.
+	//
+	// Defaults to "" (disabled).
+	UseBuiltin string
+
+	// HelpBuiltin, when non-empty, enables a built-in command that summarises
+	// the shell's own features: how to exit, the enabled built-ins, configured
+	// aliases, and pipe support. The value becomes the command name; choose
+	// one that does not shadow the binary's own "help" (e.g. ":help").
+	//
+	// Defaults to "" (disabled).
+	HelpBuiltin string
+
+	// JobsBuiltin, when non-empty, enables background jobs and a built-in
+	// command, named by the value (e.g. "jobs"), that lists them. A command
+	// ending in a standalone "&" is then started without waiting for it;
+	// its output goes to the terminal and it gets no stdin. BeforeExec runs
+	// for background commands, AfterExec does not. Running jobs are killed
+	// when the shell exits. Pipelines cannot be backgrounded.
+	//
+	// Defaults to "" (disabled).
+	JobsBuiltin string
+
+	// MaxBackgroundJobs limits how many background jobs may run at once.
+	// When the limit is reached, a further "&" command is rejected with an
+	// error and not started. Defaults to 0 (no limit).
+	MaxBackgroundJobs int
+
+	// ExplainBuiltin, when true, enables the "explain LINE" built-in, which
+	// prints how LINE would be run — alias expansion, the resolved binary, the
+	// final argument vector, and the environment variables added on top of
+	// the inherited environment — without running anything.
+	ExplainBuiltin bool
+
+	// VersionBuiltin, when non-empty, enables a built-in command, named by the
+	// value (e.g. "version"), that prints the cobra-shell [Version] and the
+	// first line of "binary --version", for bug reports. Naming it after a
+	// subcommand of the binary hides that subcommand. Defaults to "".
+	VersionBuiltin string
+
+	// CompletionSourceBuiltin, when true, enables the "completion-source"
+	// built-in for troubleshooting completion. On its own it prints where
+	// the last Tab completion came from: "complete" (__completeNoDesc),
+	// "cache", "help" (--help parsing), "man", or "static" (answered by the
+	// shell itself). "completion-source force help" makes completion use only
+	// that source ("complete", "help", or "man") until "completion-source
+	// auto" restores the normal fallback chain.
+	CompletionSourceBuiltin bool
+
+	// ContextBuiltin, when non-empty, enables command contexts, as in
+	// router-style "configure" sub-shells. "<ContextBuiltin> get" enters the
+	// "get" context: every following command is run with "get" prepended, so
+	// "pods" runs "get pods", and Tab completion completes within it too.
+	// Contexts nest; "up" — or "exit" while in a context — leaves the
+	// innermost one. The prompt shows the active context in parentheses,
+	// e.g. "(get) > ". Built-ins are never prefixed.
+	//
+	// Defaults to "" (disabled).
+	ContextBuiltin string
+
+	// Aliases maps a command name to the text it expands to, e.g.
+	// {"gp": "get pods"}. When the first word of an input line matches an
+	// alias it is replaced by the expansion before the line is run; the rest
+	// of the line is appended unchanged, so "gp -n kube-system" runs
+	// "get pods -n kube-system". Tab completion sees the expanded command.
+	// Expansion is not recursive and a quoted first word is never expanded.
+	Aliases map[string]string
+
+	// PromptTemplate, when non-empty, is expanded before each input line to
+	// produce the prompt, e.g. "{binary}[{exit}]> ". Placeholders:
+	//
+	//	{binary}  basename of the wrapped binary
+	//	{exit}    exit code of the most recent command (0 initially)
+	//	{time}    current local time as HH:MM
+	//	{cwd}     current working directory, with $HOME shown as ~
+	//
+	// Color tokens {red}, {green}, {yellow}, {blue}, {magenta}, {cyan},
+	// {bold}, and {reset} insert the matching Color* code, wrapped in the
+	// same readline markers [Colorize] uses. Unknown placeholders are left as
+	// is. PromptTemplate overrides Prompt; PromptFunc and DynamicPrompt
+	// override both.
+	PromptTemplate string
+
+	// DemoScript, when non-empty, makes Run play a scripted session instead
+	// of reading input, for reproducible demos and screencasts: each step's
+	// command is typed out after the prompt one character at a time, pausing
+	// DemoStep.Delay after each, and then executed as if the user had
+	// pressed Enter. Run returns after the last step.
+	DemoScript []DemoStep
+
 	// DynamicPrompt, when non-nil, is called after each command completes to
 	// produce the prompt for the next input line. The argument is the exit
 	// code of the most recently executed command (0 on success). When set,
@@ -81,6 +500,24 @@ type Config struct {
 	//	},
 	DynamicPrompt func(lastExitCode int) string
 
+	// PromptFunc, when non-nil, is called before each input line to produce
+	// the prompt from a [PromptContext] describing the session: the last
+	// exit code, the command count, how long the last command took, and
+	// more. It is the structured alternative to DynamicPrompt and takes
+	// precedence over it and every other prompt option.
+	//
+	//	PromptFunc: func(pc cobrashell.PromptContext) string {
+	//	    return fmt.Sprintf("[%d %s] › ", pc.CommandCount, pc.LastDuration.Round(time.Millisecond))
+	//	},
+	PromptFunc func(PromptContext) string
+
+	// ConfigureReadline, when non-nil, is called with the readline instance
+	// as soon as Run has created it, before OnStart and the first prompt. Use
+	// it for readline features cobra-shell does not wrap, such as custom key
+	// bindings via the instance's Config.SetListener. Not called in pipe mode,
+	// where readline is not used.
+	ConfigureReadline func(rl *readline.Instance)
+
 	// Hooks contains optional lifecycle callbacks. All fields are optional;
 	// nil hooks are silently skipped.
 	Hooks Hooks
@@ -91,7 +528,8 @@ type Config struct {
 type Hooks struct {
 	// BeforeExec is called before each command is executed. Return a non-nil
 	// error to cancel execution; the error message is printed to stderr and
-	// the shell continues. Return nil to allow execution to proceed.
+	// the shell continues. Return nil to allow execution to proceed. A
+	// [ValidationError] is printed with one line per reason.
 	//
 	// Example use: validating an auth token before every command.
 	BeforeExec func(args []string) error
@@ -101,12 +539,65 @@ type Hooks struct {
 	// the exit code is non-zero.
 	AfterExec func(args []string, exitCode int)
 
+	// AfterExecDetailed, like AfterExec, is called after each command
+	// completes, with details on how it ended. When both are set, AfterExec
+	// is called first.
+	//
+	// Deprecated: Use AfterExecResult, which receives the same [ExecResult];
+	// its Args field carries the arguments.
+	AfterExecDetailed func(args []string, result ExecResult)
+
+	// AfterExecResult is called after each command completes, with an
+	// [ExecResult] describing the arguments and how the command ended. It
+	// runs after AfterExec and the deprecated AfterExecDetailed.
+	AfterExecResult func(result ExecResult)
+
+	// OnCommandNotFound is called after a command the binary rejected as
+	// unknown (see Config.CommandNotFoundCode and CommandNotFoundPattern),
+	// once the failed command's AfterExec hooks have run. It receives the
+	// command's arguments and may suggest alternatives or correct typos:
+	// returning retry true runs retryTokens in place of the command, through
+	// BeforeExec and AfterExec again. A corrected command that is not found
+	// either is not retried.
+	OnCommandNotFound func(tokens []string) (retryTokens []string, retry bool)
+
 	// OnStart is called once when the shell starts, before the first prompt
 	// is displayed. Useful for printing a welcome banner or initialising
-	// shared state.
+	// shared state. [Shell.Readline] is already valid at this point.
 	OnStart func(shell *Shell)
 
 	// OnExit is called once when the shell exits cleanly via Ctrl-D or the
 	// built-in "exit" command.
 	OnExit func()
 }
+
+// ExecResult describes how a command run by the shell ended. It is passed to
+// [Hooks.AfterExecResult] and the deprecated [Hooks.AfterExecDetailed].
+type ExecResult struct {
+	// Args are the arguments the binary was run with; for a pipeline, those
+	// left of the first "|". They are the args AfterExec receives.
+	Args []string
+
+	// ExitCode is the process exit code. When the process was killed by a
+	// signal it is 128 plus the signal number, as in POSIX shells.
+	ExitCode int
+
+	// Signal is the name of the signal that killed the process (e.g.
+	// "SIGKILL"), or "" if it exited normally.
+	Signal string
+
+	// Duration is the wall-clock time the command ran for.
+	Duration time.Duration
+
+	// Number is the command's position in the session, counting from 1; see
+	// [Shell.CommandCount].
+	Number int
+
+	// UsedPTY reports whether the command ran attached to a pseudo-terminal,
+	// which happens when the shell's stdin is a terminal (never on Windows).
+	UsedPTY bool
+
+	// Piped reports whether the command ran as the left side of a pipeline,
+	// through the platform shell. Piped commands never use a PTY.
+	Piped bool
+}
@@ -0,0 +1,64 @@
+package cobrashell
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compileConfirmPatterns compiles Config.ConfirmPatterns, reporting the first
+// invalid one.
+func compileConfirmPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("cobra-shell: ConfirmPatterns[%d]: invalid pattern %q: %w", i, p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// needsConfirmation reports whether line matches any of patterns.
+func needsConfirmation(line string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmed asks whether line should run when it matches ConfirmPatterns. It
+// returns true when no pattern matches or the user answers yes.
+func (s *Shell) confirmed(line string) bool {
+	if !needsConfirmation(line, s.confirmPatterns) {
+		return true
+	}
+	if s.rl == nil {
+		s.writeErr("cobra-shell: %q needs confirmation; not run without a terminal\n", line)
+		return false
+	}
+	return s.readYesNo(fmt.Sprintf("Run '%s'? [y/N] ", line))
+}
+
+// readYesNo asks question on the readline prompt and reports whether the
+// answer is yes (see isYes). The regular prompt is restored afterwards. It
+// must only be called while the interactive loop is running.
+func (s *Shell) readYesNo(question string) bool {
+	s.rl.SetPrompt(question)
+	answer, err := s.rl.Readline()
+	s.rl.SetPrompt(s.prompt())
+	return err == nil && isYes(answer)
+}
+
+// isYes reports whether answer accepts a y/N question: "y" or "yes",
+// case-insensitively. Anything else, including an empty answer, declines.
+func isYes(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
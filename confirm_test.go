@@ -0,0 +1,85 @@
+package cobrashell
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNeedsConfirmation(t *testing.T) {
+	patterns := []*regexp.Regexp{regexp.MustCompile(`^delete\b`), regexp.MustCompile(`--force`)}
+	cases := []struct {
+		line string
+		want bool
+	}{
+		{"delete pod web", true},
+		{"apply --force -f x.yaml", true},
+		{"get pods", false},
+		{"undelete pod", false},
+		{"deleted", false},
+	}
+	for _, tc := range cases {
+		if got := needsConfirmation(tc.line, patterns); got != tc.want {
+			t.Errorf("needsConfirmation(%q) = %v, want %v", tc.line, got, tc.want)
+		}
+	}
+	if needsConfirmation("delete pod", nil) {
+		t.Error("no patterns should never need confirmation")
+	}
+}
+
+func TestIsYes(t *testing.T) {
+	for answer, want := range map[string]bool{"y": true, "YES": true, " y ": true, "": false, "n": false, "yep": false} {
+		if got := isYes(answer); got != want {
+			t.Errorf("isYes(%q) = %v, want %v", answer, got, want)
+		}
+	}
+}
+
+func TestNew_InvalidConfirmPattern(t *testing.T) {
+	s := New(Config{BinaryPath: "/usr/bin/true", ConfirmPatterns: []string{"("}})
+	if err := s.Run(); err == nil || !strings.Contains(err.Error(), "ConfirmPatterns[0]") {
+		t.Errorf("Run() = %v, want a ConfirmPatterns error", err)
+	}
+}
+
+func TestIntegration_Confirm_PipeModeDeclines(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.confirmPatterns = []*regexp.Regexp{regexp.MustCompile(`^echo danger`)}
+	var out string
+	stderr := captureStderr(t, func() {
+		out = captureStdout(t, func() { sh.execute("echo danger") })
+	})
+	if out != "" || !strings.Contains(stderr, "needs confirmation") || sh.lastExitCode != 1 {
+		t.Errorf("output %q, stderr %q, exit %d; want the command skipped", out, stderr, sh.lastExitCode)
+	}
+}
+
+func TestIntegration_Confirm_Interactive(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	run := func(input string) string {
+		s := New(Config{
+			BinaryPath:      testBinary,
+			HistoryFile:     filepath.Join(t.TempDir(), "history"),
+			ConfirmPatterns: []string{`^echo danger`},
+		})
+		return captureStdout(t, func() {
+			if err := s.runInteractive(io.NopCloser(strings.NewReader(input))); err != nil {
+				t.Errorf("runInteractive: %v", err)
+			}
+		})
+	}
+	if out := run("echo danger\ny\nexit\n"); !strings.Contains(out, "danger\n") {
+		t.Errorf("accepted: output %q should contain the command's output", out)
+	}
+	if out := run("echo danger\nn\necho safe\nexit\n"); strings.Contains(out, "danger\n") || !strings.Contains(out, "safe\n") {
+		t.Errorf("declined: output %q should contain only the unmatched command", out)
+	}
+}
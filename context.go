@@ -0,0 +1,86 @@
+package cobrashell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextUpBuiltinName is the command name of the built-in that leaves the
+// innermost context; see Config.ContextBuiltin.
+const contextUpBuiltinName = "up"
+
+// handleContextBuiltin checks whether tokens is one of the context built-ins
+// enabled by Config.ContextBuiltin. "<ContextBuiltin> WORDS..." enters a
+// context made of WORDS and "up" leaves the innermost one. It returns true
+// when tokens was handled.
+func (s *Shell) handleContextBuiltin(tokens []string) bool {
+	if s.cfg.ContextBuiltin == "" {
+		return false
+	}
+	switch tokens[0] {
+	case s.cfg.ContextBuiltin:
+		if len(tokens) == 1 {
+			s.writeErr("Error: requires a command to enter\n\nUsage:\n  %s COMMAND...\n", s.cfg.ContextBuiltin)
+			s.lastExitCode = 1
+			return true
+		}
+		s.contexts = append(s.contexts, append([]string(nil), tokens[1:]...))
+		s.lastExitCode = 0
+		return true
+	case contextUpBuiltinName:
+		if !s.leaveContext() {
+			s.writeErr("cobra-shell: %s: not in a context\n", contextUpBuiltinName)
+			s.lastExitCode = 1
+			return true
+		}
+		s.lastExitCode = 0
+		return true
+	}
+	return false
+}
+
+// leaveContext pops the innermost context. It reports false when no context
+// is active.
+func (s *Shell) leaveContext() bool {
+	if len(s.contexts) == 0 {
+		return false
+	}
+	s.contexts = s.contexts[:len(s.contexts)-1]
+	return true
+}
+
+// contextPrefix returns the words of all active contexts, outermost first.
+func (s *Shell) contextPrefix() []string {
+	var prefix []string
+	for _, c := range s.contexts {
+		prefix = append(prefix, c...)
+	}
+	return prefix
+}
+
+// withContext returns tokens with the active context prepended. tokens is
+// returned as is when no context is active.
+func (s *Shell) withContext(tokens []string) []string {
+	if len(s.contexts) == 0 {
+		return tokens
+	}
+	return append(s.contextPrefix(), tokens...)
+}
+
+// withContextLine is withContext for a raw input line, as passed to the
+// platform shell for pipelines. Context words are command names and are
+// joined unquoted.
+func (s *Shell) withContextLine(line string) string {
+	if len(s.contexts) == 0 {
+		return line
+	}
+	return strings.Join(s.contextPrefix(), " ") + " " + line
+}
+
+// contextPrompt prefixes prompt with the active context, e.g. "(get) > ".
+func (s *Shell) contextPrompt(prompt string) string {
+	if len(s.contexts) == 0 {
+		return prompt
+	}
+	return fmt.Sprintf("(%s) %s", strings.Join(s.contextPrefix(), " "), prompt)
+}
@@ -0,0 +1,109 @@
+package cobrashell
+
+import (
+	"strings"
+	"testing"
+)
+
+func newContextShell() *Shell {
+	sh := newIntegrationShell()
+	sh.cfg.Prompt = "> "
+	sh.cfg.ContextBuiltin = "enter"
+	return sh
+}
+
+func TestIntegration_Context_PrefixesCommands(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newContextShell()
+	sh.execute("enter echo")
+	if got := sh.prompt(); got != "(echo) > " {
+		t.Errorf("prompt = %q, want %q", got, "(echo) > ")
+	}
+
+	var seen []string
+	sh.cfg.Hooks.BeforeExec = func(args []string) error {
+		seen = args
+		return nil
+	}
+	out := captureStdout(t, func() { sh.execute("pods") })
+	if out != "pods\n" {
+		t.Errorf("output = %q, want %q", out, "pods\n")
+	}
+	if strings.Join(seen, " ") != "echo pods" {
+		t.Errorf("BeforeExec args = %q, want [echo pods]", seen)
+	}
+}
+
+func TestIntegration_Context_Pipeline(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newContextShell()
+	sh.execute("enter echo")
+	out := captureStdout(t, func() { sh.execute("alpha beta | grep beta") })
+	if out != "beta\n" {
+		t.Errorf("output = %q, want %q", out, "beta\n")
+	}
+}
+
+func TestContext_NestAndLeave(t *testing.T) {
+	sh := newContextShell()
+	sh.execute("enter serve")
+	sh.execute("enter start")
+	if got := sh.prompt(); got != "(serve start) > " {
+		t.Errorf("nested prompt = %q", got)
+	}
+	sh.execute("up")
+	if got := sh.prompt(); got != "(serve) > " {
+		t.Errorf("prompt after up = %q", got)
+	}
+	sh.execute("up")
+	if got := sh.prompt(); got != "> " {
+		t.Errorf("prompt after leaving all contexts = %q", got)
+	}
+
+	stderr := captureStderr(t, func() { sh.execute("up") })
+	if !strings.Contains(stderr, "not in a context") || sh.lastExitCode != 1 {
+		t.Errorf("up outside a context: stderr %q, exit %d", stderr, sh.lastExitCode)
+	}
+}
+
+func TestContext_ExitLeavesContext(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newContextShell()
+	out := captureStdout(t, func() {
+		if err := sh.runLines(strings.NewReader("enter echo\nexit\necho after\nexit\necho never\n")); err != nil {
+			t.Errorf("runLines: %v", err)
+		}
+	})
+	if out != "after\n" {
+		t.Errorf("output = %q, want only the command after leaving the context", out)
+	}
+}
+
+func TestIntegration_Context_Completion(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newContextShell()
+	c := &completer{shell: sh}
+
+	line := []rune("enter se")
+	got, _ := c.Do(line, len(line))
+	if len(got) != 1 || string(got[0]) != "rve" {
+		t.Errorf("Do(%q) = %q, want [rve]", string(line), got)
+	}
+
+	sh.execute("enter serve")
+	line = []rune("st")
+	got, _ = c.Do(line, len(line))
+	var suffixes []string
+	for _, g := range got {
+		suffixes = append(suffixes, string(g))
+	}
+	assertSameElements(t, suffixes, []string{"art", "op"})
+}
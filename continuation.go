@@ -0,0 +1,31 @@
+package cobrashell
+
+import "strings"
+
+// continuationPrompt is shown while reading the rest of a command continued
+// with a trailing backslash, like a POSIX shell's PS2.
+const continuationPrompt = "> "
+
+// continues reports whether line ends with a backslash that is not itself
+// escaped, asking for the command to continue on the next line. "\\" at the
+// end is a literal backslash and does not continue.
+func continues(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+// joinContinued completes the command started by line: while it ends with a
+// continuing backslash, next is called for another line, and the two are
+// joined with the backslash and line break removed, as a POSIX shell does.
+// If next fails, the command read so far is returned with its error.
+func joinContinued(line string, next func() (string, error)) (string, error) {
+	for continues(line) {
+		line = line[:len(line)-1]
+		more, err := next()
+		if err != nil {
+			return line, err
+		}
+		line += more
+	}
+	return line, nil
+}
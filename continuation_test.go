@@ -0,0 +1,78 @@
+package cobrashell
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestContinues(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{`greet \`, true},
+		{`greet \\`, false},
+		{`greet \\\`, true},
+		{`greet \ `, false},
+		{`greet`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := continues(tt.line); got != tt.want {
+			t.Errorf("continues(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+// feed returns a next function for joinContinued that yields lines in turn
+// and io.EOF once they run out.
+func feed(lines ...string) func() (string, error) {
+	return func() (string, error) {
+		if len(lines) == 0 {
+			return "", io.EOF
+		}
+		l := lines[0]
+		lines = lines[1:]
+		return l, nil
+	}
+}
+
+func TestJoinContinued(t *testing.T) {
+	tests := []struct {
+		first string
+		rest  []string
+		want  string
+	}{
+		{`greet \`, []string{`--name \`, `bob`}, "greet --name bob"},
+		{`gre\`, []string{`et`}, "greet"},
+		{`echo a\\`, []string{"unused"}, `echo a\\`},
+		{`greet`, nil, "greet"},
+	}
+	for _, tt := range tests {
+		got, err := joinContinued(tt.first, feed(tt.rest...))
+		if err != nil || got != tt.want {
+			t.Errorf("joinContinued(%q, %q) = %q, %v; want %q", tt.first, tt.rest, got, err, tt.want)
+		}
+	}
+
+	got, err := joinContinued(`greet \`, feed())
+	if err != io.EOF || got != "greet " {
+		t.Errorf("joinContinued at EOF = %q, %v; want %q, EOF", got, err, "greet ")
+	}
+}
+
+func TestIntegration_RunLines_Continuation(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	s := newIntegrationShell()
+	out := captureStdout(t, func() {
+		if err := s.runLines(strings.NewReader("echo a \\\n  b\necho c\\\\\n")); err != nil {
+			t.Errorf("runLines: %v", err)
+		}
+	})
+	if want := "a\nb\nc\\\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
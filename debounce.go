@@ -0,0 +1,94 @@
+package cobrashell
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// completionRequests tracks the __completeNoDesc request in flight and the
+// most recent result, so that a new request cancels one it supersedes and a
+// repeated request within CompletionDebounce reuses the last answer.
+type completionRequests struct {
+	mu       sync.Mutex
+	active   *completionRequest
+	canceled int // requests canceled by a newer one
+
+	lastKey string
+	lastAt  time.Time
+	last    completionResult
+}
+
+// completionRequest is one __completeNoDesc request in flight.
+type completionRequest struct {
+	cancel     context.CancelFunc
+	superseded bool // canceled because a newer request started
+}
+
+// completionResult is the parsed answer to a __completeNoDesc request.
+type completionResult struct {
+	candidates []string
+	directive  int
+}
+
+// requestKey identifies a __completeNoDesc request by the binary it runs,
+// its working directory, its environment and its arguments, so that a
+// result is not reused after `use` switches the binary or the session
+// environment or WorkingDir changes.
+func requestKey(binary, dir string, env []envEntry, args []string) string {
+	var b strings.Builder
+	b.WriteString(binary + "\x00" + dir + "\x00")
+	for _, e := range env {
+		b.WriteString(e.Key + "=" + e.Value + "\x00")
+	}
+	b.WriteString("\x01")
+	b.WriteString(strings.Join(args, "\x00"))
+	return b.String()
+}
+
+// begin registers a request whose context is canceled by cancel, canceling
+// the request still in flight, if any.
+func (r *completionRequests) begin(cancel context.CancelFunc) *completionRequest {
+	req := &completionRequest{cancel: cancel}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active != nil {
+		r.active.superseded = true
+		r.active.cancel()
+		r.canceled++
+	}
+	r.active = req
+	return req
+}
+
+// end unregisters req and reports whether a newer request superseded it.
+func (r *completionRequests) end(req *completionRequest) (superseded bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active == req {
+		r.active = nil
+	}
+	return req.superseded
+}
+
+// recent returns the result remembered for key if it was stored less than
+// window ago.
+func (r *completionRequests) recent(key string, window time.Duration) (completionResult, bool) {
+	if window <= 0 {
+		return completionResult{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastKey != key || r.lastAt.IsZero() || time.Since(r.lastAt) >= window {
+		return completionResult{}, false
+	}
+	return r.last, true
+}
+
+// remember stores res as the result for key.
+func (r *completionRequests) remember(key string, res completionResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastKey, r.lastAt, r.last = key, time.Now(), res
+}
@@ -0,0 +1,116 @@
+package cobrashell
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIntegration_TryComplete_NewRequestCancelsInFlight(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CompletionTimeout = 10 * time.Second
+	sh.sessionEnv["TESTBIN_SLEEP"] = "300ms"
+	c := &completer{shell: sh}
+
+	type result struct {
+		directive int
+		ok        bool
+		elapsed   time.Duration
+	}
+	first := make(chan result, 1)
+	go func() {
+		start := time.Now()
+		_, directive, ok := c.tryComplete(nil, "gr")
+		first <- result{directive, ok, time.Since(start)}
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		c.requests.mu.Lock()
+		started := c.requests.active != nil
+		c.requests.mu.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first completion request never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	candidates, _, ok := c.tryComplete(nil, "se")
+	if !ok || len(candidates) != 1 || candidates[0] != "serve" {
+		t.Errorf("second tryComplete = %v, %v; want [serve], true", candidates, ok)
+	}
+	r := <-first
+	if !r.ok || r.directive&compDirectiveError == 0 {
+		t.Errorf("superseded tryComplete = directive %d, ok %v; want the error directive", r.directive, r.ok)
+	}
+	if r.elapsed >= 5*time.Second {
+		t.Errorf("superseded request took %v, want it canceled early", r.elapsed)
+	}
+	if c.requests.canceled != 1 {
+		t.Errorf("canceled requests = %d, want 1", c.requests.canceled)
+	}
+}
+
+func TestIntegration_TryComplete_Debounce(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+	sh := New(Config{BinaryPath: script, HistoryFile: os.DevNull, CompletionDebounce: time.Minute})
+	c := &completer{shell: sh}
+
+	for range 3 {
+		if candidates, _, ok := c.tryComplete(nil, "gr"); !ok || len(candidates) != 1 {
+			t.Fatalf("tryComplete = %v, %v; want [greet], true", candidates, ok)
+		}
+	}
+	if n := countInvocations(t, log); n != 1 {
+		t.Errorf("binary ran %d times for repeated requests, want 1", n)
+	}
+
+	c.tryComplete(nil, "se")
+	if n := countInvocations(t, log); n != 2 {
+		t.Errorf("binary ran %d times after a different request, want 2", n)
+	}
+
+	sh.cfg.CompletionDebounce = 0
+	c.tryComplete(nil, "se")
+	if n := countInvocations(t, log); n != 3 {
+		t.Errorf("binary ran %d times without CompletionDebounce, want 3", n)
+	}
+}
+
+func TestIntegration_TryComplete_DebounceKeyedByContext(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+	sh := New(Config{BinaryPath: script, HistoryFile: os.DevNull, CompletionDebounce: time.Minute})
+	c := &completer{shell: sh}
+
+	c.tryComplete(nil, "gr")
+	sh.cfg.WorkingDir = t.TempDir()
+	c.tryComplete(nil, "gr")
+	if n := countInvocations(t, log); n != 2 {
+		t.Errorf("binary ran %d times after changing WorkingDir, want 2", n)
+	}
+
+	sh.SetEnv("DEBOUNCE_TEST", "1")
+	c.tryComplete(nil, "gr")
+	if n := countInvocations(t, log); n != 3 {
+		t.Errorf("binary ran %d times after changing the session env, want 3", n)
+	}
+
+	other, otherLog := writeLoggingBinary(t, testBinary)
+	sh.switchBinary(other)
+	if candidates, _, ok := c.tryComplete(nil, "gr"); !ok || len(candidates) != 1 {
+		t.Fatalf("tryComplete after switchBinary = %v, %v; want [greet], true", candidates, ok)
+	}
+	if n := countInvocations(t, otherLog); n != 1 {
+		t.Errorf("switched binary ran %d times, want 1", n)
+	}
+}
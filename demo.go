@@ -0,0 +1,56 @@
+package cobrashell
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DemoStep is one command of a [Config.DemoScript].
+type DemoStep struct {
+	// Command is the input line typed and executed for this step.
+	Command string
+
+	// Delay is the pause after each typed character. Zero types the whole
+	// command at once.
+	Delay time.Duration
+}
+
+// promptMarkers strips the readline RL_PROMPT_START/END_IGNORE markers, which
+// are meaningful only to readline, from prompts printed directly.
+var promptMarkers = strings.NewReplacer("\x01", "", "\x02", "")
+
+// runDemo plays Config.DemoScript: for each step it prints the prompt, types
+// the command out character by character, and executes it exactly like an
+// interactive line. It returns after the last step. The banner, OnStart and
+// OnExit are handled as in interactive mode.
+func (s *Shell) runDemo() error {
+	s.printBanner()
+	if s.cfg.Hooks.OnStart != nil {
+		s.cfg.Hooks.OnStart(s)
+	}
+
+	for _, step := range s.cfg.DemoScript {
+		if s.cfg.PrePrompt != "" {
+			fmt.Fprint(s.stdout(), s.cfg.PrePrompt)
+		}
+		fmt.Fprint(s.stdout(), promptMarkers.Replace(s.prompt()))
+		for _, r := range step.Command {
+			fmt.Fprint(s.stdout(), string(r))
+			if step.Delay > 0 {
+				time.Sleep(step.Delay)
+			}
+		}
+		fmt.Fprintln(s.stdout())
+
+		if s.execute(strings.TrimSpace(step.Command)) {
+			break
+		}
+	}
+
+	s.killJobs()
+	if s.cfg.Hooks.OnExit != nil {
+		s.cfg.Hooks.OnExit()
+	}
+	return nil
+}
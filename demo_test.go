@@ -0,0 +1,61 @@
+package cobrashell
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIntegration_RunDemo_ExecutesStepsInOrder(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	var ran [][]string
+	sh := newIntegrationShell()
+	sh.cfg.Prompt = Colorize("demo", ColorGreen) + "> "
+	sh.cfg.Hooks.AfterExec = func(args []string, _ int) { ran = append(ran, args) }
+	sh.cfg.DemoScript = []DemoStep{
+		{Command: "echo one"},
+		{Command: "greet --name demo"},
+		{Command: "echo two"},
+	}
+
+	var err error
+	out := captureStdout(t, func() { err = sh.Run() })
+	if err != nil {
+		t.Fatalf("Run in demo mode: %v", err)
+	}
+
+	want := [][]string{{"echo", "one"}, {"greet", "--name", "demo"}, {"echo", "two"}}
+	if !slices.EqualFunc(ran, want, slices.Equal) {
+		t.Errorf("executed %q, want %q", ran, want)
+	}
+	typed := "\x1b[32mdemo\x1b[0m> echo one\none\n"
+	if !strings.HasPrefix(out, typed) {
+		t.Errorf("demo output = %q, want it to start with %q", out, typed)
+	}
+	if strings.ContainsAny(out, "\x01\x02") {
+		t.Errorf("demo output contains readline prompt markers: %q", out)
+	}
+}
+
+func TestRunDemo_StopsAtExit(t *testing.T) {
+	var ran int
+	sh := &Shell{
+		cfg: Config{
+			Prompt: "> ",
+			Hooks:  Hooks{BeforeExec: func([]string) error { ran++; return errors.New("cancelled") }},
+			DemoScript: []DemoStep{
+				{Command: "version"},
+				{Command: "exit"},
+				{Command: "version"},
+			},
+		},
+		binary: "/usr/bin/true",
+	}
+	captureStderr(t, func() { captureStdout(t, func() { _ = sh.runDemo() }) })
+	if ran != 1 {
+		t.Errorf("commands run = %d, want 1 (steps after exit are skipped)", ran)
+	}
+}
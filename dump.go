@@ -0,0 +1,79 @@
+package cobrashell
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// dumpMaxDepth bounds how many levels of subcommands Shell.DumpCommands
+// explores, since each level costs a __completeNoDesc request per command.
+const dumpMaxDepth = 4
+
+// DumpCommands lists every command and flag name that completion knows
+// about, as dotted paths: "serve" for a subcommand, "serve.--port" for one
+// of its flags and "--verbose" for a root flag. Hidden commands and flags
+// are left out, as is the help flag. Useful for generating documentation or
+// checking a command tree in tests.
+func (s *EmbeddedShell) DumpCommands() []string {
+	var paths []string
+	var walk func(cmd *cobra.Command, prefix string)
+	walk = func(cmd *cobra.Command, prefix string) {
+		cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+			if !f.Hidden && f.Name != "help" {
+				paths = append(paths, prefix+"--"+f.Name)
+			}
+		})
+		for _, child := range cmd.Commands() {
+			if child.Hidden {
+				continue
+			}
+			paths = append(paths, prefix+child.Name())
+			walk(child, prefix+child.Name()+".")
+		}
+	}
+	walk(s.cfg.RootCmd, "")
+	return paths
+}
+
+// DumpCommands lists every command and flag name that the binary's
+// __completeNoDesc offers, in the dotted form of [EmbeddedShell.DumpCommands],
+// by requesting the subcommands ("") and long flags ("--") of each command
+// in turn. Each level of the tree costs one pair of requests per command, so
+// the walk stops four levels deep. Positional values the binary completes
+// alongside subcommands are listed, and explored, like subcommands. The
+// subcommands of "help" are not explored, since they repeat the tree.
+func (s *Shell) DumpCommands() []string {
+	c := &completer{shell: s}
+	var paths []string
+	var walk func(path []string)
+	walk = func(path []string) {
+		prefix := ""
+		if len(path) > 0 {
+			prefix = strings.Join(path, ".") + "."
+		}
+		if flags, _, ok := c.tryComplete(path, "--"); ok {
+			for _, f := range flags {
+				if strings.HasPrefix(f, "--") && f != "--help" {
+					paths = append(paths, prefix+f)
+				}
+			}
+		}
+		names, _, ok := c.tryComplete(path, "")
+		if !ok {
+			return
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, "-") {
+				continue
+			}
+			paths = append(paths, prefix+name)
+			if len(path)+1 < dumpMaxDepth && !(len(path) == 0 && name == "help") {
+				walk(append(path[:len(path):len(path)], name))
+			}
+		}
+	}
+	walk(nil)
+	return paths
+}
@@ -0,0 +1,38 @@
+package cobrashell
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEmbeddedDumpCommands(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newTestRoot()})
+	got := sh.DumpCommands()
+	for _, want := range []string{"--verbose", "serve", "serve.--port", "version"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("DumpCommands() = %v, missing %q", got, want)
+		}
+	}
+	for _, hidden := range []string{"help-me", "serve.--verbose"} {
+		if slices.Contains(got, hidden) {
+			t.Errorf("DumpCommands() = %v, should not contain %q", got, hidden)
+		}
+	}
+}
+
+func TestIntegration_DumpCommands(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	got := newIntegrationShell().DumpCommands()
+	for _, want := range []string{"--version", "greet", "greet.--name", "serve", "serve.start", "completion.bash"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("DumpCommands() = %v, missing %q", got, want)
+		}
+	}
+	for _, unwanted := range []string{"hidden", "--help", "help.greet"} {
+		if slices.Contains(got, unwanted) {
+			t.Errorf("DumpCommands() = %v, should not contain %q", got, unwanted)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -30,15 +31,36 @@ type CompletionFunc func(args []string, toComplete string) []string
 // All fields are optional except RootCmd. Zero values are replaced with
 // sensible defaults by [NewEmbedded].
 type EmbeddedConfig struct {
-	// RootCmd is the Cobra command tree to wrap in-process. Must not be nil.
+	// RootCmd is the Cobra command tree to wrap in-process. Must not be nil
+	// unless RootCmdProvider is set.
 	RootCmd *cobra.Command
 
+	// RootCmdProvider, when non-nil, builds the command tree. It is used for
+	// the initial tree when RootCmd is nil, and enables the "reload" built-in,
+	// which calls it again and swaps in the fresh tree so that commands
+	// registered after startup become available for execution and
+	// completion. If it returns nil on reload, an error is printed and the
+	// current tree is kept.
+	RootCmdProvider func() *cobra.Command
+
 	// Prompt, HistoryFile, and CompletionTimeout behave identically to the
 	// corresponding fields in [Config].
 	Prompt            string
 	HistoryFile       string
 	CompletionTimeout time.Duration
 
+	// Aliases behaves identically to the corresponding field in [Config].
+	Aliases map[string]string
+
+	// AllowedCommands behaves identically to the corresponding field in
+	// [Config]; completion walks only the listed commands. The reload
+	// built-in is not affected.
+	AllowedCommands []string
+
+	// ConfigureReadline behaves identically to the corresponding field in
+	// [Config].
+	ConfigureReadline func(rl *readline.Instance)
+
 	// Hooks contains optional lifecycle callbacks.
 	Hooks EmbeddedHooks
 
@@ -55,6 +77,49 @@ type EmbeddedConfig struct {
 	//
 	// Use [Colorize] with the Color* constants to embed ANSI colors safely.
 	DynamicPrompt func(lastExitCode int) string
+
+	// TypedValueHints, when true, offers unit-suffixed templates when
+	// completing the value of a flag whose type has well-known units. For a
+	// duration flag, typing "--timeout 5" + Tab offers 5ms, 5s, 5m, and 5h.
+	// Defaults to false.
+	TypedValueHints bool
+
+	// ShowDescriptions, when true, lists matching subcommands with their
+	// Short descriptions when Tab has several candidates and nothing more to
+	// insert, in place of readline's plain candidate grid. Subcommands added
+	// under a cobra command group are listed under the group's title, as in
+	// cobra's help output. Defaults to false.
+	ShowDescriptions bool
+
+	// HighlightRequiredFlags, when true, lists flags marked required with
+	// cobra.MarkFlagRequired before the optional ones when completing flag
+	// names, and with ShowDescriptions tags their description "(required)".
+	// Defaults to false.
+	HighlightRequiredFlags bool
+
+	// ShowFlagShorthands, when true, shows a flag's shorthand next to its
+	// long name in the ShowDescriptions menu, e.g. "--port (-p)". Only the
+	// long name is inserted. Defaults to false.
+	ShowFlagShorthands bool
+
+	// Stdin, Stdout, and Stderr, when non-nil, are the streams commands are
+	// given through cobra's SetIn, SetOut, and SetErr, in place of os.Stdin,
+	// os.Stdout, and os.Stderr, e.g. to capture a command's output in a
+	// buffer or to host the shell without a terminal. They reach only
+	// commands that use cmd.InOrStdin, cmd.OutOrStdout, and cmd.ErrOrStderr
+	// (cobra's own help and error output does). Stderr also receives the
+	// shell's own error messages; the prompt and line editing are
+	// unaffected.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// StickyFlags lists flag names whose values persist across commands
+	// instead of being reset to their defaults before each one, e.g.
+	// "namespace": after "serve --namespace prod", a later "serve" still
+	// sees prod until the flag is given again. A name applies to the flag of
+	// that name on every command. Defaults to none (every flag is reset).
+	StickyFlags []string
 }
 
 // EmbeddedHooks contains optional lifecycle callbacks for an [EmbeddedShell].
@@ -65,8 +130,9 @@ type EmbeddedConfig struct {
 // interchangeable.
 type EmbeddedHooks struct {
 	// BeforeExec is called before each command is executed. Return a non-nil
-	// error to cancel execution; the message is printed to stderr and the
-	// shell continues. Return nil to allow execution to proceed.
+	// error to cancel execution; the message is printed to stderr, one line
+	// per reason for a [ValidationError], and the shell continues. Return
+	// nil to allow execution to proceed.
 	BeforeExec func(args []string) error
 
 	// AfterExec is called after each command completes with its exit code.
@@ -94,15 +160,20 @@ type EmbeddedShell struct {
 	cfg          EmbeddedConfig
 	initErr      error
 	lastExitCode int
+	shownPrompt  string // most recently rendered prompt; see Prompt
 }
 
-// NewEmbedded creates an EmbeddedShell from cfg. If cfg.RootCmd is nil the
-// error is stored and returned by [EmbeddedShell.Run]. All zero-value fields
+// NewEmbedded creates an EmbeddedShell from cfg. cfg.RootCmdProvider supplies
+// the tree when cfg.RootCmd is nil; if there is still no tree the error is
+// stored and returned by [EmbeddedShell.Run]. All zero-value fields
 // are replaced with defaults before Run is called.
 //
 // NewEmbedded never returns nil.
 func NewEmbedded(cfg EmbeddedConfig) *EmbeddedShell {
 	s := &EmbeddedShell{}
+	if cfg.RootCmd == nil && cfg.RootCmdProvider != nil {
+		cfg.RootCmd = cfg.RootCmdProvider()
+	}
 	if cfg.RootCmd == nil {
 		s.initErr = errors.New("cobra-shell: EmbeddedConfig.RootCmd must not be nil")
 		s.cfg = cfg
@@ -137,23 +208,53 @@ func (s *EmbeddedShell) Run() error {
 	if s.initErr != nil {
 		return s.initErr
 	}
+	return s.run(nil)
+}
 
-	initialPrompt := s.cfg.Prompt
+// Prompt returns the prompt currently in effect: the one most recently
+// rendered for an input line, after DynamicPrompt has been applied. Before
+// Run renders one it is the static Prompt.
+func (s *EmbeddedShell) Prompt() string {
+	if s.shownPrompt == "" {
+		return s.cfg.Prompt
+	}
+	return s.shownPrompt
+}
+
+// prompt renders the prompt for the next input line, the result of
+// DynamicPrompt when set or the static Prompt, and records it for Prompt.
+func (s *EmbeddedShell) prompt() string {
+	s.shownPrompt = s.cfg.Prompt
 	if s.cfg.DynamicPrompt != nil {
-		initialPrompt = s.cfg.DynamicPrompt(0)
+		s.shownPrompt = s.cfg.DynamicPrompt(s.lastExitCode)
 	}
+	return s.shownPrompt
+}
 
+// run is the readline loop behind Run. stdin, when non-nil, replaces
+// os.Stdin as readline's input, as for Shell.runInteractive.
+func (s *EmbeddedShell) run(stdin io.ReadCloser) error {
+	initialPrompt := s.prompt()
+
+	s.cfg.HistoryFile = prepareHistoryFile(s.stderr(), s.cfg.HistoryFile)
+	comp := &embeddedCompleter{shell: s}
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          initialPrompt,
 		HistoryFile:     s.cfg.HistoryFile,
-		AutoComplete:    &embeddedCompleter{shell: s},
+		AutoComplete:    comp,
 		InterruptPrompt: "",
 		EOFPrompt:       "exit",
+		Stdin:           stdin,
 	})
 	if err != nil {
 		return fmt.Errorf("cobra-shell: initialise readline: %w", err)
 	}
 	defer rl.Close()
+	// rl.Stdout redraws the prompt and typed line after the menu is printed.
+	comp.menu = rl.Stdout()
+	if s.cfg.ConfigureReadline != nil {
+		s.cfg.ConfigureReadline(rl)
+	}
 
 	if s.cfg.Hooks.OnStart != nil {
 		s.cfg.Hooks.OnStart(s)
@@ -181,7 +282,7 @@ func (s *EmbeddedShell) Run() error {
 
 		s.execute(line)
 		if s.cfg.DynamicPrompt != nil {
-			rl.SetPrompt(s.cfg.DynamicPrompt(s.lastExitCode))
+			rl.SetPrompt(s.prompt())
 		}
 	}
 
@@ -191,51 +292,114 @@ func (s *EmbeddedShell) Run() error {
 	return nil
 }
 
-// execute tokenises line, runs BeforeExec, resets the command tree flags,
-// calls cobra.Command.Execute, and runs AfterExec.
+// execute expands aliases, tokenises line, runs BeforeExec, resets the
+// command tree flags, calls cobra.Command.Execute, and runs AfterExec.
 func (s *EmbeddedShell) execute(line string) {
+	line = expandAliasLine(s.cfg.Aliases, line)
 	tokens, err := shlex.Split(line)
 	if err != nil {
-		writeErr("cobra-shell: parse error: %v\n", err)
+		writeErrTo(s.stderr(), "cobra-shell: parse error: %v\n", err)
 		return
 	}
 	if len(tokens) == 0 {
 		return
 	}
+	tokens = expandTilde(tokens)
+
+	if s.handleReloadBuiltin(tokens) {
+		return
+	}
+	if notPermitted(s.stderr(), s.cfg.AllowedCommands, tokens) {
+		s.lastExitCode = 1
+		return
+	}
 
 	if s.cfg.Hooks.BeforeExec != nil {
 		if err := s.cfg.Hooks.BeforeExec(tokens); err != nil {
-			writeErr("%v\n", err)
+			reportHookError(s.stderr(), err)
 			return
 		}
 	}
 
 	// Reset all flag values to their defaults before each execution so that
 	// flags set by a previous command do not bleed into the current one.
-	resetCommandTree(s.cfg.RootCmd)
+	resetCommandTree(s.cfg.RootCmd, s.cfg.StickyFlags)
 
 	s.cfg.RootCmd.SetArgs(tokens)
-	s.cfg.RootCmd.SetOut(os.Stdout)
-	s.cfg.RootCmd.SetErr(os.Stderr)
-	s.cfg.RootCmd.SetIn(os.Stdin)
+	var stdin io.Reader = os.Stdin
+	var stdout io.Writer = os.Stdout
+	if s.cfg.Stdin != nil {
+		stdin = s.cfg.Stdin
+	}
+	if s.cfg.Stdout != nil {
+		stdout = s.cfg.Stdout
+	}
+	s.cfg.RootCmd.SetOut(stdout)
+	s.cfg.RootCmd.SetErr(s.stderr())
+	s.cfg.RootCmd.SetIn(stdin)
 
 	s.lastExitCode = 0
 	if err := s.cfg.RootCmd.Execute(); err != nil {
 		s.lastExitCode = 1
 	}
+	if isRootHelp(tokens) {
+		s.printBuiltinsHelp(stdout)
+	}
 
 	if s.cfg.Hooks.AfterExec != nil {
 		s.cfg.Hooks.AfterExec(tokens, s.lastExitCode)
 	}
 }
 
+// stderr returns EmbeddedConfig.Stderr, or os.Stderr when it is nil.
+func (s *EmbeddedShell) stderr() io.Writer {
+	if s.cfg.Stderr != nil {
+		return s.cfg.Stderr
+	}
+	return os.Stderr
+}
+
+// reloadBuiltinName is the command name of the reload built-in.
+const reloadBuiltinName = "reload"
+
+// handleReloadBuiltin checks whether tokens is the reload built-in, which is
+// enabled by EmbeddedConfig.RootCmdProvider. If so, it rebuilds the command
+// tree and returns true. Like the subprocess-mode built-ins, it does not
+// trigger BeforeExec/AfterExec hooks.
+func (s *EmbeddedShell) handleReloadBuiltin(tokens []string) bool {
+	if s.cfg.RootCmdProvider == nil || len(tokens) != 1 || tokens[0] != reloadBuiltinName {
+		return false
+	}
+	root := s.cfg.RootCmdProvider()
+	if root == nil {
+		writeErrTo(s.stderr(), "cobra-shell: reload: RootCmdProvider returned nil; keeping the current command tree\n")
+		s.lastExitCode = 1
+		return true
+	}
+	s.cfg.RootCmd = root
+	s.lastExitCode = 0
+	return true
+}
+
+// printBuiltinsHelp appends the "Shell built-ins" section to the root help
+// output written to w. It lists reload when RootCmdProvider is set and
+// prints nothing otherwise.
+func (s *EmbeddedShell) printBuiltinsHelp(w io.Writer) {
+	if s.cfg.RootCmdProvider == nil {
+		return
+	}
+	fmt.Fprintf(w, "\nShell built-ins:\n")
+	fmt.Fprintf(w, "  %-12s %s\n", reloadBuiltinName, "Rebuild the command tree from RootCmdProvider")
+}
+
 // resetCommandTree resets every flag in cmd and its descendants to its default
 // value and clears the Changed marker. This must be called before each
 // Execute() to prevent flag state from one shell command bleeding into the
-// next.
-func resetCommandTree(cmd *cobra.Command) {
+// next. Flags named in sticky (EmbeddedConfig.StickyFlags) are left as they
+// are.
+func resetCommandTree(cmd *cobra.Command, sticky []string) {
 	reset := func(f *pflag.Flag) {
-		if f.Changed {
+		if f.Changed && !slices.Contains(sticky, f.Name) {
 			_ = f.Value.Set(f.DefValue)
 			f.Changed = false
 		}
@@ -243,6 +407,6 @@ func resetCommandTree(cmd *cobra.Command) {
 	cmd.Flags().VisitAll(reset)
 	cmd.PersistentFlags().VisitAll(reset)
 	for _, child := range cmd.Commands() {
-		resetCommandTree(child)
+		resetCommandTree(child, sticky)
 	}
 }
@@ -1,9 +1,13 @@
 package cobrashell
 
 import (
+	"io"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/google/shlex"
+	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
@@ -13,10 +17,21 @@ import (
 // EmbeddedConfig.DynamicCompletions. No subprocess is spawned.
 type embeddedCompleter struct {
 	shell *EmbeddedShell
+	menu  io.Writer // destination of the ShowDescriptions menu; nil disables it
 }
 
-// Do implements readline.AutoCompleter.
+// Do implements readline.AutoCompleter. As in completer.Do, a cursor inside a
+// word completes the text before it, fitted to the rest of the word.
 func (c *embeddedCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	newLine, length = c.do(line, pos)
+	if newLine = fitWordTail(newLine, wordTail(line, pos)); newLine == nil {
+		return nil, 0
+	}
+	return newLine, length
+}
+
+// do computes the completions of line[:pos] for Do.
+func (c *embeddedCompleter) do(line []rune, pos int) (newLine [][]rune, length int) {
 	segment := string(line[:pos])
 
 	endsWithSpace := len(segment) > 0 &&
@@ -39,11 +54,24 @@ func (c *embeddedCompleter) Do(line []rune, pos int) (newLine [][]rune, length i
 		toComplete = tokens[len(tokens)-1]
 	}
 
-	candidates := c.complete(contextArgs, toComplete)
+	// See completer.Do: only contextArgs is alias-expanded.
+	contextArgs = expandAlias(c.shell.cfg.Aliases, contextArgs, shlex.Split)
+
+	candidates := filterAllowed(c.shell.cfg.AllowedCommands, contextArgs, c.complete(contextArgs, toComplete))
 	if len(candidates) == 0 {
 		return nil, 0
 	}
 
+	// With descriptions enabled, a Tab that readline would answer with its
+	// plain candidate grid (several candidates, nothing more to insert)
+	// prints the descriptive menu instead and leaves the line as typed.
+	if c.shell.cfg.ShowDescriptions && c.menu != nil && len(candidates) > 1 &&
+		len(commonPrefix(candidates)) == len(toComplete) {
+		// readline, and so the menu, writes to os.Stdout in embedded mode.
+		renderCompletionMenu(c.menu, c.describe(contextArgs, candidates), terminalWidth(os.Stdout))
+		return nil, 0
+	}
+
 	prefix := []rune(toComplete)
 	result := make([][]rune, len(candidates))
 	for i, s := range candidates {
@@ -55,12 +83,20 @@ func (c *embeddedCompleter) Do(line []rune, pos int) (newLine [][]rune, length i
 // complete resolves the command addressed by contextArgs, then collects
 // candidates from three sources in order:
 //
-//  1. Subcommand names of the matched command (when toComplete is not a flag).
+//  1. Subcommand names of the matched command (when toComplete is not a flag
+//     and no "--" precedes it).
 //  2. EmbeddedConfig.DynamicCompletions for the matched command name.
 //  3. The command's own cobra ValidArgsFunction (if registered).
 //
+// Each source's candidates are sorted, and a candidate offered by more than
+// one source is kept only where it first appears.
+//
 // Flag names (--flag) are offered when toComplete starts with "-", or when
-// no positional candidates were found and toComplete is empty.
+// no positional candidates were found and toComplete is empty, but never
+// after a standalone "--", which makes every later argument positional. Flags
+// already given in contextArgs are not offered again unless they can be
+// repeated (see isRepeatableFlag). Boolean flags are also offered in their
+// negated "--no-name" form, once toComplete starts with "--no-".
 func (c *embeddedCompleter) complete(contextArgs []string, toComplete string) []string {
 	root := c.shell.cfg.RootCmd
 
@@ -72,59 +108,445 @@ func (c *embeddedCompleter) complete(contextArgs []string, toComplete string) []
 		remaining = contextArgs
 	}
 
+	// "help <path>" completes the subcommands of the command addressed by
+	// path, mirroring cobra's own help command. Handled here because the
+	// default help command is only added to the tree by the first Execute.
+	if len(contextArgs) > 0 && contextArgs[0] == "help" {
+		target, _, err := root.Find(contextArgs[1:])
+		if err != nil || target == nil {
+			return nil
+		}
+		return subcommandCandidates(target, toComplete)
+	}
+
+	// After a standalone "--" every argument is positional: no flags, flag
+	// values, or subcommands, only the command's own argument completions,
+	// which receive the positional args without the "--".
+	afterDash := slices.Contains(remaining, "--")
+	if afterDash {
+		remaining = slices.DeleteFunc(slices.Clone(remaining), func(a string) bool { return a == "--" })
+	}
+
+	// The previous token is a flag that takes a value: complete the value
+	// rather than subcommands or flag names.
+	if f := flagAwaitingValue(cmd, contextArgs); f != nil && !afterDash {
+		return c.completeFlagValue(cmd, f, toComplete)
+	}
+
+	// "--flag=partial" (or "-abc=partial" for the last shorthand of a
+	// cluster): complete the value, keeping "--flag=" in each candidate so
+	// that it still extends toComplete.
+	if name, value, ok := strings.Cut(toComplete, "="); ok && strings.HasPrefix(name, "-") && !afterDash {
+		f := lookupFlagToken(cmd, name)
+		if f == nil {
+			return nil
+		}
+		var candidates []string
+		for _, v := range c.completeFlagValue(cmd, f, value) {
+			candidates = append(candidates, name+"="+v)
+		}
+		return candidates
+	}
+
 	var candidates []string
-	wantsFlag := strings.HasPrefix(toComplete, "-")
+	wantsFlag := strings.HasPrefix(toComplete, "-") && !isNegativeNumber(cmd, toComplete) && !afterDash
 
 	if !wantsFlag {
 		// 1. Subcommand names.
-		for _, child := range cmd.Commands() {
-			if child.Hidden {
-				continue
-			}
-			if strings.HasPrefix(child.Name(), toComplete) {
-				candidates = append(candidates, child.Name())
-			}
+		if !afterDash {
+			candidates = append(candidates, sorted(subcommandCandidates(cmd, toComplete))...)
 		}
 
 		// 2. DynamicCompletions registered for this command.
 		if dc, ok := c.shell.cfg.DynamicCompletions[cmd.Name()]; ok {
-			candidates = append(candidates, dc(remaining, toComplete)...)
+			candidates = append(candidates, sorted(dc(remaining, toComplete))...)
 		}
 
 		// 3. cobra's native ValidArgsFunction. cobra's own shell completion
 		// applies prefix filtering after calling ValidArgsFunction, so we do
-		// the same here for consistency.
+		// the same here for consistency. Of the directive only the error bit
+		// needs handling: readline inserts a candidate verbatim, never
+		// followed by a space, so ShellCompDirectiveNoSpace is always in
+		// effect, and embedded mode has no file completion for
+		// ShellCompDirectiveNoFileComp to suppress.
 		if cmd.ValidArgsFunction != nil {
 			completions, directive := cmd.ValidArgsFunction(cmd, remaining, toComplete)
 			if directive&compDirectiveError == 0 {
+				var matched []string
 				for _, s := range completions {
 					if strings.HasPrefix(s, toComplete) {
-						candidates = append(candidates, s)
+						matched = append(matched, s)
 					}
 				}
+				candidates = append(candidates, sorted(matched)...)
 			}
 		}
+		candidates = dedupe(candidates)
 	}
 
 	// Offer flag names when explicitly requested ("-" prefix) or when there
 	// are no positional candidates and the partial word is empty (the user
-	// tabbed after a space with no leading "-").
-	if wantsFlag || (toComplete == "" && len(candidates) == 0) {
+	// tabbed after a space with no leading "-"). Shorthands ("-p") are
+	// offered only for a lone "-"; longer prefixes select long names.
+	// A cluster of shorthands such as "-vx" is extended with the remaining
+	// shorthands rather than matched against flag names.
+	if wantsFlag && isShorthandCluster(cmd, toComplete) {
+		return clusterCandidates(cmd, toComplete)
+	}
+
+	if wantsFlag || (toComplete == "" && len(candidates) == 0 && !afterDash) {
+		// seen guards against a flag reachable through both Flags() and
+		// InheritedFlags(), e.g. a persistent flag redefined locally.
 		seen := make(map[string]bool)
-		addFlag := func(f *pflag.Flag) {
-			if f.Hidden {
-				return
-			}
-			name := "--" + f.Name
+		add := func(name string) {
 			if !seen[name] && strings.HasPrefix(name, toComplete) {
 				candidates = append(candidates, name)
 				seen[name] = true
 			}
 		}
+		used := usedFlags(cmd, contextArgs)
+		addFlag := func(f *pflag.Flag) {
+			if f.Hidden || (used[f] && !isRepeatableFlag(f)) {
+				return
+			}
+			if toComplete == "-" && f.Shorthand != "" {
+				add("-" + f.Shorthand)
+			}
+			add("--" + f.Name)
+			if f.Value.Type() == "bool" && strings.HasPrefix(toComplete, "--no-") {
+				add("--no-" + f.Name)
+			}
+		}
+		n := len(candidates)
 		cmd.Flags().VisitAll(addFlag)
+		cmd.PersistentFlags().VisitAll(addFlag) // not merged into Flags() yet; see lookupFlag
 		// InheritedFlags returns persistent flags from all ancestor commands.
 		cmd.InheritedFlags().VisitAll(addFlag)
+		if c.shell.cfg.HighlightRequiredFlags {
+			// Stable, so flags keep their order within each partition.
+			slices.SortStableFunc(candidates[n:], func(a, b string) int {
+				return compareBool(isRequiredFlag(lookupCandidateFlag(cmd, b)), isRequiredFlag(lookupCandidateFlag(cmd, a)))
+			})
+		}
+	}
+
+	return candidates
+}
+
+// usedFlags returns the flags of cmd named in args, whether as "--name",
+// "--name=value", "-s", or part of a shorthand cluster such as "-vp80",
+// where the first shorthand taking a value ends the cluster. Values
+// following a flag are not inspected, so a value that looks like a flag
+// counts as one.
+func usedFlags(cmd *cobra.Command, args []string) map[*pflag.Flag]bool {
+	used := make(map[*pflag.Flag]bool)
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name, _, _ := strings.Cut(arg[2:], "=")
+			if f := lookupFlag(cmd, name); f != nil {
+				used[f] = true
+			}
+		case len(arg) > 1 && arg[0] == '-':
+			for i := 1; i < len(arg) && arg[i] != '='; i++ {
+				f := lookupShorthand(cmd, arg[i:i+1])
+				if f == nil {
+					break
+				}
+				used[f] = true
+				if f.NoOptDefVal == "" {
+					break
+				}
+			}
+		}
+	}
+	return used
+}
+
+// isRepeatableFlag reports whether f accumulates values when given more
+// than once — slice, array, map, and count flags — so that it is still
+// worth offering after it has been used.
+func isRepeatableFlag(f *pflag.Flag) bool {
+	t := f.Value.Type()
+	return t == "count" || strings.HasSuffix(t, "Slice") || strings.HasSuffix(t, "Array") ||
+		strings.HasPrefix(t, "stringTo")
+}
+
+// isNegativeNumber reports whether word is a negative number such as "-5" or
+// "-0.25" rather than the start of a flag, so that it is completed as a
+// positional argument. A word that is also a shorthand flag of cmd (e.g. a
+// "-1" flag) stays a flag.
+func isNegativeNumber(cmd *cobra.Command, word string) bool {
+	if len(word) < 2 || word[0] != '-' || word[1] < '0' || word[1] > '9' {
+		return false
+	}
+	dots := 0
+	for _, r := range word[2:] {
+		switch {
+		case r == '.':
+			dots++
+		case r < '0' || r > '9':
+			return false
+		}
+	}
+	if dots > 1 {
+		return false
+	}
+	return len(word) > 2 || lookupShorthand(cmd, word[1:]) == nil
+}
+
+// sorted returns a sorted copy of candidates, leaving the caller's slice (for
+// instance one returned by a DynamicCompletions function) untouched.
+func sorted(candidates []string) []string {
+	out := slices.Clone(candidates)
+	slices.Sort(out)
+	return out
+}
+
+// subcommandCandidates returns the names of cmd's visible subcommands that
+// start with toComplete.
+func subcommandCandidates(cmd *cobra.Command, toComplete string) []string {
+	var candidates []string
+	for _, it := range subcommandItems(cmd, toComplete) {
+		candidates = append(candidates, it.Value)
+	}
+	return candidates
+}
+
+// describe pairs each candidate with its description and group for the
+// ShowDescriptions menu. Candidates that are subcommands of the command
+// addressed by contextArgs are described from the command tree; the rest
+// (flags, dynamic and ValidArgsFunction values) are listed bare.
+func (c *embeddedCompleter) describe(contextArgs []string, candidates []string) []completionItem {
+	root := c.shell.cfg.RootCmd
+	var cmd *cobra.Command
+	if len(contextArgs) > 0 && contextArgs[0] == "help" {
+		cmd, _, _ = root.Find(contextArgs[1:])
+	} else {
+		cmd, _, _ = root.Traverse(contextArgs)
+	}
+	if cmd == nil {
+		cmd = root
+	}
+
+	known := make(map[string]completionItem)
+	for _, it := range subcommandItems(cmd, "") {
+		known[it.Value] = it
+	}
+	items := make([]completionItem, len(candidates))
+	for i, cand := range candidates {
+		if it, ok := known[cand]; ok {
+			items[i] = it
+		} else if f := lookupCandidateFlag(cmd, cand); f != nil {
+			items[i] = completionItem{Value: cand, Description: stripANSI(f.Usage)}
+			if c.shell.cfg.ShowFlagShorthands && f.Shorthand != "" && strings.HasPrefix(cand, "--") {
+				items[i].Display = cand + " (-" + f.Shorthand + ")"
+			}
+			if c.shell.cfg.HighlightRequiredFlags && isRequiredFlag(f) {
+				items[i].Description += " (required)"
+			}
+		} else {
+			items[i] = completionItem{Value: cand}
+		}
+	}
+	return items
+}
+
+// lookupCandidateFlag returns the flag of cmd named by a flag candidate such
+// as "--port" or "-p", or nil when cand is not one.
+func lookupCandidateFlag(cmd *cobra.Command, cand string) *pflag.Flag {
+	switch {
+	case strings.HasPrefix(cand, "--"):
+		return lookupFlag(cmd, cand[2:])
+	case len(cand) == 2 && cand[0] == '-':
+		return lookupShorthand(cmd, cand[1:])
+	}
+	return nil
+}
+
+// isRequiredFlag reports whether f was marked required with
+// cobra.MarkFlagRequired, which sets the BashCompOneRequiredFlag annotation.
+func isRequiredFlag(f *pflag.Flag) bool {
+	return f != nil && slices.Equal(f.Annotations[cobra.BashCompOneRequiredFlag], []string{"true"})
+}
+
+// compareBool orders false before true, for use with slices.SortFunc.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// commonPrefix returns the longest prefix shared by all of words.
+func commonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// durationUnits are the unit suffixes offered by TypedValueHints for
+// duration flags, in ascending order.
+var durationUnits = []string{"ms", "s", "m", "h"}
+
+// completeFlagValue returns candidates for the value of flag f of cmd: the
+// values from the completion function registered with
+// cobra.Command.RegisterFlagCompletionFunc, filtered by toComplete, followed
+// by unit templates when TypedValueHints is set.
+func (c *embeddedCompleter) completeFlagValue(cmd *cobra.Command, f *pflag.Flag, toComplete string) []string {
+	var candidates []string
+	if fn, ok := cmd.GetFlagCompletionFunc(f.Name); ok {
+		values, directive := fn(cmd, nil, toComplete)
+		if directive&compDirectiveError == 0 {
+			for _, v := range values {
+				if strings.HasPrefix(v, toComplete) {
+					candidates = append(candidates, v)
+				}
+			}
+		}
+	}
+	if c.shell.cfg.TypedValueHints {
+		switch f.Value.Type() {
+		case "duration":
+			candidates = append(candidates, unitHints(toComplete, durationUnits)...)
+		}
+	}
+	return candidates
+}
+
+// unitHints returns the leading number of toComplete combined with each of
+// units, filtered by toComplete. It returns nil when toComplete does not
+// start with a number.
+func unitHints(toComplete string, units []string) []string {
+	n := 0
+	for n < len(toComplete) && (toComplete[n] >= '0' && toComplete[n] <= '9' || toComplete[n] == '.') {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	var candidates []string
+	for _, u := range units {
+		if cand := toComplete[:n] + u; strings.HasPrefix(cand, toComplete) {
+			candidates = append(candidates, cand)
+		}
+	}
+	return candidates
+}
+
+// flagAwaitingValue returns the flag whose value is being completed, or nil.
+// That is the case when the last context arg names a flag of cmd (local or
+// inherited) that requires a value and was given without "=value", e.g.
+// "--timeout", "-t", or a shorthand cluster ending in it such as "-vt".
+// Boolean flags never await a value.
+func flagAwaitingValue(cmd *cobra.Command, contextArgs []string) *pflag.Flag {
+	if len(contextArgs) == 0 {
+		return nil
+	}
+	last := contextArgs[len(contextArgs)-1]
+
+	var f *pflag.Flag
+	switch {
+	case strings.HasPrefix(last, "--"):
+		if strings.Contains(last, "=") {
+			return nil
+		}
+		f = lookupFlag(cmd, last[2:])
+	case len(last) == 2 && last[0] == '-':
+		f = lookupShorthand(cmd, last[1:])
+	case isShorthandCluster(cmd, last):
+		// The value belongs to the last flag of the cluster, as in cobra.
+		f = lookupShorthand(cmd, last[len(last)-1:])
+	}
+	if f == nil || f.NoOptDefVal != "" {
+		return nil
+	}
+	return f
+}
+
+// lookupFlagToken finds the flag named by the part of a "name=value" word
+// before "=": "--name", "-s", or a cluster "-abs" whose last shorthand names
+// the flag.
+func lookupFlagToken(cmd *cobra.Command, name string) *pflag.Flag {
+	if strings.HasPrefix(name, "--") {
+		return lookupFlag(cmd, name[2:])
+	}
+	if len(name) < 2 {
+		return nil
+	}
+	return lookupShorthand(cmd, name[len(name)-1:])
+}
+
+// isShorthandCluster reports whether word is two or more shorthands of cmd
+// written together, e.g. "-vx", where every shorthand but the last is a
+// boolean flag (the last may take a value).
+func isShorthandCluster(cmd *cobra.Command, word string) bool {
+	if len(word) < 3 || word[0] != '-' || word[1] == '-' {
+		return false
+	}
+	for i := 1; i < len(word); i++ {
+		f := lookupShorthand(cmd, word[i:i+1])
+		if f == nil || (i < len(word)-1 && f.NoOptDefVal == "") {
+			return false
+		}
 	}
+	return true
+}
 
+// clusterCandidates extends the shorthand cluster word with each visible
+// shorthand of cmd it does not contain yet. Nothing can follow a flag that
+// takes a value, so a cluster ending in one is offered as is.
+func clusterCandidates(cmd *cobra.Command, word string) []string {
+	if lookupShorthand(cmd, word[len(word)-1:]).NoOptDefVal == "" {
+		return []string{word}
+	}
+	var candidates []string
+	addFlag := func(f *pflag.Flag) {
+		if f.Hidden || f.Shorthand == "" || strings.Contains(word[1:], f.Shorthand) {
+			return
+		}
+		if cand := word + f.Shorthand; !slices.Contains(candidates, cand) {
+			candidates = append(candidates, cand)
+		}
+	}
+	cmd.Flags().VisitAll(addFlag)
+	cmd.PersistentFlags().VisitAll(addFlag)
+	cmd.InheritedFlags().VisitAll(addFlag)
 	return candidates
 }
+
+// lookupFlag finds the flag called name among cmd's local, persistent, and
+// inherited flags. Persistent flags are checked explicitly because cobra
+// only merges them into Flags() lazily, so a root command's own persistent
+// flags may not be there yet.
+func lookupFlag(cmd *cobra.Command, name string) *pflag.Flag {
+	if f := cmd.Flags().Lookup(name); f != nil {
+		return f
+	}
+	if f := cmd.PersistentFlags().Lookup(name); f != nil {
+		return f
+	}
+	return cmd.InheritedFlags().Lookup(name)
+}
+
+// lookupShorthand finds the flag with the one-letter shorthand among cmd's
+// local, persistent, and inherited flags (see lookupFlag).
+func lookupShorthand(cmd *cobra.Command, shorthand string) *pflag.Flag {
+	if f := cmd.Flags().ShorthandLookup(shorthand); f != nil {
+		return f
+	}
+	if f := cmd.PersistentFlags().ShorthandLookup(shorthand); f != nil {
+		return f
+	}
+	return cmd.InheritedFlags().ShorthandLookup(shorthand)
+}
@@ -1,8 +1,16 @@
 package cobrashell
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/chzyer/readline"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +38,68 @@ func TestNewEmbedded_Defaults(t *testing.T) {
 	}
 }
 
+func TestEmbeddedShell_ExecuteUsesConfiguredStreams(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	root.AddCommand(&cobra.Command{
+		Use: "upper",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(cmd.OutOrStdout(), strings.ToUpper(string(in)))
+			fmt.Fprint(cmd.ErrOrStderr(), "done")
+			return nil
+		},
+	})
+	var stdout, stderr bytes.Buffer
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd: root,
+		Stdin:   strings.NewReader("hello\n"),
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+
+	out := captureStdout(t, func() { sh.execute("upper") })
+	if got := stdout.String(); got != "HELLO\n" {
+		t.Errorf("Stdout = %q, want %q", got, "HELLO\n")
+	}
+	if got := stderr.String(); got != "done" {
+		t.Errorf("Stderr = %q, want %q", got, "done")
+	}
+	if out != "" {
+		t.Errorf("os.Stdout got %q, want nothing", out)
+	}
+}
+
+func TestEmbeddedShell_ShellErrorsToConfiguredStderr(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  EmbeddedConfig
+		line string
+		want string
+	}{
+		{"parse error", EmbeddedConfig{}, `serve "unterminated`, "parse error"},
+		{"not permitted", EmbeddedConfig{AllowedCommands: []string{"version"}}, "serve", "not permitted"},
+		{"BeforeExec", EmbeddedConfig{Hooks: EmbeddedHooks{
+			BeforeExec: func([]string) error { return errors.New("blocked") },
+		}}, "serve", "blocked"},
+	}
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+		tt.cfg.RootCmd = newTestRoot()
+		tt.cfg.Stderr = &stderr
+		sh := NewEmbedded(tt.cfg)
+		osStderr := captureStderr(t, func() { sh.execute(tt.line) })
+		if !strings.Contains(stderr.String(), tt.want) {
+			t.Errorf("%s: Stderr = %q, want it to contain %q", tt.name, stderr.String(), tt.want)
+		}
+		if osStderr != "" {
+			t.Errorf("%s: os.Stderr = %q, want nothing", tt.name, osStderr)
+		}
+	}
+}
+
 // --- resetCommandTree ---
 
 func TestResetCommandTree_ResetsChangedFlag(t *testing.T) {
@@ -45,7 +115,7 @@ func TestResetCommandTree_ResetsChangedFlag(t *testing.T) {
 		t.Fatalf("expected port 9090 after Set, got %d", port)
 	}
 
-	resetCommandTree(cmd)
+	resetCommandTree(cmd, nil)
 
 	if port != 8080 {
 		t.Fatalf("expected port 8080 after reset, got %d", port)
@@ -68,7 +138,7 @@ func TestResetCommandTree_Recursive(t *testing.T) {
 		t.Fatalf("expected 'custom' after Set, got %q", childVal)
 	}
 
-	resetCommandTree(root)
+	resetCommandTree(root, nil)
 
 	if childVal != "default" {
 		t.Fatalf("expected 'default' after reset, got %q", childVal)
@@ -85,13 +155,37 @@ func TestResetCommandTree_PersistentFlags(t *testing.T) {
 		t.Fatal("expected verbose true after Set")
 	}
 
-	resetCommandTree(root)
+	resetCommandTree(root, nil)
 
 	if verbose {
 		t.Fatal("expected verbose false after reset")
 	}
 }
 
+func TestEmbeddedShell_StickyFlags(t *testing.T) {
+	var port, workers []int
+	root := &cobra.Command{Use: "myapp"}
+	serve := &cobra.Command{Use: "serve", Run: func(cmd *cobra.Command, _ []string) {
+		p, _ := cmd.Flags().GetInt("port")
+		w, _ := cmd.Flags().GetInt("workers")
+		port, workers = append(port, p), append(workers, w)
+	}}
+	serve.Flags().Int("port", 8080, "Port")
+	serve.Flags().Int("workers", 1, "Workers")
+	root.AddCommand(serve)
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root, StickyFlags: []string{"port"}})
+
+	sh.execute("serve --port 80 --workers 4")
+	sh.execute("serve")
+	sh.execute("serve --port 81")
+	if want := []int{80, 80, 81}; !slices.Equal(port, want) {
+		t.Errorf("sticky --port values = %v, want %v", port, want)
+	}
+	if want := []int{4, 1, 1}; !slices.Equal(workers, want) {
+		t.Errorf("non-sticky --workers values = %v, want %v", workers, want)
+	}
+}
+
 // --- embeddedCompleter ---
 
 func newTestRoot() *cobra.Command {
@@ -224,6 +318,17 @@ func TestEmbeddedCompleter_Do_ReturnsSuffix(t *testing.T) {
 	}
 }
 
+func TestEmbeddedCompleter_Do_CursorMidWord(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	line := []rune("sve --port 80")
+	got, length := c.Do(line, len("s"))
+	if length != 1 || len(got) != 1 || string(got[0]) != "er" {
+		t.Errorf("Do(%q) = %q, %d; want [er], 1", string(line), got, length)
+	}
+}
+
 func TestEmbeddedCompleter_Do_EmptyPrefix_ReturnsFullWord(t *testing.T) {
 	// When toComplete is empty (user tabbed after a space), the suffix equals
 	// the full word — verify no rune-slicing panic or truncation.
@@ -263,3 +368,603 @@ func TestEmbeddedCompleter_ValidArgsFunction(t *testing.T) {
 		t.Errorf("complete(['get'], 'a') = %v, want [alpha]", got)
 	}
 }
+
+func TestEmbeddedCompleter_ValidArgsFunction_NoSpace(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	root.AddCommand(&cobra.Command{
+		Use: "cd",
+		ValidArgsFunction: func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return []string{"src/", "srv/"}, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+		},
+	})
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root})
+	c := &embeddedCompleter{shell: sh}
+
+	// A directory-style candidate is inserted exactly, so the next Tab
+	// continues inside it rather than after a separating space.
+	line := []rune("cd src")
+	got, length := c.Do(line, len(line))
+	if length != 3 || len(got) != 1 || string(got[0]) != "/" {
+		t.Errorf("Do(%q) = %q, %d; want [/], 3", string(line), got, length)
+	}
+
+	// NoFileComp: nothing matching means no candidates, not local files.
+	line = []rune("cd zz")
+	if got, _ := c.Do(line, len(line)); got != nil {
+		t.Errorf("Do(%q) = %q, want none", string(line), got)
+	}
+}
+
+// newNestedTestRoot returns a tree with a second level of subcommands under
+// serve, for exercising multi-level help completion.
+func newNestedTestRoot() *cobra.Command {
+	root := newTestRoot()
+	serve, _, _ := root.Find([]string{"serve"})
+	serve.AddCommand(
+		&cobra.Command{Use: "start", Short: "Start the server"},
+		&cobra.Command{Use: "stop", Short: "Stop the server"},
+		&cobra.Command{Use: "debug", Short: "Debug", Hidden: true},
+	)
+	return root
+}
+
+func TestEmbeddedCompleter_HelpTopLevel(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newNestedTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"help"}, "se")
+	if len(got) != 1 || got[0] != "serve" {
+		t.Errorf("complete(['help'], 'se') = %v, want [serve]", got)
+	}
+}
+
+func TestEmbeddedCompleter_HelpNested(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newNestedTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"help", "serve"}, "")
+	assertSameElements(t, got, []string{"start", "stop"})
+}
+
+func TestEmbeddedCompleter_HelpNested_Prefix(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newNestedTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	line := []rune("help serve sta")
+	candidates, length := c.Do(line, len(line))
+	if length != 3 {
+		t.Errorf("length = %d, want 3", length)
+	}
+	if len(candidates) != 1 || string(candidates[0]) != "rt" {
+		t.Errorf("Do(%q) = %q, want [rt]", string(line), candidates)
+	}
+}
+
+// newDurationTestRoot returns a tree whose "wait" command has a duration flag
+// and a bool flag.
+func newDurationTestRoot() *cobra.Command {
+	root := newTestRoot()
+	wait := &cobra.Command{Use: "wait", Short: "Wait for a while"}
+	wait.Flags().DurationP("timeout", "t", 0, "How long to wait")
+	wait.Flags().Bool("quiet", false, "Suppress output")
+	root.AddCommand(wait)
+	return root
+}
+
+func TestEmbeddedCompleter_TypedValueHints_Duration(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newDurationTestRoot(), TypedValueHints: true})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"wait", "--timeout"}, "5")
+	assertSameElements(t, got, []string{"5ms", "5s", "5m", "5h"})
+
+	got = c.complete([]string{"wait", "-t"}, "1.5m")
+	assertSameElements(t, got, []string{"1.5m", "1.5ms"})
+}
+
+func TestEmbeddedCompleter_TypedValueHints_NonNumeric(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newDurationTestRoot(), TypedValueHints: true})
+	c := &embeddedCompleter{shell: sh}
+
+	if got := c.complete([]string{"wait", "--timeout"}, ""); len(got) != 0 {
+		t.Errorf("complete after --timeout with empty prefix = %v, want none", got)
+	}
+}
+
+func TestEmbeddedCompleter_TypedValueHints_Disabled(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newDurationTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	if got := c.complete([]string{"wait", "--timeout"}, "5"); len(got) != 0 {
+		t.Errorf("complete with TypedValueHints off = %v, want none", got)
+	}
+}
+
+func TestEmbeddedCompleter_BoolFlagDoesNotAwaitValue(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newDurationTestRoot(), TypedValueHints: true})
+	c := &embeddedCompleter{shell: sh}
+
+	// After a bool flag the next word is a flag name again.
+	got := c.complete([]string{"wait", "--quiet"}, "--t")
+	if len(got) != 1 || got[0] != "--timeout" {
+		t.Errorf("complete(['wait','--quiet'], '--t') = %v, want [--timeout]", got)
+	}
+}
+
+// newOffsetTestRoot returns a root with an "offset" command taking a numeric
+// positional argument, and a "tail" command with a numeric "-1" shorthand.
+func newOffsetTestRoot(gotToComplete *string) *cobra.Command {
+	root := &cobra.Command{Use: "myapp"}
+	offset := &cobra.Command{
+		Use: "offset N",
+		ValidArgsFunction: func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			*gotToComplete = toComplete
+			return []string{"-5", "-50", "10"}, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	offset.Flags().Bool("relative", false, "Relative offset")
+	root.AddCommand(offset)
+
+	tail := &cobra.Command{Use: "tail"}
+	tail.Flags().BoolP("one", "1", false, "Single line")
+	root.AddCommand(tail)
+	return root
+}
+
+func TestEmbeddedCompleter_NegativeNumberIsPositional(t *testing.T) {
+	var gotToComplete string
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newOffsetTestRoot(&gotToComplete)})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"offset"}, "-5")
+	assertSameElements(t, got, []string{"-5", "-50"})
+	if gotToComplete != "-5" {
+		t.Errorf("ValidArgsFunction toComplete = %q, want %q", gotToComplete, "-5")
+	}
+}
+
+func TestEmbeddedCompleter_NegativeNumber_NoFlagCandidates(t *testing.T) {
+	var gotToComplete string
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newOffsetTestRoot(&gotToComplete)})
+	c := &embeddedCompleter{shell: sh}
+
+	for _, word := range []string{"-5", "-1.5", "-7"} {
+		for _, cand := range c.complete([]string{"offset"}, word) {
+			if strings.HasPrefix(cand, "--") {
+				t.Errorf("complete(offset, %q) offered flag %q", word, cand)
+			}
+		}
+	}
+}
+
+func TestIsNegativeNumber(t *testing.T) {
+	var unused string
+	root := newOffsetTestRoot(&unused)
+	offset, _, _ := root.Find([]string{"offset"})
+	tail, _, _ := root.Find([]string{"tail"})
+
+	tests := []struct {
+		cmd  *cobra.Command
+		word string
+		want bool
+	}{
+		{offset, "-5", true},
+		{offset, "-12", true},
+		{offset, "-0.25", true},
+		{offset, "-", false},
+		{offset, "--5", false},
+		{offset, "-v", false},
+		{offset, "-1.2.3", false},
+		{offset, "5", false},
+		{tail, "-1", false}, // a registered shorthand stays a flag
+		{tail, "-10", true},
+	}
+	for _, tt := range tests {
+		if got := isNegativeNumber(tt.cmd, tt.word); got != tt.want {
+			t.Errorf("isNegativeNumber(%s, %q) = %v, want %v", tt.cmd.Name(), tt.word, got, tt.want)
+		}
+	}
+}
+
+// newShorthandTestRoot returns a root with a persistent --verbose/-v flag and
+// a "serve" command with --port/-p that also redefines --verbose locally.
+func newShorthandTestRoot() *cobra.Command {
+	root := &cobra.Command{Use: "myapp"}
+	root.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
+
+	serve := &cobra.Command{Use: "serve", Run: func(*cobra.Command, []string) {}}
+	serve.Flags().IntP("port", "p", 8080, "Port")
+	serve.Flags().Bool("verbose", false, "Verbose server logs")
+	root.AddCommand(serve)
+	return root
+}
+
+func TestEmbeddedCompleter_LoneDashOffersShorthands(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newShorthandTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"serve"}, "-")
+	assertSameElements(t, got, []string{"-p", "--port", "--verbose"})
+}
+
+func TestEmbeddedCompleter_DoubleDashOmitsShorthands(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newShorthandTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"serve"}, "--")
+	assertSameElements(t, got, []string{"--port", "--verbose"})
+}
+
+func TestEmbeddedCompleter_ShadowedPersistentFlagOnce(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newShorthandTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	n := 0
+	for _, cand := range c.complete([]string{"serve"}, "--v") {
+		if cand == "--verbose" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("--verbose offered %d times, want 1", n)
+	}
+}
+
+// --- reload built-in ---
+
+func TestEmbeddedReload_CompleterSeesNewSubcommand(t *testing.T) {
+	calls := 0
+	provider := func() *cobra.Command {
+		calls++
+		root := newTestRoot()
+		if calls > 1 {
+			root.AddCommand(&cobra.Command{Use: "migrate", Short: "Run migrations"})
+		}
+		return root
+	}
+	sh := NewEmbedded(EmbeddedConfig{RootCmdProvider: provider})
+	if sh.initErr != nil {
+		t.Fatalf("NewEmbedded: %v", sh.initErr)
+	}
+	c := &embeddedCompleter{shell: sh}
+
+	if got := c.complete(nil, "mi"); len(got) != 0 {
+		t.Fatalf("before reload complete(nil, 'mi') = %v, want empty", got)
+	}
+	sh.execute("reload")
+	if got := c.complete(nil, "mi"); len(got) != 1 || got[0] != "migrate" {
+		t.Errorf("after reload complete(nil, 'mi') = %v, want [migrate]", got)
+	}
+}
+
+func TestEmbeddedReload_NilKeepsTree(t *testing.T) {
+	root := newTestRoot()
+	var stderr bytes.Buffer
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd:         root,
+		RootCmdProvider: func() *cobra.Command { return nil },
+		Stderr:          &stderr,
+	})
+	sh.execute("reload")
+	if sh.cfg.RootCmd != root {
+		t.Error("reload with a nil provider result replaced the command tree")
+	}
+	if !strings.Contains(stderr.String(), "RootCmdProvider returned nil") {
+		t.Errorf("Stderr = %q, want error about nil provider result", stderr.String())
+	}
+	if sh.lastExitCode == 0 {
+		t.Error("lastExitCode = 0 after failed reload, want non-zero")
+	}
+}
+
+func TestEmbeddedReload_DisabledWithoutProvider(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newTestRoot()})
+	if sh.handleReloadBuiltin([]string{"reload"}) {
+		t.Error("handleReloadBuiltin should return false without RootCmdProvider")
+	}
+}
+
+func TestEmbeddedReload_ListedInRootHelp(t *testing.T) {
+	var stdout bytes.Buffer
+	sh := NewEmbedded(EmbeddedConfig{RootCmdProvider: newTestRoot, Stdout: &stdout})
+	sh.execute("--help")
+	if !strings.Contains(stdout.String(), "Shell built-ins:\n  reload ") {
+		t.Errorf("help output = %q, want reload listed", stdout.String())
+	}
+
+	stdout.Reset()
+	sh = NewEmbedded(EmbeddedConfig{RootCmd: newTestRoot(), Stdout: &stdout})
+	sh.execute("--help")
+	if strings.Contains(stdout.String(), "Shell built-ins") {
+		t.Errorf("help output = %q, want no built-ins without RootCmdProvider", stdout.String())
+	}
+}
+
+func newRequiredFlagTestRoot() *cobra.Command {
+	root := &cobra.Command{Use: "myapp"}
+	deploy := &cobra.Command{Use: "deploy", Short: "Deploy", Run: func(*cobra.Command, []string) {}}
+	deploy.Flags().Bool("dry-run", false, "Print the plan only")
+	deploy.Flags().String("env", "", "Target environment")
+	deploy.Flags().String("tag", "", "Image tag")
+	_ = deploy.MarkFlagRequired("tag")
+	root.AddCommand(deploy)
+	return root
+}
+
+func TestEmbeddedCompleter_RequiredFlagsFirst(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newRequiredFlagTestRoot(), HighlightRequiredFlags: true})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"deploy"}, "--")
+	if len(got) == 0 || got[0] != "--tag" {
+		t.Errorf("complete(deploy, --) = %v, want --tag first", got)
+	}
+
+	sh.cfg.HighlightRequiredFlags = false
+	if got := c.complete([]string{"deploy"}, "--"); len(got) > 0 && got[0] == "--tag" {
+		t.Errorf("without HighlightRequiredFlags, got %v; want the flag set's own order", got)
+	}
+}
+
+func TestEmbeddedCompleter_RequiredFlagTagged(t *testing.T) {
+	var buf bytes.Buffer
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd:                newRequiredFlagTestRoot(),
+		ShowDescriptions:       true,
+		HighlightRequiredFlags: true,
+	})
+	c := &embeddedCompleter{shell: sh, menu: &buf}
+
+	line := []rune("deploy --")
+	if got, _ := c.Do(line, len(line)); got != nil {
+		t.Fatalf("Do returned %q, want the menu", got)
+	}
+	menu := buf.String()
+	if !strings.Contains(menu, "--tag      Image tag (required)") {
+		t.Errorf("menu does not tag --tag as required:\n%s", menu)
+	}
+	if strings.Contains(menu, "Target environment (required)") {
+		t.Errorf("menu tags an optional flag as required:\n%s", menu)
+	}
+	if strings.Index(menu, "--tag") > strings.Index(menu, "--env") {
+		t.Errorf("required flag not listed first:\n%s", menu)
+	}
+}
+
+func TestEmbeddedRun_ConfigureReadline(t *testing.T) {
+	var got *readline.Instance
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd:           newTestRoot(),
+		HistoryFile:       filepath.Join(t.TempDir(), "history"),
+		ConfigureReadline: func(rl *readline.Instance) { got = rl },
+	})
+	if err := sh.run(io.NopCloser(strings.NewReader("exit\n"))); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got == nil {
+		t.Error("ConfigureReadline was not called with a readline instance")
+	}
+}
+
+func newFlagValueTestRoot() *cobra.Command {
+	root := &cobra.Command{Use: "myapp"}
+	serve := &cobra.Command{Use: "serve", Run: func(*cobra.Command, []string) {}}
+	serve.Flags().IntP("port", "p", 8080, "Port")
+	serve.Flags().BoolP("verbose", "v", false, "Verbose output")
+	serve.Flags().BoolP("debug", "d", false, "Debug output")
+	_ = serve.RegisterFlagCompletionFunc("port", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return []string{"8080", "9090"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	root.AddCommand(serve)
+	return root
+}
+
+func TestEmbeddedCompleter_FlagEqualsValue(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newFlagValueTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	assertSameElements(t, c.complete([]string{"serve"}, "--port="), []string{"--port=8080", "--port=9090"})
+	assertSameElements(t, c.complete([]string{"serve"}, "--port=9"), []string{"--port=9090"})
+	assertSameElements(t, c.complete([]string{"serve"}, "-vp="), []string{"-vp=8080", "-vp=9090"})
+
+	// The flag name itself still completes.
+	assertSameElements(t, c.complete([]string{"serve"}, "--por"), []string{"--port"})
+
+	// Through Do, the inserted suffix follows what was typed after "=".
+	line := []rune("serve --port=80")
+	got, length := c.Do(line, len(line))
+	if length != len("--port=80") || len(got) != 1 || string(got[0]) != "80" {
+		t.Errorf("Do(%q) = %q, %d; want [80], %d", string(line), got, length, len("--port=80"))
+	}
+}
+
+func TestEmbeddedCompleter_FlagValueAfterSpace(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newFlagValueTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	assertSameElements(t, c.complete([]string{"serve", "--port"}, ""), []string{"8080", "9090"})
+	assertSameElements(t, c.complete([]string{"serve", "-vp"}, ""), []string{"8080", "9090"})
+}
+
+func TestEmbeddedCompleter_RegisteredFlagCompletion(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	root.PersistentFlags().String("format", "", "Output format")
+	_ = root.RegisterFlagCompletionFunc("format", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return []string{"json", "yaml"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	root.AddCommand(&cobra.Command{Use: "get", Run: func(*cobra.Command, []string) {}})
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root})
+	c := &embeddedCompleter{shell: sh}
+
+	for _, line := range []string{"--format ", "get --format "} {
+		got, length := c.Do([]rune(line), len(line))
+		var values []string
+		for _, g := range got {
+			values = append(values, string(g))
+		}
+		if length != 0 {
+			t.Errorf("Do(%q) length = %d, want 0", line, length)
+		}
+		assertSameElements(t, values, []string{"json", "yaml"})
+	}
+
+	line := []rune("get --format y")
+	if got, _ := c.Do(line, len(line)); len(got) != 1 || string(got[0]) != "aml" {
+		t.Errorf("Do(%q) = %q, want [aml]", string(line), got)
+	}
+
+	// The root's own persistent flag is offered by name before any command
+	// has run.
+	assertSameElements(t, c.complete(nil, "--f"), []string{"--format"})
+}
+
+func TestEmbeddedCompleter_UsedFlagsNotReoffered(t *testing.T) {
+	root := newFlagValueTestRoot()
+	serve, _, _ := root.Find([]string{"serve"})
+	serve.Flags().StringSlice("tag", nil, "Tags")
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root})
+	c := &embeddedCompleter{shell: sh}
+
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"serve", "--port", "80"}, []string{"--verbose", "--debug", "--tag"}},
+		{[]string{"serve", "--port=80"}, []string{"--verbose", "--debug", "--tag"}},
+		{[]string{"serve", "-p", "80", "--verbose"}, []string{"--debug", "--tag"}},
+		{[]string{"serve", "-vp80"}, []string{"--debug", "--tag"}},
+		{[]string{"serve", "--tag", "a"}, []string{"--port", "--verbose", "--debug", "--tag"}},
+	}
+	for _, tc := range cases {
+		got := c.complete(tc.args, "--")
+		assertSameElements(t, got, tc.want)
+	}
+}
+
+func TestEmbeddedCompleter_AfterArgumentTerminator(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	var gotArgs []string
+	get := &cobra.Command{
+		Use: "get",
+		Run: func(*cobra.Command, []string) {},
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			gotArgs = args
+			return []string{"alpha", "another", "-dash-value"}, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	get.Flags().String("output", "", "Output format")
+	get.AddCommand(&cobra.Command{Use: "all", Run: func(*cobra.Command, []string) {}})
+	root.AddCommand(get)
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root})
+	c := &embeddedCompleter{shell: sh}
+
+	assertSameElements(t, c.complete([]string{"get", "--"}, "a"), []string{"alpha", "another"})
+	assertSameElements(t, c.complete([]string{"get", "--", "x"}, ""), []string{"-dash-value", "alpha", "another"})
+	if len(gotArgs) != 1 || gotArgs[0] != "x" {
+		t.Errorf("ValidArgsFunction args = %q, want [x] without the --", gotArgs)
+	}
+	if got := c.complete([]string{"get", "--"}, "--o"); len(got) != 0 {
+		t.Errorf("complete after -- = %v, want no flag names", got)
+	}
+	if got := c.complete([]string{"get", "--", "--output"}, "j"); len(got) != 0 {
+		t.Errorf("complete after -- --output = %v, want no flag value completion", got)
+	}
+
+	// Before the terminator, flags are still offered.
+	assertSameElements(t, c.complete([]string{"get"}, "--o"), []string{"--output"})
+}
+
+func TestEmbeddedCompleter_ShorthandCluster(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newFlagValueTestRoot()})
+	c := &embeddedCompleter{shell: sh}
+
+	assertSameElements(t, c.complete([]string{"serve"}, "-vd"), []string{"-vdp"})
+	assertSameElements(t, c.complete([]string{"serve"}, "-vp"), []string{"-vp"})
+	if got := c.complete([]string{"serve"}, "-vz"); len(got) != 0 {
+		t.Errorf("complete(-vz) = %v, want none for an unknown shorthand", got)
+	}
+}
+
+func TestEmbeddedCompleter_FlagShorthandsShown(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	serve := &cobra.Command{Use: "serve", Run: func(*cobra.Command, []string) {}}
+	serve.Flags().IntP("port", "p", 8080, "Listen port")
+	serve.Flags().String("host", "", "Listen address")
+	root.AddCommand(serve)
+
+	var buf bytes.Buffer
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root, ShowDescriptions: true, ShowFlagShorthands: true})
+	c := &embeddedCompleter{shell: sh, menu: &buf}
+
+	line := []rune("serve --")
+	if got, _ := c.Do(line, len(line)); got != nil {
+		t.Fatalf("Do returned %q, want the menu", got)
+	}
+	menu := buf.String()
+	if !strings.Contains(menu, "--port (-p)  Listen port") {
+		t.Errorf("menu does not show the shorthand of --port:\n%s", menu)
+	}
+	if strings.Contains(menu, "--host (") {
+		t.Errorf("menu shows a shorthand for --host, which has none:\n%s", menu)
+	}
+
+	line = []rune("serve --po")
+	got, _ := c.Do(line, len(line))
+	if len(got) != 1 || string(got[0]) != "rt" {
+		t.Errorf("Do(serve --po) = %q, want only the long name inserted", got)
+	}
+}
+
+func TestEmbeddedCompleter_DedupesAcrossSources(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	svc := &cobra.Command{
+		Use: "svc",
+		ValidArgsFunction: func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return []string{"web", "api", "status"}, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	svc.AddCommand(&cobra.Command{Use: "status", Run: func(*cobra.Command, []string) {}})
+	svc.AddCommand(&cobra.Command{Use: "logs", Run: func(*cobra.Command, []string) {}})
+	root.AddCommand(svc)
+
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd: root,
+		DynamicCompletions: map[string]CompletionFunc{
+			"svc": func([]string, string) []string { return []string{"web", "status", "db"} },
+		},
+	})
+	c := &embeddedCompleter{shell: sh}
+
+	got := c.complete([]string{"svc"}, "")
+	want := []string{"logs", "status", "db", "web", "api"}
+	if len(got) != len(want) {
+		t.Fatalf("complete(svc) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("complete(svc) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEmbeddedCompleter_BoolFlagNegation(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	serve := &cobra.Command{Use: "serve", Run: func(*cobra.Command, []string) {}}
+	serve.Flags().BoolP("verbose", "v", false, "Verbose output")
+	serve.Flags().Bool("validate", false, "Validate input")
+	serve.Flags().String("vhost", "", "Virtual host")
+	root.AddCommand(serve)
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: root})
+	c := &embeddedCompleter{shell: sh}
+
+	assertSameElements(t, c.complete([]string{"serve"}, "--no-v"), []string{"--no-validate", "--no-verbose"})
+	assertSameElements(t, c.complete([]string{"serve"}, "--no-ve"), []string{"--no-verbose"})
+
+	// The negated forms stay out of plain flag listings.
+	assertSameElements(t, c.complete([]string{"serve"}, "--v"), []string{"--validate", "--verbose", "--vhost"})
+
+	line := []rune("serve --no-verb")
+	if got, _ := c.Do(line, len(line)); len(got) != 1 || string(got[0]) != "ose" {
+		t.Errorf("Do(%q) = %q, want [ose]", string(line), got)
+	}
+}
@@ -1,8 +1,11 @@
 package cobrashell
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -14,19 +17,28 @@ import (
 //
 // Session env variables take precedence over both os.Environ() and Config.Env
 // when building the subprocess environment.
+//
+// SetEnv, UnsetEnv and SessionEnv are safe to call from any goroutine, for
+// instance from a hook or while a command is running.
 func (s *Shell) SetEnv(key, value string) {
+	s.envMu.Lock()
+	defer s.envMu.Unlock()
 	s.sessionEnv[key] = value
 }
 
 // UnsetEnv removes a session-scoped environment variable previously set via
 // [Shell.SetEnv]. If key is not present it is a no-op.
 func (s *Shell) UnsetEnv(key string) {
+	s.envMu.Lock()
+	defer s.envMu.Unlock()
 	delete(s.sessionEnv, key)
 }
 
 // SessionEnv returns a snapshot of the current session environment as a sorted
 // slice of "KEY=VALUE" strings. It does not include os.Environ() or Config.Env.
 func (s *Shell) SessionEnv() []string {
+	s.envMu.RLock()
+	defer s.envMu.RUnlock()
 	pairs := make([]string, 0, len(s.sessionEnv))
 	for k, v := range s.sessionEnv {
 		pairs = append(pairs, k+"="+v)
@@ -35,6 +47,25 @@ func (s *Shell) SessionEnv() []string {
 	return pairs
 }
 
+// clearEnv removes every session-scoped environment variable and returns how
+// many there were.
+func (s *Shell) clearEnv() int {
+	s.envMu.Lock()
+	defer s.envMu.Unlock()
+	n := len(s.sessionEnv)
+	clear(s.sessionEnv)
+	return n
+}
+
+// sessionEnvMap returns a copy of the session environment, never nil.
+func (s *Shell) sessionEnvMap() map[string]string {
+	s.envMu.RLock()
+	defer s.envMu.RUnlock()
+	env := make(map[string]string, len(s.sessionEnv))
+	maps.Copy(env, s.sessionEnv)
+	return env
+}
+
 // buildEnv constructs the subprocess environment by merging three sources in
 // ascending priority order:
 //
@@ -46,18 +77,87 @@ func (s *Shell) SessionEnv() []string {
 // last occurrence in Cmd.Env. os.Setenv is never called.
 func (s *Shell) buildEnv() []string {
 	env := append(os.Environ(), s.cfg.Env...)
+	s.envMu.RLock()
+	defer s.envMu.RUnlock()
 	for k, v := range s.sessionEnv {
 		env = append(env, k+"="+v)
 	}
 	return env
 }
 
+// envEntry is one variable of the merged subprocess environment, with the
+// source its value came from: "os", "config", or "session".
+type envEntry struct {
+	Key, Value, Source string
+}
+
+// effectiveEnv returns the environment buildEnv produces with shadowed
+// values dropped, sorted by key, each variable labeled with the source that
+// won. Entries without "=" are skipped.
+func (s *Shell) effectiveEnv() []envEntry {
+	byKey := make(map[string]envEntry)
+	add := func(pairs []string, source string) {
+		for _, kv := range pairs {
+			if k, v, ok := strings.Cut(kv, "="); ok && k != "" {
+				byKey[k] = envEntry{Key: k, Value: v, Source: source}
+			}
+		}
+	}
+	add(os.Environ(), "os")
+	add(s.cfg.Env, "config")
+	add(s.SessionEnv(), "session")
+
+	entries := make([]envEntry, 0, len(byKey))
+	for _, e := range byKey {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// lookupEnv returns the value key would have in the subprocess environment
+// built by buildEnv, or "" if it is not set.
+func (s *Shell) lookupEnv(key string) string {
+	env := s.buildEnv()
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// envVarCandidates completes word, a "$NAME" or "${NAME" prefix, against the
+// names of the variables in the subprocess environment (see buildEnv). The
+// candidates keep word's form: "$NAME", or "${NAME}" with the closing brace.
+func (s *Shell) envVarCandidates(word string) []string {
+	open, close := "$", ""
+	if strings.HasPrefix(word, "${") {
+		open, close = "${", "}"
+	}
+	prefix := strings.TrimPrefix(word, open)
+
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, kv := range s.buildEnv() {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == "" || seen[name] || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		seen[name] = true
+		candidates = append(candidates, open+name+close)
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
 // handleEnvBuiltin checks whether tokens[0] matches Config.EnvBuiltin. If so,
 // it processes the built-in env command and returns true. If EnvBuiltin is
 // empty or the first token does not match, it returns false and the caller
 // should proceed with normal execution.
 //
-// Supported subcommands: list, set KEY VALUE, unset KEY.
+// Supported subcommands: list [--json], effective, set KEY VALUE, unset KEY,
+// clear.
 func (s *Shell) handleEnvBuiltin(tokens []string) bool {
 	name := s.cfg.EnvBuiltin
 	if name == "" || tokens[0] != name {
@@ -66,12 +166,14 @@ func (s *Shell) handleEnvBuiltin(tokens []string) bool {
 
 	// No subcommand or top-level --help / -h.
 	if len(tokens) < 2 || tokens[1] == "--help" || tokens[1] == "-h" {
-		fmt.Printf("Manage session-scoped environment variables.\n\n"+
+		fmt.Fprintf(s.stdout(), "Manage session-scoped environment variables.\n\n"+
 			"Usage:\n  %s [command]\n\n"+
 			"Available Commands:\n"+
 			"  list        List all session environment variables\n"+
+			"  effective   List the environment passed to commands, with sources\n"+
 			"  set         Set a session environment variable\n"+
-			"  unset       Remove a session environment variable\n\n"+
+			"  unset       Remove a session environment variable\n"+
+			"  clear       Remove all session environment variables\n\n"+
 			"Use \"%s [command] --help\" for more information about a command.\n",
 			name, name)
 		return true
@@ -86,43 +188,85 @@ func (s *Shell) handleEnvBuiltin(tokens []string) bool {
 	switch sub {
 	case "list":
 		if wantsHelp {
-			fmt.Printf("List all session environment variables.\n\n"+
-				"Usage:\n  %s list\n", name)
+			fmt.Fprintf(s.stdout(), "List all session environment variables.\n\n"+
+				"Usage:\n  %s list [--json]\n\n"+
+				"Flags:\n"+
+				"      --json   Print the variables as a JSON object\n", name)
+			return true
+		}
+		if slices.Contains(rest, "--json") {
+			// json.Marshal sorts map keys, matching the KEY=VALUE order.
+			out, err := json.MarshalIndent(s.sessionEnvMap(), "", "  ")
+			if err != nil {
+				s.writeErr("cobra-shell: %v\n", err)
+				return true
+			}
+			fmt.Fprintln(s.stdout(), string(out))
 			return true
 		}
 		for _, pair := range s.SessionEnv() {
-			fmt.Println(pair)
+			fmt.Fprintln(s.stdout(), pair)
+		}
+
+	case "effective":
+		if wantsHelp {
+			fmt.Fprintf(s.stdout(), "List the environment passed to commands.\n"+
+				"Each variable is labeled with the source of its value: os,\n"+
+				"config (Config.Env), or session (%s set).\n\n"+
+				"Usage:\n  %s effective\n", name, name)
+			return true
+		}
+		for _, e := range s.effectiveEnv() {
+			fmt.Fprintf(s.stdout(), "%-9s %s=%s\n", "["+e.Source+"]", e.Key, e.Value)
 		}
 
 	case "set":
 		if wantsHelp {
-			fmt.Printf("Set a session environment variable.\n"+
+			fmt.Fprintf(s.stdout(), "Set a session environment variable.\n"+
 				"The value takes effect on the next command execution.\n\n"+
 				"Usage:\n  %s set KEY VALUE\n", name)
 			return true
 		}
 		if len(tokens) != 4 {
-			writeErr("Error: accepts 2 args, received %d\n\nUsage:\n  %s set KEY VALUE\n",
+			s.writeErr("Error: accepts 2 args, received %d\n\nUsage:\n  %s set KEY VALUE\n",
 				len(rest), name)
 			return true
 		}
-		s.SetEnv(tokens[2], tokens[3])
+		value := tokens[3]
+		if s.cfg.EnvExpand {
+			value = os.Expand(value, s.lookupEnv)
+		}
+		s.SetEnv(tokens[2], value)
 
 	case "unset":
 		if wantsHelp {
-			fmt.Printf("Remove a session environment variable.\n\n"+
+			fmt.Fprintf(s.stdout(), "Remove a session environment variable.\n\n"+
 				"Usage:\n  %s unset KEY\n", name)
 			return true
 		}
 		if len(tokens) != 3 {
-			writeErr("Error: accepts 1 arg, received %d\n\nUsage:\n  %s unset KEY\n",
+			s.writeErr("Error: accepts 1 arg, received %d\n\nUsage:\n  %s unset KEY\n",
 				len(rest), name)
 			return true
 		}
 		s.UnsetEnv(tokens[2])
 
+	case "clear":
+		if wantsHelp {
+			fmt.Fprintf(s.stdout(), "Remove all session environment variables.\n\n"+
+				"Usage:\n  %s clear\n", name)
+			return true
+		}
+		if len(rest) != 0 {
+			s.writeErr("Error: accepts 0 args, received %d\n\nUsage:\n  %s clear\n",
+				len(rest), name)
+			return true
+		}
+		n := s.clearEnv()
+		fmt.Fprintf(s.stdout(), "Removed %d session variables\n", n)
+
 	default:
-		writeErr("Error: unknown command %q for %q\nRun '%s --help' for usage.\n",
+		s.writeErr("Error: unknown command %q for %q\nRun '%s --help' for usage.\n",
 			sub, name, name)
 	}
 	return true
@@ -1,7 +1,10 @@
 package cobrashell
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -70,6 +73,51 @@ func TestSessionEnv_Empty(t *testing.T) {
 	}
 }
 
+func TestSessionEnv_ConcurrentAccess(t *testing.T) {
+	s := makeEnvShell("")
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = s.SessionEnv()
+				_ = s.buildEnv()
+			}
+		}
+	}()
+	for i := range 8 {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			key := fmt.Sprintf("K%d", i)
+			for j := range 200 {
+				s.SetEnv(key, fmt.Sprint(j))
+				s.SetEnv("TMP"+key, "x")
+				s.UnsetEnv("TMP" + key)
+			}
+		}()
+	}
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	got := s.SessionEnv()
+	if len(got) != 8 {
+		t.Fatalf("SessionEnv() = %v, want the 8 kept keys", got)
+	}
+	for _, kv := range got {
+		if !strings.HasSuffix(kv, "=199") {
+			t.Errorf("SessionEnv() entry %q, want the last value 199", kv)
+		}
+	}
+}
+
 // --- buildEnv ---
 
 func TestBuildEnv_SessionShadowsConfig(t *testing.T) {
@@ -158,6 +206,39 @@ func TestHandleEnvBuiltin_List(t *testing.T) {
 	}
 }
 
+func TestHandleEnvBuiltin_ListPlainUnchanged(t *testing.T) {
+	s := makeEnvShell("env")
+	s.SetEnv("B", "2")
+	s.SetEnv("A", "1")
+	out := captureStdout(t, func() { s.handleEnvBuiltin([]string{"env", "list"}) })
+	if out != "A=1\nB=2\n" {
+		t.Errorf("env list output = %q, want %q", out, "A=1\nB=2\n")
+	}
+}
+
+func TestHandleEnvBuiltin_ListJSON(t *testing.T) {
+	s := makeEnvShell("env")
+	s.SetEnv("TOKEN", `a"b\c`)
+	s.SetEnv("EMPTY", "")
+	out := captureStdout(t, func() { s.handleEnvBuiltin([]string{"env", "list", "--json"}) })
+
+	var got map[string]string
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("env list --json output is not valid JSON: %v\n%s", err, out)
+	}
+	if len(got) != 2 || got["TOKEN"] != `a"b\c` || got["EMPTY"] != "" {
+		t.Errorf("env list --json = %v, want TOKEN and EMPTY", got)
+	}
+}
+
+func TestHandleEnvBuiltin_ListJSONEmpty(t *testing.T) {
+	s := &Shell{cfg: Config{EnvBuiltin: "env"}}
+	out := captureStdout(t, func() { s.handleEnvBuiltin([]string{"env", "list", "--json"}) })
+	if strings.TrimSpace(out) != "{}" {
+		t.Errorf("env list --json with no variables = %q, want {}", out)
+	}
+}
+
 func TestHandleEnvBuiltin_Set(t *testing.T) {
 	s := makeEnvShell("env")
 	if !s.handleEnvBuiltin([]string{"env", "set", "MY_KEY", "my_value"}) {
@@ -168,6 +249,45 @@ func TestHandleEnvBuiltin_Set(t *testing.T) {
 	}
 }
 
+func TestHandleEnvBuiltin_SetLiteralByDefault(t *testing.T) {
+	s := makeEnvShell("env")
+	s.SetEnv("FOO", "bar")
+	s.handleEnvBuiltin([]string{"env", "set", "GREETING", "hello $FOO"})
+	if got := s.sessionEnv["GREETING"]; got != "hello $FOO" {
+		t.Errorf("GREETING = %q, want literal %q", got, "hello $FOO")
+	}
+}
+
+func TestHandleEnvBuiltin_SetExpandsSessionVar(t *testing.T) {
+	s := makeEnvShell("env")
+	s.cfg.EnvExpand = true
+	s.handleEnvBuiltin([]string{"env", "set", "FOO", "bar"})
+	s.handleEnvBuiltin([]string{"env", "set", "GREETING", "hello $FOO and ${FOO}"})
+	if got := s.sessionEnv["GREETING"]; got != "hello bar and bar" {
+		t.Errorf("GREETING = %q, want %q", got, "hello bar and bar")
+	}
+}
+
+func TestHandleEnvBuiltin_SetExpandsConfigAndOsEnv(t *testing.T) {
+	t.Setenv("CS_EXPAND_OS", "os")
+	s := makeEnvShell("env")
+	s.cfg.EnvExpand = true
+	s.cfg.Env = []string{"CS_EXPAND_CFG=cfg"}
+	s.handleEnvBuiltin([]string{"env", "set", "V", "$CS_EXPAND_OS-$CS_EXPAND_CFG"})
+	if got := s.sessionEnv["V"]; got != "os-cfg" {
+		t.Errorf("V = %q, want %q", got, "os-cfg")
+	}
+}
+
+func TestHandleEnvBuiltin_SetExpandsUndefinedToEmpty(t *testing.T) {
+	s := makeEnvShell("env")
+	s.cfg.EnvExpand = true
+	s.handleEnvBuiltin([]string{"env", "set", "V", "[$CS_SURELY_UNDEFINED_VAR]"})
+	if got := s.sessionEnv["V"]; got != "[]" {
+		t.Errorf("V = %q, want %q", got, "[]")
+	}
+}
+
 func TestHandleEnvBuiltin_SetWrongArgCount(t *testing.T) {
 	s := makeEnvShell("env")
 	// Too few args: prints usage, returns true.
@@ -202,6 +322,39 @@ func TestHandleEnvBuiltin_UnknownSubcommand(t *testing.T) {
 	}
 }
 
+func TestHandleEnvBuiltin_Clear(t *testing.T) {
+	s := makeEnvShell("env")
+	s.SetEnv("A", "1")
+	s.SetEnv("B", "2")
+	s.SetEnv("C", "3")
+	var handled bool
+	out := captureStdout(t, func() { handled = s.handleEnvBuiltin([]string{"env", "clear"}) })
+	if !handled {
+		t.Error("handleEnvBuiltin clear should return true")
+	}
+	if got := s.SessionEnv(); len(got) != 0 {
+		t.Errorf("SessionEnv() after clear = %v, want empty", got)
+	}
+	if !strings.Contains(out, "Removed 3 session variables") {
+		t.Errorf("env clear output = %q, want the number of variables removed", out)
+	}
+
+	// Variables can be set again afterwards.
+	s.SetEnv("D", "4")
+	if got := s.SessionEnv(); len(got) != 1 || got[0] != "D=4" {
+		t.Errorf("SessionEnv() after clear and set = %v, want [D=4]", got)
+	}
+}
+
+func TestHandleEnvBuiltin_ClearRejectsArgs(t *testing.T) {
+	s := makeEnvShell("env")
+	s.SetEnv("A", "1")
+	captureStderr(t, func() { s.handleEnvBuiltin([]string{"env", "clear", "A"}) })
+	if got := s.SessionEnv(); len(got) != 1 {
+		t.Errorf("SessionEnv() after rejected clear = %v, want A kept", got)
+	}
+}
+
 // --- completer.doEnvBuiltin ---
 
 func makeEnvCompleter(envBuiltin string) *completer {
@@ -219,8 +372,8 @@ func makeEnvCompleter(envBuiltin string) *completer {
 func TestDoEnvBuiltin_AllSubcommands(t *testing.T) {
 	c := makeEnvCompleter("env")
 	got, length := c.doEnvBuiltin(nil, "")
-	if len(got) != 3 {
-		t.Errorf("expected 3 subcommand candidates, got %d: %v", len(got), got)
+	if len(got) != 5 {
+		t.Errorf("expected 5 subcommand candidates, got %d: %v", len(got), got)
 	}
 	if length != 0 {
 		t.Errorf("expected length 0 for empty toComplete, got %d", length)
@@ -269,11 +422,14 @@ func TestDoEnvBuiltin_SetNoCompletion(t *testing.T) {
 	}
 }
 
-func TestDoEnvBuiltin_ListNoCompletion(t *testing.T) {
+func TestDoEnvBuiltin_ListOffersJSON(t *testing.T) {
 	c := makeEnvCompleter("env")
 	got, _ := c.doEnvBuiltin([]string{"list"}, "")
-	if len(got) != 0 {
-		t.Errorf("expected no candidates after 'list', got %v", got)
+	if len(got) != 1 || string(got[0]) != "--json" {
+		t.Errorf("expected only --json after 'list', got %q", got)
+	}
+	if got, _ := c.doEnvBuiltin([]string{"list", "--json"}, ""); len(got) != 0 {
+		t.Errorf("expected no candidates after 'list --json', got %q", got)
 	}
 }
 
@@ -315,3 +471,63 @@ func TestEnvBuiltinKeys_Empty(t *testing.T) {
 		t.Errorf("envBuiltinKeys(nil) = %v, want []", got)
 	}
 }
+
+func TestCompleterDo_EnvVarNames(t *testing.T) {
+	t.Setenv("CS_INHERITED", "1")
+	sh := &Shell{
+		cfg:        Config{Env: []string{"CS_CONFIG=1"}},
+		sessionEnv: make(map[string]string),
+	}
+	sh.SetEnv("CS_SESSION", "1")
+	c := &completer{shell: sh}
+
+	line := []rune("greet --name $CS_")
+	got, length := c.Do(line, len(line))
+	if length != len("$CS_") {
+		t.Errorf("length = %d, want %d", length, len("$CS_"))
+	}
+	var names []string
+	for _, r := range got {
+		names = append(names, string(r))
+	}
+	assertSameElements(t, names, []string{"CONFIG", "INHERITED", "SESSION"})
+
+	line = []rune("greet ${CS_SE")
+	got, _ = c.Do(line, len(line))
+	if len(got) != 1 || string(got[0]) != "SSION}" {
+		t.Errorf("Do(%q) = %q, want [SSION}]", string(line), got)
+	}
+}
+
+func TestHandleEnvBuiltin_EffectiveLabelsSources(t *testing.T) {
+	t.Setenv("CS_EFFECTIVE_OS", "from-os")
+	s := makeEnvShell("env")
+	s.cfg.Env = []string{"CS_EFFECTIVE_CFG=from-config", "CS_EFFECTIVE_SHADOWED=from-config"}
+	s.SetEnv("CS_EFFECTIVE_SHADOWED", "from-session")
+	out := captureStdout(t, func() { s.handleEnvBuiltin([]string{"env", "effective"}) })
+
+	for _, want := range []string{
+		"[os]      CS_EFFECTIVE_OS=from-os\n",
+		"[config]  CS_EFFECTIVE_CFG=from-config\n",
+		"[session] CS_EFFECTIVE_SHADOWED=from-session\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("env effective output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "CS_EFFECTIVE_SHADOWED=from-config") {
+		t.Errorf("env effective lists the shadowed config value:\n%s", out)
+	}
+}
+
+func TestEffectiveEnv_SortedByKey(t *testing.T) {
+	s := makeEnvShell("env")
+	s.SetEnv("ZZZ_CS", "1")
+	s.SetEnv("AAA_CS", "2")
+	entries := s.effectiveEnv()
+	for i := 1; i < len(entries); i++ {
+		if entries[i-1].Key >= entries[i].Key {
+			t.Fatalf("effectiveEnv not sorted: %q before %q", entries[i-1].Key, entries[i].Key)
+		}
+	}
+}
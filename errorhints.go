@@ -0,0 +1,50 @@
+package cobrashell
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ErrorHint is an entry of [Config.ErrorHints]: a message printed after a
+// failed command whose stderr matches Pattern.
+type ErrorHint struct {
+	// Pattern is a regular expression ([regexp] syntax) matched against the
+	// command's stderr.
+	Pattern string
+
+	// Message is printed to stderr after the command when Pattern matches.
+	Message string
+}
+
+// compiledHint is an ErrorHint with its pattern compiled by New.
+type compiledHint struct {
+	re      *regexp.Regexp
+	message string
+}
+
+// compileErrorHints compiles the patterns of hints, reporting the first
+// invalid one.
+func compileErrorHints(hints []ErrorHint) ([]compiledHint, error) {
+	compiled := make([]compiledHint, 0, len(hints))
+	for i, h := range hints {
+		re, err := regexp.Compile(h.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("cobra-shell: ErrorHints[%d]: invalid pattern %q: %w", i, h.Pattern, err)
+		}
+		compiled = append(compiled, compiledHint{re: re, message: h.Message})
+	}
+	return compiled, nil
+}
+
+// printErrorHints prints the message of every hint whose pattern matches
+// stderr, in configuration order. It does nothing for a successful command.
+func (s *Shell) printErrorHints(exitCode int, stderr string) {
+	if exitCode == 0 {
+		return
+	}
+	for _, h := range s.errorHints {
+		if h.re.MatchString(stderr) {
+			fmt.Fprintln(s.stderr(), h.message)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package cobrashell
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func newHintShell(t *testing.T, hints ...ErrorHint) *Shell {
+	t.Helper()
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := New(Config{BinaryPath: testBinary, HistoryFile: os.DevNull, ErrorHints: hints})
+	if sh.initErr != nil {
+		t.Fatalf("New: %v", sh.initErr)
+	}
+	return sh
+}
+
+func TestIntegration_ErrorHints_PrintedOnMatch(t *testing.T) {
+	sh := newHintShell(t,
+		ErrorHint{Pattern: "intentional fail", Message: "hint: this command always fails"},
+		ErrorHint{Pattern: "(?i)unauthorized", Message: "hint: log in first"},
+	)
+	stderr := captureStderr(t, func() { sh.execute("fail") })
+	if !strings.Contains(stderr, "intentional failure") {
+		t.Errorf("stderr = %q, want the command's own error still shown", stderr)
+	}
+	if !strings.Contains(stderr, "hint: this command always fails") {
+		t.Errorf("stderr = %q, want the matching hint", stderr)
+	}
+	if strings.Contains(stderr, "log in first") {
+		t.Errorf("stderr = %q, printed a hint whose pattern does not match", stderr)
+	}
+}
+
+func TestIntegration_ErrorHints_NotPrintedOnSuccess(t *testing.T) {
+	sh := newHintShell(t, ErrorHint{Pattern: ".*", Message: "hint: should not appear"})
+	stderr := captureStderr(t, func() { captureStdout(t, func() { sh.execute("greet") }) })
+	if strings.Contains(stderr, "should not appear") {
+		t.Errorf("stderr = %q, printed a hint after a successful command", stderr)
+	}
+}
+
+func TestNew_InvalidErrorHintPattern(t *testing.T) {
+	sh := New(Config{BinaryPath: "/usr/bin/true", ErrorHints: []ErrorHint{{Pattern: "(", Message: "x"}}})
+	if sh.initErr == nil || !strings.Contains(sh.initErr.Error(), "ErrorHints[0]") {
+		t.Errorf("initErr = %v, want an invalid pattern error for ErrorHints[0]", sh.initErr)
+	}
+}
@@ -0,0 +1,152 @@
+package cobrashell
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// outputTaps are optional writers that receive a copy of everything a child
+// prints, in addition to the terminal. A nil field is not tapped. out and
+// errOut are not taps but where the output goes, Config.Stdout and
+// Config.Stderr; nil stands for os.Stdout and os.Stderr.
+type outputTaps struct {
+	output io.Writer // stdout and stderr; see Config.CaptureOutput
+	stderr io.Writer // stderr only, or all output in PTY mode; see Config.ErrorHints
+
+	out, errOut io.Writer
+}
+
+// stdoutDest returns where the child's stdout goes, before tapping.
+func (t outputTaps) stdoutDest() io.Writer {
+	if t.out != nil {
+		return t.out
+	}
+	return os.Stdout
+}
+
+// stderrDest returns where the child's stderr goes, before tapping.
+func (t outputTaps) stderrDest() io.Writer {
+	if t.errOut != nil {
+		return t.errOut
+	}
+	return os.Stderr
+}
+
+// stdoutTo returns the writer for the child's stdout: w plus the taps.
+func (t outputTaps) stdoutTo(w io.Writer) io.Writer {
+	return tee(w, t.output)
+}
+
+// stderrTo returns the writer for the child's stderr, or for the merged
+// stream of a PTY: w plus the taps.
+func (t outputTaps) stderrTo(w io.Writer) io.Writer {
+	return tee(w, t.output, t.stderr)
+}
+
+// tee returns w when every tap is nil, and otherwise a writer that copies to
+// w and each non-nil tap.
+func tee(w io.Writer, taps ...io.Writer) io.Writer {
+	writers := []io.Writer{w}
+	for _, tap := range taps {
+		if tap != nil {
+			writers = append(writers, tap)
+		}
+	}
+	if len(writers) == 1 {
+		return w
+	}
+	return io.MultiWriter(writers...)
+}
+
+// runPlain runs cmd with inherited stdin/stdout/stderr (or those of taps)
+// and no PTY. A stdin
+// already set on cmd, such as an input redirection, is kept.
+// SIGINT is suppressed in the parent while the child runs: the terminal
+// delivers SIGINT to the entire foreground process group, so the child
+// still receives it and can handle or be killed by it normally.
+//
+// When taps are set, output is also copied into them. The child then writes
+// to pipes rather than directly to the terminal.
+func runPlain(cmd *exec.Cmd, taps outputTaps) (status exitStatus, err error) {
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = taps.stdoutTo(taps.stdoutDest())
+	cmd.Stderr = taps.stderrTo(taps.stderrDest())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+
+	return statusFromWait(cmd.Run())
+}
+
+// outputBuffer is an io.Writer that keeps at most limit bytes: once full, the
+// oldest output is discarded so the most recent output is retained. It is
+// safe for concurrent use, since a child's stdout and stderr are copied by
+// separate goroutines.
+type outputBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+// Write implements io.Writer. It never fails.
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the retained output.
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// pipelineScript returns the shell script that runs a pipeline on goos: the
+// binary and its arguments left, each quoted for the platform shell so that
+// the shell passes them through literally (except for %VAR% references on
+// Windows; see cmdQuote), followed by "| " and right, the
+// raw rest of the user's line, which keeps the shell's features. A
+// standalone "<" in left is left unquoted so that an input redirection
+// still applies to the binary.
+func pipelineScript(goos, binary string, left []string, right string) string {
+	quote := shellQuote
+	if goos == "windows" {
+		quote = cmdQuote
+	}
+	words := []string{quote(binary)}
+	for _, arg := range left {
+		if arg != "<" {
+			arg = quote(arg)
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ") + " |" + right
+}
+
+// shellQuote quotes s for sh: wrapped in single quotes, inside which nothing
+// is special. An embedded single quote closes the quoting, is added
+// backslash-escaped, and reopens it.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// cmdQuote quotes s for cmd.exe and the program's argument parser: wrapped
+// in double quotes, with embedded double quotes backslash-escaped. The
+// quotes protect spaces and the &, |, < and > operators, but cmd.exe still
+// expands %VAR% references inside them, so an argument containing such a
+// reference reaches the binary with the variable's value.
+func cmdQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
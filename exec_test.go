@@ -0,0 +1,51 @@
+package cobrashell
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPipelineScript_Posix(t *testing.T) {
+	got := pipelineScript("linux", "/usr/local/bin/app", []string{"get", "pods"}, " grep web")
+	want := "'/usr/local/bin/app' 'get' 'pods' | grep web"
+	if got != want {
+		t.Errorf("pipelineScript(linux) = %q, want %q", got, want)
+	}
+
+	got = pipelineScript("linux", "/bin/app", []string{"echo", "$HOME", "it's", "<", "in.txt"}, " wc -l")
+	want = `'/bin/app' 'echo' '$HOME' 'it'\''s' < 'in.txt' | wc -l`
+	if got != want {
+		t.Errorf("pipelineScript(linux) = %q, want %q", got, want)
+	}
+}
+
+func TestPipelineScript_Windows(t *testing.T) {
+	got := pipelineScript("windows", `C:\Program Files\app\app.exe`, []string{"get", "pods"}, " findstr web")
+	want := `"C:\Program Files\app\app.exe" "get" "pods" | findstr web`
+	if got != want {
+		t.Errorf("pipelineScript(windows) = %q, want %q", got, want)
+	}
+}
+
+func TestNewShellCommand_PlatformShell(t *testing.T) {
+	cmd := newShellCommand("echo hi")
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(cmd.Path)), ".exe")
+	want := "sh"
+	if runtime.GOOS == "windows" {
+		want = "cmd"
+	}
+	if name != want {
+		t.Errorf("newShellCommand uses %q, want %q on %s", name, want, runtime.GOOS)
+	}
+}
+
+func TestOutputBuffer_KeepsMostRecent(t *testing.T) {
+	b := &outputBuffer{limit: 8}
+	_, _ = b.Write([]byte("hello "))
+	_, _ = b.Write([]byte("world"))
+	if got := b.String(); got != "lo world" {
+		t.Errorf("outputBuffer = %q, want the last 8 bytes %q", got, "lo world")
+	}
+}
@@ -0,0 +1,67 @@
+package cobrashell
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// exitStatus is how a child process ran and ended.
+type exitStatus struct {
+	code   int    // exit code; 128+n when killed by signal n
+	signal string // signal name (e.g. "SIGKILL") when killed by a signal
+	pty    bool   // the child ran attached to a PTY
+}
+
+// statusFromWait converts the error returned by exec.Cmd.Wait or Run into an
+// exitStatus. A child killed by a signal reports 128+signal as its code, the
+// convention POSIX shells use, rather than the -1 of exec.ExitError.ExitCode.
+// Errors other than a non-zero exit are returned unchanged.
+func statusFromWait(err error) (exitStatus, error) {
+	if err == nil {
+		return exitStatus{}, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return exitStatus{}, err
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return exitStatus{code: 128 + int(ws.Signal()), signal: signalName(ws.Signal())}, nil
+	}
+	return exitStatus{code: exitErr.ExitCode()}, nil
+}
+
+// isSpawnFailure reports whether err, as returned by exec.Cmd.Run or
+// statusFromWait, means the binary could not be run at all (not found, not
+// executable, ...) rather than that it ran and ended unsuccessfully.
+func isSpawnFailure(err error) bool {
+	var exitErr *exec.ExitError
+	return err != nil && !errors.As(err, &exitErr)
+}
+
+// signalNames maps the signals a child is commonly killed by to their names.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// signalName returns the conventional name of sig, or "signal N" for
+// signals not in signalNames.
+func signalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
@@ -0,0 +1,26 @@
+package cobrashell
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestSignalName(t *testing.T) {
+	if got := signalName(syscall.SIGKILL); got != "SIGKILL" {
+		t.Errorf("signalName(SIGKILL) = %q, want SIGKILL", got)
+	}
+	if got := signalName(syscall.Signal(99)); got != "signal 99" {
+		t.Errorf("signalName(99) = %q, want %q", got, "signal 99")
+	}
+}
+
+func TestStatusFromWait_NonExitError(t *testing.T) {
+	want := errors.New("exec: not started")
+	if _, err := statusFromWait(want); err != want {
+		t.Errorf("statusFromWait(%v) error = %v, want it returned unchanged", want, err)
+	}
+	if status, err := statusFromWait(nil); err != nil || status != (exitStatus{}) {
+		t.Errorf("statusFromWait(nil) = %+v, %v; want zero status", status, err)
+	}
+}
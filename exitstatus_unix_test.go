@@ -0,0 +1,45 @@
+//go:build !windows
+
+package cobrashell
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExecute_SignaledChild(t *testing.T) {
+	var code int
+	var result ExecResult
+	s := &Shell{
+		cfg: Config{Hooks: Hooks{
+			AfterExec:       func(_ []string, c int) { code = c },
+			AfterExecResult: func(r ExecResult) { result = r },
+		}},
+		binary:     "/bin/sh",
+		sessionEnv: make(map[string]string),
+	}
+	s.execute(`-c 'kill -KILL $$'`)
+
+	if code != 128+9 {
+		t.Errorf("AfterExec exit code = %d, want %d", code, 128+9)
+	}
+	if result.ExitCode != 128+9 || result.Signal != "SIGKILL" {
+		t.Errorf("AfterExecResult result = %+v, want code 137 and SIGKILL", result)
+	}
+	if result.Duration <= 0 || result.Duration > time.Minute {
+		t.Errorf("AfterExecResult duration = %v, want a plausible positive value", result.Duration)
+	}
+}
+
+func TestExecute_NormalExitHasNoSignal(t *testing.T) {
+	var result ExecResult
+	s := &Shell{
+		cfg:        Config{Hooks: Hooks{AfterExecResult: func(r ExecResult) { result = r }}},
+		binary:     "/bin/sh",
+		sessionEnv: make(map[string]string),
+	}
+	s.execute(`-c 'exit 3'`)
+	if result.ExitCode != 3 || result.Signal != "" {
+		t.Errorf("AfterExecResult result = %+v, want code 3 and no signal", result)
+	}
+}
@@ -0,0 +1,133 @@
+package cobrashell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// explainBuiltinName is the command name of the explain built-in.
+const explainBuiltinName = "explain"
+
+// handleExplainBuiltin checks whether tokens[0] is the explain built-in and
+// Config.ExplainBuiltin is set. If so, it prints the explanation of the rest
+// of line and returns true.
+func (s *Shell) handleExplainBuiltin(line string, tokens []string) bool {
+	if !s.cfg.ExplainBuiltin || tokens[0] != explainBuiltinName {
+		return false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), explainBuiltinName))
+	if rest == "" {
+		s.writeErr("Error: requires a line to explain\n\nUsage:\n  %s LINE\n", explainBuiltinName)
+		return true
+	}
+	fmt.Fprint(s.stdout(), s.explain(rest))
+	return true
+}
+
+// explain describes how execute would run line: alias expansion, the
+// resolved binary, the final tokens, the file a "< file" redirection feeds
+// to stdin, and the environment additions. It has no
+// side effects.
+func (s *Shell) explain(line string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Input:    %s\n", line)
+
+	expanded := expandAliasLine(s.cfg.Aliases, line)
+	if expanded != line {
+		name := strings.Fields(line)[0]
+		fmt.Fprintf(&b, "Alias:    %s -> %s\n", name, s.cfg.Aliases[name])
+		fmt.Fprintf(&b, "Expanded: %s\n", expanded)
+	}
+
+	tokens, err := s.tokenize(expanded)
+	if err != nil {
+		fmt.Fprintf(&b, "Error:    parse error: %v\n", err)
+		return b.String()
+	}
+	if len(tokens) == 0 {
+		return b.String()
+	}
+	tokens = expandTilde(tokens)
+
+	if name, ok := s.builtinFor(tokens[0]); ok {
+		fmt.Fprintf(&b, "Built-in: %s (handled by the shell; the binary is not run)\n", name)
+		return b.String()
+	}
+
+	if len(s.contexts) > 0 {
+		tokens = s.withContext(tokens)
+		expanded = s.withContextLine(expanded)
+		fmt.Fprintf(&b, "Context:  %s\n", strings.Join(s.contextPrefix(), " "))
+	}
+
+	fmt.Fprintf(&b, "Binary:   %s\n", s.binary)
+	if hasPipe(tokens) {
+		fmt.Fprintf(&b, "Tokens:   %q\n", leftOfFirstPipe(tokens))
+		fmt.Fprintf(&b, "Pipeline: %s\n", pipelineScript(runtime.GOOS, s.binary, leftOfFirstPipe(tokens), afterNthPipe(expanded, 1)))
+	} else {
+		args, inputPath, err := splitInputRedirect(tokens)
+		if err != nil {
+			fmt.Fprintf(&b, "Error:    %v\n", err)
+			return b.String()
+		}
+		fmt.Fprintf(&b, "Tokens:   %q\n", args)
+		if inputPath != "" {
+			if s.cfg.WorkingDir != "" && !filepath.IsAbs(inputPath) {
+				inputPath = filepath.Join(s.cfg.WorkingDir, inputPath)
+			}
+			fmt.Fprintf(&b, "Stdin:    %s\n", inputPath)
+		}
+	}
+
+	added := s.envAdditions()
+	if len(added) == 0 {
+		fmt.Fprintf(&b, "Env:      inherited unchanged\n")
+	} else {
+		fmt.Fprintf(&b, "Env:      inherited, plus:\n")
+		for _, kv := range added {
+			fmt.Fprintf(&b, "  %s\n", kv)
+		}
+	}
+	return b.String()
+}
+
+// builtinFor reports whether name invokes an enabled built-in.
+func (s *Shell) builtinFor(name string) (string, bool) {
+	for _, b := range s.builtins() {
+		if b.name == name {
+			return b.name, true
+		}
+	}
+	return "", false
+}
+
+// envAdditions returns the KEY=VALUE entries buildEnv adds to or changes
+// relative to os.Environ, sorted by key. Later entries win, as they do for
+// the subprocess.
+func (s *Shell) envAdditions() []string {
+	base := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			base[k] = v
+		}
+	}
+	final := make(map[string]string)
+	for _, kv := range s.buildEnv() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			final[k] = v
+		}
+	}
+
+	var added []string
+	for k, v := range final {
+		if old, ok := base[k]; !ok || old != v {
+			added = append(added, k+"="+v)
+		}
+	}
+	sort.Strings(added)
+	return added
+}
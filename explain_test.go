@@ -0,0 +1,102 @@
+package cobrashell
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func makeExplainShell() *Shell {
+	return &Shell{
+		cfg: Config{
+			ExplainBuiltin: true,
+			Aliases:        map[string]string{"gp": "get pods"},
+			Env:            []string{"COBRA_SHELL_EXPLAIN_TEST=1"},
+		},
+		binary:     "/usr/local/bin/kubectl",
+		sessionEnv: map[string]string{"NAMESPACE": "prod"},
+	}
+}
+
+func TestExplain_AliasBinaryAndTokens(t *testing.T) {
+	out := makeExplainShell().explain("gp -n 'kube system'")
+	for _, want := range []string{
+		"gp -> get pods",
+		"Expanded: get pods -n 'kube system'",
+		"Binary:   /usr/local/bin/kubectl",
+		`Tokens:   ["get" "pods" "-n" "kube system"]`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("explain output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_EnvAdditions(t *testing.T) {
+	out := makeExplainShell().explain("version")
+	for _, want := range []string{"COBRA_SHELL_EXPLAIN_TEST=1", "NAMESPACE=prod"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("explain output missing env entry %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Alias:") {
+		t.Errorf("explain output reports an alias for a plain command:\n%s", out)
+	}
+}
+
+func TestExplain_Pipeline(t *testing.T) {
+	out := makeExplainShell().explain("get pods | grep web")
+	if !strings.Contains(out, `Tokens:   ["get" "pods"]`) || !strings.Contains(out, "Pipeline:") {
+		t.Errorf("explain output for pipeline:\n%s", out)
+	}
+}
+
+func TestExplain_Builtin(t *testing.T) {
+	s := makeExplainShell()
+	s.cfg.EnvBuiltin = "env"
+	out := s.explain("env list")
+	if !strings.Contains(out, "Built-in: env") || strings.Contains(out, "Binary:") {
+		t.Errorf("explain output for built-in:\n%s", out)
+	}
+}
+
+func TestHandleExplainBuiltin(t *testing.T) {
+	s := makeExplainShell()
+	var handled bool
+	out := captureStdout(t, func() {
+		handled = s.handleExplainBuiltin("explain gp", []string{"explain", "gp"})
+	})
+	if !handled || !strings.Contains(out, "get pods") {
+		t.Errorf("handled = %v, output = %q", handled, out)
+	}
+
+	s.cfg.ExplainBuiltin = false
+	if s.handleExplainBuiltin("explain gp", []string{"explain", "gp"}) {
+		t.Error("handleExplainBuiltin should return false when ExplainBuiltin is off")
+	}
+}
+
+func TestExplain_TildeExpanded(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	out := makeExplainShell().explain("get ~/x ~")
+	if want := fmt.Sprintf("Tokens:   %q", []string{"get", home + "/x", home}); !strings.Contains(out, want) {
+		t.Errorf("explain output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_InputRedirect(t *testing.T) {
+	s := makeExplainShell()
+	s.cfg.WorkingDir = "/srv"
+	out := s.explain("apply -f - < in.txt")
+	for _, want := range []string{`Tokens:   ["apply" "-f" "-"]`, "Stdin:    " + filepath.Join("/srv", "in.txt")} {
+		if !strings.Contains(out, want) {
+			t.Errorf("explain output missing %q:\n%s", want, out)
+		}
+	}
+	if out := s.explain("apply <"); !strings.Contains(out, "Error:    missing file name after <") {
+		t.Errorf("explain output for a bad redirection:\n%s", out)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 	"os/exec"
+	"regexp"
 	"strings"
 )
 
@@ -15,12 +16,13 @@ import (
 // The returned directive is always 0 (Default); there is no directive line in
 // --help output to parse.
 func (c *completer) helpFallback(contextArgs []string, toComplete string) ([]string, int) {
-	args := append(contextArgs, "--help")
+	args := helpArgs(contextArgs)
 
 	ctx, cancel := context.WithTimeout(context.Background(), c.shell.cfg.CompletionTimeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, c.shell.binary, args...)
+	cmd.Dir = c.shell.cfg.WorkingDir
 	cmd.Env = c.shell.buildEnv()
 	cmd.Stderr = io.Discard
 
@@ -30,14 +32,35 @@ func (c *completer) helpFallback(contextArgs []string, toComplete string) ([]str
 	cmd.Stdout = &buf
 	_ = cmd.Run()
 
-	return parseHelp(buf.String(), toComplete), 0
+	candidates := parseHelp(buf.String(), toComplete)
+	if c.shell.cfg.HelpUsageEnums && !strings.HasPrefix(toComplete, "-") {
+		for _, v := range parseUsageEnums(buf.String()) {
+			if strings.HasPrefix(v, toComplete) {
+				candidates = append(candidates, v)
+			}
+		}
+	}
+	return candidates, 0
+}
+
+// helpArgs returns the arguments for asking the binary for the help of the
+// command addressed by contextArgs: contextArgs followed by "--help", in a
+// new slice. Appending to contextArgs directly could write "--help" into
+// spare capacity of the caller's backing array.
+func helpArgs(contextArgs []string) []string {
+	return append(append([]string{}, contextArgs...), "--help")
 }
 
 // parseHelp extracts completion candidates from Cobra's --help output.
 //
-// It recognises the standard Cobra help template section headers:
-//   - "Available Commands:" / "Commands:" → yields subcommand names
-//   - "Flags:" / "Global Flags:"          → yields --flag-name tokens
+// A section starts at an unindented header ending in ":", matched without
+// regard to case, so that the help of nested commands and of non-Cobra tools
+// whose format differs from level to level is read alike:
+//   - "Available Commands:", "Commands:", any other "... Commands:" group,
+//     and "Subcommands:"      → yields subcommand names ("name," entries,
+//     as in "remote, r", lose the comma)
+//   - "Flags:", "Global Flags:", "Options:", "Global Options:"
+//     → yields --flag-name tokens and their -s shorthands
 //
 // Parsing is heuristic: it handles the default Cobra template reliably but
 // may produce incomplete results for heavily customised templates. It cannot
@@ -68,12 +91,13 @@ func parseHelp(output, toComplete string) []string {
 
 		if indent == 0 {
 			// Unindented lines are section headers or other prose.
+			header := strings.ToLower(strings.TrimSpace(stripped))
 			switch {
-			case strings.HasPrefix(stripped, "Available Commands:"),
-				strings.HasPrefix(stripped, "Commands:"):
+			case !strings.HasSuffix(header, ":"):
+				cur = secNone
+			case strings.HasSuffix(header, "commands:"), header == "subcommands:":
 				cur = secCommands
-			case strings.HasPrefix(stripped, "Flags:"),
-				strings.HasPrefix(stripped, "Global Flags:"):
+			case strings.HasSuffix(header, "flags:"), strings.HasSuffix(header, "options:"):
 				cur = secFlags
 			default:
 				cur = secNone
@@ -85,20 +109,29 @@ func parseHelp(output, toComplete string) []string {
 		switch cur {
 		case secCommands:
 			// Format: "  subcommand   Short description"
+			//      or "  subcommand, alias   Short description"
 			if fields := strings.Fields(stripped); len(fields) > 0 {
-				candidates = append(candidates, fields[0])
+				candidates = append(candidates, strings.TrimSuffix(fields[0], ","))
 			}
 
 		case secFlags:
 			// Format: "  -s, --longflag type   Description"
 			//      or "      --longflag type   Description"
-			// Grab the first token that starts with "--".
+			//      or "  -s   Description"
+			// Collect leading "-s" shorthands up to the first token that
+			// starts with "--", which is the last one taken. Scanning stops
+			// at the first other token, so dashes in the description are
+			// never mistaken for flags.
 			for _, field := range strings.Fields(stripped) {
-				f := strings.TrimRight(field, ",")
+				f := strings.TrimSuffix(field, ",")
 				if strings.HasPrefix(f, "--") {
 					candidates = append(candidates, f)
 					break
 				}
+				if !isShorthandToken(f) {
+					break
+				}
+				candidates = append(candidates, f)
 			}
 		}
 	}
@@ -115,3 +148,41 @@ func parseHelp(output, toComplete string) []string {
 	}
 	return filtered
 }
+
+// usageEnum matches a brace group of two or more "|"-separated values, such
+// as "{fast|slow}".
+var usageEnum = regexp.MustCompile(`\{([^{}|\s]+(?:\|[^{}|\s]+)+)\}`)
+
+// parseUsageEnums returns the values of the brace groups (see usageEnum) in
+// the Usage: section of --help output, in order of appearance. The section
+// is the "Usage:" line itself and the indented lines that follow it.
+func parseUsageEnums(output string) []string {
+	var values []string
+	inUsage := false
+	for _, line := range strings.Split(output, "\n") {
+		stripped := strings.TrimLeft(line, " \t")
+		switch {
+		case strings.HasPrefix(line, "Usage:"):
+			inUsage = true
+		case stripped == "" || len(stripped) == len(line):
+			inUsage = false
+		}
+		if !inUsage {
+			continue
+		}
+		for _, m := range usageEnum.FindAllStringSubmatch(line, -1) {
+			values = append(values, strings.Split(m[1], "|")...)
+		}
+	}
+	return values
+}
+
+// isShorthandToken reports whether tok is a shorthand flag such as "-p": a
+// dash followed by a single ASCII letter.
+func isShorthandToken(tok string) bool {
+	if len(tok) != 2 || tok[0] != '-' {
+		return false
+	}
+	c := tok[1]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
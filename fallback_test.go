@@ -1,6 +1,9 @@
 package cobrashell
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -33,7 +36,7 @@ func TestParseHelp_AllCandidates(t *testing.T) {
 	got := parseHelp(cobraHelp, "")
 	want := []string{
 		"completion", "help", "serve", "version",
-		"--help", "--port", "--verbose", "--config",
+		"-h", "--help", "-p", "--port", "--verbose", "-c", "--config",
 		"--debug",
 	}
 	assertSameElements(t, got, want)
@@ -98,7 +101,22 @@ Flags:
   -h, --help  help for tool
 `
 	got := parseHelp(help, "")
-	assertSameElements(t, got, []string{"foo", "bar", "--help"})
+	assertSameElements(t, got, []string{"foo", "bar", "-h", "--help"})
+}
+
+func TestParseHelp_Shorthands(t *testing.T) {
+	assertSameElements(t, parseHelp(cobraHelp, "-"),
+		[]string{"-h", "--help", "-p", "--port", "--verbose", "-c", "--config", "--debug"})
+	assertSameElements(t, parseHelp(cobraHelp, "-p"), []string{"-p"})
+}
+
+func TestParseHelp_ShorthandOnlyAndProseDashes(t *testing.T) {
+	help := `Flags:
+  -v              verbose output - same as -x
+  -n, --dry-run   do nothing -- just print
+      --level int set the level (-1 disables)
+`
+	assertSameElements(t, parseHelp(help, ""), []string{"-v", "-n", "--dry-run", "--level"})
 }
 
 // assertSameElements checks that got contains exactly the elements in want,
@@ -125,3 +143,218 @@ func assertSameElements(t *testing.T, got, want []string) {
 		}
 	}
 }
+
+// writeLoggingBinary writes a shell script that appends its arguments to a
+// log file and then either runs target with them or, when target is empty,
+// exits 1 as a binary without __completeNoDesc support would. It returns the
+// script and log paths.
+func writeLoggingBinary(t *testing.T, target string) (script, log string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	script = filepath.Join(dir, "fakebin")
+	log = filepath.Join(dir, "invocations.log")
+	body := "#!/bin/sh\necho \"$@\" >> '" + log + "'\n"
+	if target != "" {
+		body += "exec '" + target + "' \"$@\"\n"
+	} else {
+		body += "exit 1\n"
+	}
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script, log
+}
+
+func invokedWithHelp(t *testing.T, log string) bool {
+	t.Helper()
+	b, err := os.ReadFile(log)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Contains(string(b), "--help")
+}
+
+func TestComplete_DisableHelpFallback_NoHelpSpawn(t *testing.T) {
+	script, log := writeLoggingBinary(t, "")
+	s := &Shell{cfg: Config{CompletionTimeout: defaultCompletionTimeout, DisableHelpFallback: true}, binary: script}
+	c := &completer{shell: s}
+
+	if got, _ := c.complete(nil, ""); len(got) != 0 {
+		t.Errorf("complete = %v, want no candidates", got)
+	}
+	if invokedWithHelp(t, log) {
+		t.Error("binary was run with --help although DisableHelpFallback is set")
+	}
+
+	s.cfg.DisableHelpFallback = false
+	c.complete(nil, "")
+	if !invokedWithHelp(t, log) {
+		t.Error("binary was not run with --help with the fallback enabled")
+	}
+}
+
+func TestIntegration_Complete_EmptyResultNoHelpSpawn(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+	s := &Shell{cfg: Config{CompletionTimeout: defaultCompletionTimeout, DisableHelpFallback: true}, binary: script}
+	c := &completer{shell: s}
+
+	if got, _ := c.complete(nil, "xyz"); len(got) != 0 {
+		t.Errorf("complete(nil, 'xyz') = %v, want no candidates", got)
+	}
+	if invokedWithHelp(t, log) {
+		t.Error("binary was run with --help for an empty __completeNoDesc result")
+	}
+}
+
+// enumHelp is --help output of a non-Cobra tool that lists its positional
+// values in the usage line.
+const enumHelp = `Usage: app mode {fast|slow|safe} [--level {1|2}]
+       app reset
+
+Set the operating mode. Example: {not|usage}
+
+Flags:
+  --force   Skip checks
+`
+
+func TestParseUsageEnums(t *testing.T) {
+	got := parseUsageEnums(enumHelp)
+	want := []string{"fast", "slow", "safe", "1", "2"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("parseUsageEnums = %v, want %v", got, want)
+	}
+	if got := parseUsageEnums(cobraHelp); len(got) != 0 {
+		t.Errorf("parseUsageEnums(cobraHelp) = %v, want none", got)
+	}
+}
+
+func TestHelpFallback_UsageEnums(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	script := filepath.Join(t.TempDir(), "app")
+	body := "#!/bin/sh\ncase \"$*\" in *--help*) cat <<'EOF'\n" + enumHelp + "EOF\n;; esac\nexit 1\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := &Shell{cfg: Config{CompletionTimeout: defaultCompletionTimeout, HelpUsageEnums: true}, binary: script}
+	c := &completer{shell: s}
+
+	got, _ := c.complete([]string{"mode"}, "s")
+	assertSameElements(t, got, []string{"slow", "safe"})
+	got, _ = c.complete([]string{"mode"}, "--")
+	assertSameElements(t, got, []string{"--force"})
+
+	s.cfg.HelpUsageEnums = false
+	if got, _ := c.complete([]string{"mode"}, "s"); len(got) != 0 {
+		t.Errorf("without HelpUsageEnums, complete = %v, want none", got)
+	}
+}
+
+func TestHelpArgs_DoesNotAliasContextArgs(t *testing.T) {
+	backing := make([]string, 2, 4)
+	backing[0], backing[1] = "remote", "add"
+	contextArgs := backing[:1]
+
+	got := helpArgs(contextArgs)
+	if strings.Join(got, " ") != "remote --help" {
+		t.Errorf("helpArgs = %q, want [remote --help]", got)
+	}
+	if backing[1] != "add" {
+		t.Errorf("helpArgs wrote %q into the caller's spare capacity", backing[1])
+	}
+	got[0] = "changed"
+	if contextArgs[0] != "remote" {
+		t.Error("helpArgs result shares the caller's backing array")
+	}
+}
+
+func TestHelpFallback_RepeatedCallsKeepContextArgs(t *testing.T) {
+	script, log := writeLoggingBinary(t, "")
+	s := &Shell{cfg: Config{CompletionTimeout: defaultCompletionTimeout}, binary: script}
+	c := &completer{shell: s}
+
+	backing := []string{"remote", "add", "sentinel"}
+	contextArgs := backing[:2]
+	for range 2 {
+		c.helpFallback(contextArgs, "")
+		if got := strings.Join(backing, " "); got != "remote add sentinel" {
+			t.Fatalf("after helpFallback, backing array = %q, want it unchanged", got)
+		}
+	}
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "remote add --help\nremote add --help\n" {
+		t.Errorf("invocations = %q, want two identical --help runs", got)
+	}
+}
+
+// nestedHelp is the --help output of a non-Cobra tool at each level of its
+// command tree, each level in a different style.
+var nestedHelp = map[string]string{
+	"--help": `Usage: tool <command>
+
+COMMANDS:
+   remote, r  Manage remotes
+   status     Show status
+
+GLOBAL OPTIONS:
+   --verbose  Be verbose
+`,
+	"remote --help": `Usage: tool remote <command>
+
+Subcommands:
+  add     Add a remote
+  remove  Remove a remote
+
+Options:
+  -n, --dry-run  Show what would change
+`,
+	"remote add --help": `Usage: tool remote add NAME URL
+
+Flags:
+      --fetch   Fetch after adding
+`,
+}
+
+func TestParseHelp_HeaderStyles(t *testing.T) {
+	assertSameElements(t, parseHelp(nestedHelp["--help"], ""), []string{"remote", "status", "--verbose"})
+	assertSameElements(t, parseHelp(nestedHelp["remote --help"], ""), []string{"add", "remove", "-n", "--dry-run"})
+
+	// "Usage:" and "Examples:" are not candidate sections.
+	if got := parseHelp("Examples:\n  tool status\n", ""); len(got) != 0 {
+		t.Errorf("parseHelp(Examples:) = %v, want none", got)
+	}
+}
+
+func TestHelpFallback_Nested(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	body := "#!/bin/sh\ncase \"$*\" in\n"
+	for args, help := range nestedHelp {
+		body += "'" + args + "') cat <<'EOF'\n" + help + "EOF\n;;\n"
+	}
+	body += "esac\nexit 1\n"
+	script := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := &Shell{cfg: Config{CompletionTimeout: defaultCompletionTimeout}, binary: script}
+	c := &completer{shell: s}
+
+	got, _ := c.complete(nil, "")
+	assertSameElements(t, got, []string{"remote", "status", "--verbose"})
+	got, _ = c.complete([]string{"remote"}, "re")
+	assertSameElements(t, got, []string{"remove"})
+	got, _ = c.complete([]string{"remote", "add"}, "--")
+	assertSameElements(t, got, []string{"--fetch"})
+}
@@ -0,0 +1,78 @@
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileCandidates lists the local filesystem entries that complete
+// toComplete, the way a shell completes a path. toComplete is split at its
+// last "/" into a directory part and a name prefix. A relative directory
+// part, or none at all, is resolved against base, which callers set to
+// Config.WorkingDir; an empty base means the process's working directory.
+// The entries of that directory starting with the prefix are returned with
+// the directory part kept, so every candidate extends toComplete.
+// Directories get a trailing "/" so that a further Tab descends into them.
+//
+// Hidden entries are offered only when the prefix itself starts with ".".
+// When dirsOnly is set, only directories are returned; when exts is
+// non-empty, files must have one of the listed extensions (given without the
+// leading dot) while directories are always kept.
+func fileCandidates(base, toComplete string, dirsOnly bool, exts []string) []string {
+	dir, prefix := "", toComplete
+	if i := strings.LastIndex(toComplete, "/"); i >= 0 {
+		dir, prefix = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	readDir := "."
+	if dir != "" {
+		readDir = expandTilde([]string{dir})[0]
+	}
+	if base != "" && !filepath.IsAbs(readDir) {
+		readDir = filepath.Join(base, readDir)
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		isDir := e.IsDir()
+		if !isDir && e.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		switch {
+		case isDir:
+			candidates = append(candidates, dir+name+"/")
+		case dirsOnly:
+		case len(exts) > 0 && !hasExtension(name, exts):
+		default:
+			candidates = append(candidates, dir+name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// hasExtension reports whether name ends in "." followed by one of exts.
+func hasExtension(name string, exts []string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	for _, e := range exts {
+		if ext == strings.TrimPrefix(e, ".") && ext != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeFileTree creates a small directory tree in a temp dir and changes the
+// working directory to it for the duration of the test.
+func makeFileTree(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range []string{"app.yaml", "app.json", "notes.txt", ".hidden", "conf/dev.yaml"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+}
+
+func TestFileCandidates(t *testing.T) {
+	makeFileTree(t)
+	cases := []struct {
+		toComplete string
+		dirsOnly   bool
+		exts       []string
+		want       []string
+	}{
+		{"", false, nil, []string{"app.json", "app.yaml", "conf/", "notes.txt"}},
+		{"app", false, nil, []string{"app.json", "app.yaml"}},
+		{".", false, nil, []string{".hidden"}},
+		{"conf/", false, nil, []string{"conf/dev.yaml"}},
+		{"", true, nil, []string{"conf/"}},
+		{"", false, []string{"yaml"}, []string{"app.yaml", "conf/"}},
+		{"missing/", false, nil, nil},
+	}
+	for _, tc := range cases {
+		got := fileCandidates("", tc.toComplete, tc.dirsOnly, tc.exts)
+		assertSameElements(t, got, tc.want)
+	}
+}
+
+func TestFileCandidates_BaseDir(t *testing.T) {
+	makeFileTree(t)
+	base, _ := os.Getwd()
+	t.Chdir(t.TempDir())
+
+	assertSameElements(t, fileCandidates(base, "app", false, nil), []string{"app.json", "app.yaml"})
+	assertSameElements(t, fileCandidates(base, "conf/", false, nil), []string{"conf/dev.yaml"})
+	abs := filepath.Join(base, "conf") + "/"
+	assertSameElements(t, fileCandidates("/nonexistent", abs, false, nil), []string{abs + "dev.yaml"})
+}
+
+func TestFileFallback(t *testing.T) {
+	makeFileTree(t)
+	if got := fileFallback("", nil, compDirectiveNoFileComp, "app"); len(got) != 0 {
+		t.Errorf("NoFileComp: got %v, want none", got)
+	}
+	if got := fileFallback("", []string{"start"}, 0, ""); len(got) != 1 || got[0] != "start" {
+		t.Errorf("non-empty candidates: got %v, want [start]", got)
+	}
+	assertSameElements(t, fileFallback("", []string{"json"}, compDirectiveFilterExt, "app"), []string{"app.json"})
+	assertSameElements(t, fileFallback("", nil, compDirectiveFilterDirs, ""), []string{"conf/"})
+}
+
+func TestIntegration_CompleterDo_LocalFiles(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	makeFileTree(t)
+	c := &completer{shell: newIntegrationShell()}
+
+	line := []rune("greet --config app.")
+	candidates, length := c.Do(line, len(line))
+	if length != len("app.") {
+		t.Errorf("length = %d, want %d", length, len("app."))
+	}
+	got := make([]string, len(candidates))
+	for i, cand := range candidates {
+		got[i] = string(cand)
+	}
+	assertSameElements(t, got, []string{"json", "yaml"})
+
+	// Subcommand completion carries NoFileComp; no files are mixed in.
+	line = []rune("serve ")
+	candidates, _ = c.Do(line, len(line))
+	for _, cand := range candidates {
+		if s := string(cand); s != "start" && s != "stop" {
+			t.Errorf("unexpected candidate %q for subcommand completion", s)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cobrashell
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// flagValueCacheTTL is how long the output of a FlagValueCommands command is
+// reused before the command is run again.
+const flagValueCacheTTL = 10 * time.Second
+
+// flagValueEntry is a cached FlagValueCommands result.
+type flagValueEntry struct {
+	values []string
+	at     time.Time
+}
+
+// flagValueHints returns the values for the word being completed when it is
+// the value of a flag listed in Config.FlagValueCommands: either the previous
+// argument is that flag, or toComplete is "--flag=...". The values are the
+// non-empty stdout lines of running the mapped command against the binary,
+// filtered by the partial value; for "--flag=..." each keeps the "--flag="
+// prefix. ok is false when the word is not such a value or the command
+// fails, in which case normal completion applies.
+func (c *completer) flagValueHints(contextArgs []string, toComplete string) (hints []string, ok bool) {
+	if len(c.shell.cfg.FlagValueCommands) == 0 {
+		return nil, false
+	}
+
+	var flag, prefix, value string
+	switch {
+	case strings.HasPrefix(toComplete, "-") && strings.Contains(toComplete, "="):
+		flag, value, _ = strings.Cut(toComplete, "=")
+		prefix = flag + "="
+	case len(contextArgs) > 0 && !strings.HasPrefix(toComplete, "-"):
+		flag, value = contextArgs[len(contextArgs)-1], toComplete
+	default:
+		return nil, false
+	}
+	args := c.flagValueCommand(flag)
+	if args == nil {
+		return nil, false
+	}
+
+	values, ok := c.runFlagValueCommand(args)
+	if !ok {
+		return nil, false
+	}
+	for _, v := range values {
+		if strings.HasPrefix(v, value) {
+			hints = append(hints, prefix+v)
+		}
+	}
+	return hints, true
+}
+
+// flagValueCommand returns the FlagValueCommands entry for the long flag
+// arg, or nil when there is none.
+func (c *completer) flagValueCommand(arg string) []string {
+	for name, args := range c.shell.cfg.FlagValueCommands {
+		if isNamedFlag([]string{name}, arg) && len(args) > 0 {
+			return args
+		}
+	}
+	return nil
+}
+
+// runFlagValueCommand runs args against the binary, bounded by
+// CompletionTimeout, and returns its non-empty stdout lines. Results are
+// reused for flagValueCacheTTL while the binary stays the same. ok is false
+// when the command fails.
+func (c *completer) runFlagValueCommand(args []string) (values []string, ok bool) {
+	key := c.shell.binary + "\x00" + strings.Join(args, "\x00")
+	if e, found := c.flagValues[key]; found && time.Since(e.at) < flagValueCacheTTL {
+		return e.values, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.shell.cfg.CompletionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.shell.binary, args...)
+	cmd.Dir = c.shell.cfg.WorkingDir
+	cmd.Env = c.shell.buildEnv()
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, false
+	}
+
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			values = append(values, line)
+		}
+	}
+	if c.flagValues == nil {
+		c.flagValues = make(map[string]flagValueEntry)
+	}
+	c.flagValues[key] = flagValueEntry{values: values, at: time.Now()}
+	return values, true
+}
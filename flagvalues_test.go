@@ -0,0 +1,91 @@
+package cobrashell
+
+import "testing"
+
+func TestIntegration_FlagValueCommands(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.FlagValueCommands = map[string][]string{"--name": {"echo", "alice", "bob", "", "albert"}}
+	c := &completer{shell: sh}
+
+	line := []rune("greet --name ")
+	got, _ := c.Do(line, len(line))
+	assertSameElements(t, runesToStrings(got), []string{"alice", "bob", "albert"})
+
+	line = []rune("greet --name al")
+	got, length := c.Do(line, len(line))
+	if length != 2 {
+		t.Errorf("length = %d, want 2", length)
+	}
+	assertSameElements(t, runesToStrings(got), []string{"ice", "bert"})
+
+	line = []rune("greet --name=b")
+	got, _ = c.Do(line, len(line))
+	assertSameElements(t, runesToStrings(got), []string{"ob"})
+}
+
+func TestFlagValueCommands_Cached(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+	sh := newIntegrationShell()
+	sh.binary = script
+	sh.cfg.FlagValueCommands = map[string][]string{"name": {"echo", "alice"}}
+	c := &completer{shell: sh}
+
+	for range 3 {
+		if got, ok := c.flagValueHints([]string{"greet", "--name"}, ""); !ok || len(got) != 1 {
+			t.Fatalf("flagValueHints = %v, %v; want [alice]", got, ok)
+		}
+	}
+	if n := countInvocations(t, log); n != 1 {
+		t.Errorf("value command ran %d times, want 1 (cached)", n)
+	}
+}
+
+func TestFlagValueCommands_CachedPerBinary(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	first, _ := writeLoggingBinary(t, testBinary)
+	second, log := writeLoggingBinary(t, testBinary)
+	sh := newIntegrationShell()
+	sh.binary = first
+	sh.cfg.FlagValueCommands = map[string][]string{"name": {"echo", "alice"}}
+	c := &completer{shell: sh}
+
+	c.flagValueHints([]string{"greet", "--name"}, "")
+	sh.switchBinary(second)
+	if got, ok := c.flagValueHints([]string{"greet", "--name"}, ""); !ok || len(got) != 1 {
+		t.Fatalf("flagValueHints = %v, %v; want [alice]", got, ok)
+	}
+	if n := countInvocations(t, log); n != 1 {
+		t.Errorf("value command ran %d times against the new binary, want 1", n)
+	}
+}
+
+func TestFlagValueCommands_FailureFallsBack(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.FlagValueCommands = map[string][]string{"name": {"fail"}}
+	c := &completer{shell: sh}
+	if _, ok := c.flagValueHints([]string{"greet", "--name"}, ""); ok {
+		t.Error("a failing value command should fall back to normal completion")
+	}
+	if _, ok := c.flagValueHints([]string{"greet", "--other"}, ""); ok {
+		t.Error("an unmapped flag should use normal completion")
+	}
+}
+
+func runesToStrings(rs [][]rune) []string {
+	out := make([]string, len(rs))
+	for i, r := range rs {
+		out[i] = string(r)
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package cobrashell
+
+import (
+	"errors"
+	"strings"
+)
+
+// preprocess applies Config.PreprocessLine, or history expansion when
+// Config.HistoryExpansion is set, to a raw input line and remembers the result
+// as the previous line for the next call. It returns "" when expansion fails,
+// after reporting the error.
+func (s *Shell) preprocess(line string) string {
+	switch {
+	case s.cfg.PreprocessLine != nil:
+		line = s.cfg.PreprocessLine(line, s.prevLine)
+	case s.cfg.HistoryExpansion:
+		expanded, err := s.expandHistory(line, s.prevLine)
+		if err != nil {
+			s.writeErr("cobra-shell: %v\n", err)
+			s.lastExitCode = 1
+			return ""
+		}
+		line = expanded
+	}
+	if strings.TrimSpace(line) != "" {
+		s.prevLine = line
+	}
+	return line
+}
+
+// expandHistory replaces "!!" in line with prev, the previous command line,
+// and "!$" with the last argument of prev, as bash's history expansion does.
+// Designators inside single quotes or escaped with a backslash are left
+// alone. Expanding either with no previous line is an error.
+func (s *Shell) expandHistory(line, prev string) (string, error) {
+	if !strings.Contains(line, "!!") && !strings.Contains(line, "!$") {
+		return line, nil
+	}
+
+	var b strings.Builder
+	inSingle := false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '\\' && !inSingle && i+1 < len(line):
+			b.WriteByte(ch)
+			b.WriteByte(line[i+1])
+			i++
+			continue
+		case ch == '\'':
+			inSingle = !inSingle
+		case !inSingle && ch == '!' && i+1 < len(line) && (line[i+1] == '!' || line[i+1] == '$'):
+			if prev == "" {
+				return "", errors.New(line[i:i+2] + ": event not found")
+			}
+			if line[i+1] == '!' {
+				b.WriteString(prev)
+			} else {
+				b.WriteString(s.lastArg(prev))
+			}
+			i++
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String(), nil
+}
+
+// lastArg returns the last argument of line, quoted when it would otherwise
+// be split or unquoted again. It returns "" when line does not parse.
+func (s *Shell) lastArg(line string) string {
+	tokens, err := s.tokenize(line)
+	if err != nil || len(tokens) == 0 {
+		return ""
+	}
+	last := tokens[len(tokens)-1]
+	if last == "" || strings.ContainsAny(last, " \t\n'\"\\") {
+		return shellQuote(last)
+	}
+	return last
+}
@@ -0,0 +1,78 @@
+package cobrashell
+
+import (
+	"testing"
+)
+
+func TestExpandHistory(t *testing.T) {
+	s := &Shell{}
+	const prev = "greet --name bob"
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"!!", "greet --name bob"},
+		{"!! --verbose", "greet --name bob --verbose"},
+		{"echo !$", "echo bob"},
+		{"echo !$ !!", "echo bob greet --name bob"},
+		{"echo '!!'", "echo '!!'"},
+		{`echo \!!`, `echo \!!`},
+		{"echo ! !x", "echo ! !x"},
+		{"greet", "greet"},
+	}
+	for _, tt := range tests {
+		got, err := s.expandHistory(tt.line, prev)
+		if err != nil {
+			t.Errorf("expandHistory(%q): %v", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expandHistory(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestExpandHistory_QuotesLastArg(t *testing.T) {
+	s := &Shell{}
+	got, err := s.expandHistory("echo !$", `greet --name "bob smith"`)
+	if err != nil || got != "echo 'bob smith'" {
+		t.Errorf("expandHistory = %q, %v; want %q", got, err, "echo 'bob smith'")
+	}
+}
+
+func TestExpandHistory_NoPreviousLine(t *testing.T) {
+	s := &Shell{}
+	for _, line := range []string{"!!", "echo !$"} {
+		if _, err := s.expandHistory(line, ""); err == nil {
+			t.Errorf("expandHistory(%q) with no previous line returned nil error", line)
+		}
+	}
+}
+
+func TestPreprocess_HookReceivesPreviousLine(t *testing.T) {
+	var prevs []string
+	s := &Shell{cfg: Config{
+		HistoryExpansion: true, // ignored in favour of the hook
+		PreprocessLine: func(line, prev string) string {
+			prevs = append(prevs, prev)
+			if line == "skip" {
+				return ""
+			}
+			return line + " --x"
+		},
+	}}
+	s.preprocess("a")
+	s.preprocess("skip")
+	if got := s.preprocess("!!"); got != "!! --x" {
+		t.Errorf("preprocess(!!) = %q, want the hook's result", got)
+	}
+	want := []string{"", "a --x", "a --x"}
+	if len(prevs) != len(want) {
+		t.Fatalf("hook saw prev %q, want %q", prevs, want)
+	}
+	for i := range want {
+		if prevs[i] != want[i] {
+			t.Errorf("hook call %d: prev = %q, want %q", i, prevs[i], want[i])
+		}
+	}
+}
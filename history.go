@@ -0,0 +1,138 @@
+package cobrashell
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// readHistoryFile returns the non-empty lines of the history file at path, in
+// file order. A missing or unreadable file yields no entries.
+func readHistoryFile(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries
+}
+
+// readHistoryFiles concatenates the entries of every file in paths, in order.
+func readHistoryFiles(paths []string) []string {
+	var entries []string
+	for _, p := range paths {
+		entries = append(entries, readHistoryFile(p)...)
+	}
+	return entries
+}
+
+// mergeHistory removes duplicate entries, keeping each at its last (most
+// recent) position, and otherwise preserves order.
+func mergeHistory(entries []string) []string {
+	last := make(map[string]int, len(entries))
+	for i, e := range entries {
+		last[e] = i
+	}
+	merged := make([]string, 0, len(last))
+	for i, e := range entries {
+		if last[e] == i {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+// mergeHistoryFiles rewrites historyFile so that it contains the entries of
+// the additional files followed by its own entries, deduplicated by
+// mergeHistory. The additional files are only read. The file is replaced
+// atomically via a temporary file so an interrupted merge never truncates
+// the user's history; a symlink is followed and the file it points to is
+// replaced. A historyFile that is not a regular file, such as os.DevNull or
+// a dangling symlink, is left alone and merged is false.
+func mergeHistoryFiles(historyFile string, additional []string) (merged bool, err error) {
+	if target, err := filepath.EvalSymlinks(historyFile); err == nil {
+		historyFile = target
+	}
+	if info, err := os.Lstat(historyFile); err == nil && !info.Mode().IsRegular() {
+		return false, nil
+	}
+	entries := append(readHistoryFiles(additional), readHistoryFile(historyFile)...)
+	if err := writeHistoryFile(historyFile, mergeHistory(entries)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeHistoryFile replaces the contents of historyFile with entries, one per
+// line, keeping the file's permissions when it exists.
+func writeHistoryFile(historyFile string, entries []string) error {
+	perm := fs.FileMode(0o600)
+	if info, err := os.Stat(historyFile); err == nil {
+		perm = info.Mode().Perm()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	tmp := historyFile + ".merge"
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(tmp, []byte(b.String()), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, historyFile)
+}
+
+// historyArgValues returns the values previously passed after prefix, mined
+// from history entries: for each entry whose tokens start with prefix, the
+// token that follows it, when that token extends toComplete and is not a
+// flag. Values are deduplicated and ordered most recent first. Entries that
+// tokenize fails on are skipped.
+func historyArgValues(entries []string, tokenize func(string) ([]string, error), prefix []string, toComplete string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		tokens, err := tokenize(entries[i])
+		if err != nil || len(tokens) <= len(prefix) || !slices.Equal(tokens[:len(prefix)], prefix) {
+			continue
+		}
+		v := tokens[len(prefix)]
+		if seen[v] || strings.HasPrefix(v, "-") || !strings.HasPrefix(v, toComplete) {
+			continue
+		}
+		seen[v] = true
+		values = append(values, v)
+	}
+	return values
+}
+
+// prepareHistoryFile creates the parent directory of historyFile when it is
+// missing, so that history persists to a path in a fresh directory. readline
+// silently skips persistence when the file cannot be opened, so if the
+// directory cannot be created a warning is printed to w and "" is returned
+// to run with in-memory history only. An empty historyFile is returned as is.
+func prepareHistoryFile(w io.Writer, historyFile string) string {
+	if historyFile == "" {
+		return ""
+	}
+	if err := os.MkdirAll(filepath.Dir(historyFile), 0o700); err != nil {
+		writeErrTo(w, "cobra-shell: history will not be saved: %v\n", err)
+		return ""
+	}
+	return historyFile
+}
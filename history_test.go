@@ -0,0 +1,249 @@
+package cobrashell
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeHistory(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMergeHistory_DedupKeepsMostRecent(t *testing.T) {
+	got := mergeHistory([]string{"a", "b", "a", "c", "b"})
+	want := []string{"a", "c", "b"}
+	if !slices.Equal(got, want) {
+		t.Errorf("mergeHistory = %q, want %q", got, want)
+	}
+}
+
+func TestReadHistoryFile_MissingFile(t *testing.T) {
+	if got := readHistoryFile(filepath.Join(t.TempDir(), "missing")); len(got) != 0 {
+		t.Errorf("readHistoryFile(missing) = %q, want empty", got)
+	}
+}
+
+func TestMergeHistoryFiles(t *testing.T) {
+	dir := t.TempDir()
+	laptop := writeHistory(t, dir, "laptop", "get pods\ndescribe pod web\n\n")
+	server := writeHistory(t, dir, "server", "get pods\nlogs web\n")
+	active := writeHistory(t, dir, "active", "version\nlogs web\n")
+
+	if _, err := mergeHistoryFiles(active, []string{laptop, server}); err != nil {
+		t.Fatalf("mergeHistoryFiles: %v", err)
+	}
+
+	got := readHistoryFile(active)
+	want := []string{"describe pod web", "get pods", "version", "logs web"}
+	if !slices.Equal(got, want) {
+		t.Errorf("active history = %q, want %q", got, want)
+	}
+
+	// Source files are untouched.
+	if b, _ := os.ReadFile(laptop); string(b) != "get pods\ndescribe pod web\n\n" {
+		t.Errorf("laptop history modified: %q", b)
+	}
+	if b, _ := os.ReadFile(server); string(b) != "get pods\nlogs web\n" {
+		t.Errorf("server history modified: %q", b)
+	}
+}
+
+func TestMergeHistoryFiles_CreatesActive(t *testing.T) {
+	dir := t.TempDir()
+	extra := writeHistory(t, dir, "extra", "greet\n")
+	active := filepath.Join(dir, "active")
+
+	if _, err := mergeHistoryFiles(active, []string{extra}); err != nil {
+		t.Fatalf("mergeHistoryFiles: %v", err)
+	}
+	if got := readHistoryFile(active); len(got) == 0 || got[0] != "greet" {
+		t.Errorf("active history = %q, want [greet]", got)
+	}
+}
+
+func TestMergeHistoryFiles_FollowsSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	dir := t.TempDir()
+	extra := writeHistory(t, dir, "extra", "greet\n")
+	target := writeHistory(t, dir, "target", "version\n")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if merged, err := mergeHistoryFiles(link, []string{extra}); !merged || err != nil {
+		t.Fatalf("mergeHistoryFiles = %v, %v; want merged", merged, err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("link was replaced: %v, %v", info, err)
+	}
+	if got := readHistoryFile(target); !slices.Equal(got, []string{"greet", "version"}) {
+		t.Errorf("target history = %q, want [greet version]", got)
+	}
+}
+
+func TestMergeHistoryFiles_NotRegular(t *testing.T) {
+	extra := writeHistory(t, t.TempDir(), "extra", "greet\n")
+	if merged, err := mergeHistoryFiles(os.DevNull, []string{extra}); merged || err != nil {
+		t.Fatalf("mergeHistoryFiles(%s) = %v, %v; want skipped", os.DevNull, merged, err)
+	}
+	if info, err := os.Stat(os.DevNull); err != nil || info.Mode().IsRegular() {
+		t.Errorf("%s was replaced: %v, %v", os.DevNull, info, err)
+	}
+}
+
+// Pressing Up at the prompt walks the merged history from the newest entry,
+// so three presses recall the oldest: the first additional file's entry.
+func TestRunInteractive_MergedHistoryOrder(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	dir := t.TempDir()
+	laptop := writeHistory(t, dir, "laptop", "greet --name ann\n")
+	server := writeHistory(t, dir, "server", "greet --name bob\n")
+
+	tests := []struct {
+		name        string
+		historyFile string
+		ups         int
+		want        string
+	}{
+		{"merged file", writeHistory(t, dir, "active", "greet --name cat\n"), 3, "Hello, ann!"},
+		{"newest first", writeHistory(t, dir, "active2", "greet --name cat\n"), 1, "Hello, cat!"},
+		{"not a regular file", os.DevNull, 2, "Hello, ann!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{
+				BinaryPath:             testBinary,
+				HistoryFile:            tt.historyFile,
+				AdditionalHistoryFiles: []string{laptop, server},
+			})
+			input := strings.Repeat("\x1b[A", tt.ups) + "\nexit\n"
+			out := captureStdout(t, func() {
+				if err := s.runInteractive(io.NopCloser(strings.NewReader(input))); err != nil {
+					t.Errorf("runInteractive: %v", err)
+				}
+			})
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunInteractive_CreatesHistoryDir(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "nested", "dir", "history")
+	s := New(Config{BinaryPath: "/usr/bin/true", HistoryFile: historyFile})
+	if err := s.runInteractive(io.NopCloser(strings.NewReader("greet\nexit\n"))); err != nil {
+		t.Fatalf("runInteractive: %v", err)
+	}
+	if got := readHistoryFile(historyFile); len(got) == 0 || got[0] != "greet" {
+		t.Errorf("history = %q, want it to start with greet", got)
+	}
+}
+
+func TestRunInteractive_UncreatableHistoryDir(t *testing.T) {
+	// A regular file where the directory should be makes MkdirAll fail.
+	blocker := writeHistory(t, t.TempDir(), "blocker", "")
+	s := New(Config{BinaryPath: "/usr/bin/true", HistoryFile: filepath.Join(blocker, "history")})
+
+	var runErr error
+	stderr := captureStderr(t, func() {
+		runErr = s.runInteractive(io.NopCloser(strings.NewReader("greet\nexit\n")))
+	})
+	if runErr != nil {
+		t.Fatalf("runInteractive = %v, want the shell to run without persistence", runErr)
+	}
+	if !strings.Contains(stderr, "history will not be saved") {
+		t.Errorf("stderr = %q, want a warning", stderr)
+	}
+	if s.cfg.HistoryFile != "" {
+		t.Errorf("HistoryFile = %q, want in-memory history", s.cfg.HistoryFile)
+	}
+}
+
+func TestRunInteractive_HistoryWarningToConfiguredStderr(t *testing.T) {
+	blocker := writeHistory(t, t.TempDir(), "blocker", "")
+	var stderr bytes.Buffer
+	s := New(Config{
+		BinaryPath:  "/usr/bin/true",
+		HistoryFile: filepath.Join(blocker, "history"),
+		Stdout:      io.Discard,
+		Stderr:      &stderr,
+	})
+	osStderr := captureStderr(t, func() {
+		if err := s.runInteractive(io.NopCloser(strings.NewReader("exit\n"))); err != nil {
+			t.Errorf("runInteractive: %v", err)
+		}
+	})
+	if !strings.Contains(stderr.String(), "history will not be saved") {
+		t.Errorf("Config.Stderr = %q, want the history warning", stderr.String())
+	}
+	if osStderr != "" {
+		t.Errorf("os.Stderr = %q, want nothing", osStderr)
+	}
+}
+
+func TestHistoryArgValues(t *testing.T) {
+	entries := []string{
+		"deploy --env staging",
+		"deploy --env prod",
+		"status",
+		"deploy --env staging",
+		"deploy --env --dry-run",
+		"rollback --env qa",
+	}
+	tokenize := func(line string) ([]string, error) { return strings.Fields(line), nil }
+
+	got := historyArgValues(entries, tokenize, []string{"deploy", "--env"}, "")
+	if want := []string{"staging", "prod"}; !slices.Equal(got, want) {
+		t.Errorf("historyArgValues = %q, want %q (deduped, most recent first, no flags)", got, want)
+	}
+	got = historyArgValues(entries, tokenize, []string{"deploy", "--env"}, "p")
+	if want := []string{"prod"}; !slices.Equal(got, want) {
+		t.Errorf("historyArgValues with prefix = %q, want %q", got, want)
+	}
+	if got := historyArgValues(entries, tokenize, []string{"status"}, ""); len(got) != 0 {
+		t.Errorf("historyArgValues past the end of an entry = %q, want none", got)
+	}
+}
+
+func TestIntegration_CompleterDo_HistoryCompletions(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.WorkingDir = t.TempDir() // no files to complete
+	sh.cfg.HistoryFile = writeHistory(t, t.TempDir(), "history", "echo alpha\ngreet --name bob\necho beta\necho alpha\n")
+	c := &completer{shell: sh}
+
+	line := []rune("echo ")
+	if got, _ := c.Do(line, len(line)); len(got) != 0 {
+		t.Fatalf("Do(%q) without HistoryCompletions = %q, want none", string(line), got)
+	}
+
+	sh.cfg.HistoryCompletions = true
+	got, _ := c.Do(line, len(line))
+	var values []string
+	for _, g := range got {
+		values = append(values, string(g))
+	}
+	if want := []string{"alpha", "beta"}; !slices.Equal(values, want) {
+		t.Errorf("Do(%q) = %q, want %q", string(line), values, want)
+	}
+}
@@ -10,7 +10,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 // testBinary holds the path to the compiled testbin binary. Populated by
@@ -157,6 +161,198 @@ func TestIntegration_TryComplete_NoMatch(t *testing.T) {
 	}
 }
 
+func TestIntegration_TryComplete_HelpNested(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	c := &completer{shell: newIntegrationShell()}
+
+	candidates, _, ok := c.tryComplete([]string{"help", "serve"}, "")
+	if !ok {
+		t.Fatal("tryComplete returned ok=false")
+	}
+	assertSameElements(t, candidates, []string{"start", "stop"})
+}
+
+func TestIntegration_TryComplete_StderrIgnoredByDefault(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Env = []string{"TESTBIN_COMPLETE_STDERR=1"}
+	c := &completer{shell: sh}
+
+	candidates, _, ok := c.tryComplete(nil, "gr")
+	if !ok {
+		t.Fatal("tryComplete returned ok=false")
+	}
+	if len(candidates) != 0 {
+		t.Errorf("tryComplete with stderr output and option off = %v, want empty", candidates)
+	}
+}
+
+func TestIntegration_TryComplete_ReadStderr(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Env = []string{"TESTBIN_COMPLETE_STDERR=1"}
+	sh.cfg.CompletionReadStderr = true
+	c := &completer{shell: sh}
+
+	candidates, directive, ok := c.tryComplete(nil, "gr")
+	if !ok {
+		t.Fatal("tryComplete returned ok=false")
+	}
+	if len(candidates) != 1 || candidates[0] != "greet" {
+		t.Errorf("tryComplete(nil, 'gr') = %v, want [greet]", candidates)
+	}
+	if directive&compDirectiveNoFileComp == 0 {
+		t.Errorf("directive = %d, want NoFileComp bit set", directive)
+	}
+}
+
+func TestIntegration_TryComplete_OnSlowCompletion(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	var elapsed time.Duration
+	calls := 0
+	sh := newIntegrationShell()
+	sh.cfg.CompletionTimeout = 2 * time.Second
+	sh.cfg.Env = []string{"TESTBIN_SLEEP=1100ms"}
+	sh.cfg.OnSlowCompletion = func(d time.Duration) {
+		calls++
+		elapsed = d
+	}
+	c := &completer{shell: sh}
+
+	if _, _, ok := c.tryComplete(nil, "gr"); !ok {
+		t.Fatal("tryComplete returned ok=false")
+	}
+	if calls != 1 {
+		t.Fatalf("OnSlowCompletion called %d times, want 1", calls)
+	}
+	if elapsed < 1100*time.Millisecond || elapsed > sh.cfg.CompletionTimeout {
+		t.Errorf("elapsed = %v, want between 1.1s and the 2s timeout", elapsed)
+	}
+}
+
+func TestIntegration_TryComplete_FastCompletionNotReported(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CompletionTimeout = 5 * time.Second
+	sh.cfg.OnSlowCompletion = func(d time.Duration) {
+		t.Errorf("OnSlowCompletion called for a fast completion (%v)", d)
+	}
+	c := &completer{shell: sh}
+	c.tryComplete(nil, "gr")
+}
+
+func TestHasDirective(t *testing.T) {
+	cases := []struct {
+		output string
+		want   bool
+	}{
+		{"greet\n:4\n", true},
+		{":0", true},
+		{"greet\n", false},
+		{"", false},
+		{":notanumber\n", false},
+	}
+	for _, tc := range cases {
+		if got := hasDirective(tc.output); got != tc.want {
+			t.Errorf("hasDirective(%q) = %v, want %v", tc.output, got, tc.want)
+		}
+	}
+}
+
+func TestIntegration_CompleterDo_EnvBuiltinShadowsBinary(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	c := &completer{shell: sh}
+
+	// Without the built-in, testbin's own env command completes.
+	line := []rune("env sh")
+	if got, _ := c.Do(line, len(line)); len(got) != 1 || string(got[0]) != "ow" {
+		t.Fatalf("Do(%q) without EnvBuiltin = %q, want testbin's [ow]", string(line), got)
+	}
+
+	sh.cfg.EnvBuiltin = "env"
+	if got, _ := c.Do(line, len(line)); len(got) != 0 {
+		t.Errorf("Do(%q) = %q, want no testbin candidates", string(line), got)
+	}
+	line = []rune("env ")
+	got, _ := c.Do(line, len(line))
+	var names []string
+	for _, g := range got {
+		names = append(names, string(g))
+	}
+	assertSameElements(t, names, []string{"list", "effective", "set", "unset", "clear"})
+
+	out := captureStdout(t, func() {
+		captureStderr(t, func() { sh.execute("env show") })
+	})
+	if strings.Contains(out, "testbin env show") {
+		t.Errorf("env show ran testbin's env command; the built-in should win: %q", out)
+	}
+}
+
+func TestIntegration_CompleterDo_AfterArgumentTerminator(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.WorkingDir = t.TempDir() // no files to complete
+	sh.cfg.TimeFlagNames = []string{"--since"}
+	c := &completer{shell: sh}
+
+	line := []rune("echo --since ")
+	if got, _ := c.Do(line, len(line)); len(got) == 0 {
+		t.Fatalf("Do(%q) = none, want time hints", string(line))
+	}
+	line = []rune("echo -- --since ")
+	if got, _ := c.Do(line, len(line)); len(got) != 0 {
+		t.Errorf("Do(%q) = %q, want no time hints after --", string(line), got)
+	}
+
+	// The --help fallback lists flags, which must not be offered after --.
+	sh.forcedSource = sourceHelp
+	line = []rune("serve --")
+	if got, _ := c.Do(line, len(line)); len(got) == 0 {
+		t.Fatalf("Do(%q) via --help = none, want flags", string(line))
+	}
+	line = []rune("serve -- --")
+	if got, _ := c.Do(line, len(line)); len(got) != 0 {
+		t.Errorf("Do(%q) via --help = %q, want no flags after --", string(line), got)
+	}
+}
+
+func TestIntegration_CompleterDo_HelpCommandNames(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	c := &completer{shell: newIntegrationShell()}
+
+	// help is an ordinary context arg: cobra's __complete answers with the
+	// command names it accepts.
+	line := []rune("help gr")
+	if got, length := c.Do(line, len(line)); length != len("gr") || len(got) != 1 || string(got[0]) != "eet" {
+		t.Errorf("Do(%q) = %q, %d; want [eet], 2", string(line), got, length)
+	}
+	line = []rune("help serve st")
+	got, _ := c.Do(line, len(line))
+	var names []string
+	for _, g := range got {
+		names = append(names, "st"+string(g))
+	}
+	assertSameElements(t, names, []string{"start", "stop"})
+}
+
 // --- Execution ---
 
 func TestIntegration_Execute_Success(t *testing.T) {
@@ -265,6 +461,13 @@ func TestAfterNthPipe(t *testing.T) {
 	if got := afterNthPipe(s, 3); got != "" {
 		t.Errorf("afterNthPipe(s,3) = %q, want empty", got)
 	}
+	// Pipes inside command substitutions belong to the expression.
+	if got := afterNthPipe("echo $(echo xy | tr a-z A-Z) | cat", 1); got != " cat" {
+		t.Errorf("afterNthPipe with $(...) = %q, want %q", got, " cat")
+	}
+	if got := afterNthPipe("echo `echo xy | tr a-z A-Z` | cat", 1); got != " cat" {
+		t.Errorf("afterNthPipe with backticks = %q, want %q", got, " cat")
+	}
 	// Glued pipe — not detected as standalone.
 	glued := "echo|grep"
 	if got := afterNthPipe(glued, 1); got != "" {
@@ -384,6 +587,57 @@ func TestIntegration_Execute_Pipe_MultiStage(t *testing.T) {
 	}
 }
 
+func TestIntegration_Execute_PipeLeftSideLiteral(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh features on the right side")
+	}
+	sh := newIntegrationShell()
+	// sh would expand "$HOME" and run the backticks if it saw the left side
+	// as typed; "$((1+1))" on the right side is still evaluated by the shell.
+	out := captureStdout(t, func() { sh.execute("echo \"$HOME `id`\" | sed s/$/-$((1+1))/") })
+	if want := "$HOME `id`-2\n"; out != want {
+		t.Errorf("pipeline output = %q, want %q", out, want)
+	}
+}
+
+func TestIntegration_AfterExecResult(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	var results, detailed []ExecResult
+	sh := newIntegrationShell()
+	sh.cfg.Hooks.AfterExecResult = func(r ExecResult) { results = append(results, r) }
+	sh.cfg.Hooks.AfterExecDetailed = func(_ []string, r ExecResult) { detailed = append(detailed, r) }
+
+	discardStdout(t, func() {
+		sh.execute("echo hello")
+		sh.execute("echo hello | cat")
+	})
+	if len(results) != 2 {
+		t.Fatalf("AfterExecResult called %d times, want 2", len(results))
+	}
+	if !reflect.DeepEqual(results, detailed) {
+		t.Errorf("AfterExecResult results = %+v, want those of AfterExecDetailed %+v", results, detailed)
+	}
+
+	plain, piped := results[0], results[1]
+	if plain.Duration <= 0 || plain.UsedPTY || plain.Piped {
+		t.Errorf("plain command result = %+v, want a positive Duration, no PTY, not piped", plain)
+	}
+	if len(plain.Args) != 2 || plain.Args[0] != "echo" {
+		t.Errorf("plain command Args = %q, want [echo hello]", plain.Args)
+	}
+	if !piped.Piped || piped.UsedPTY || piped.Duration <= 0 {
+		t.Errorf("pipeline result = %+v, want Piped, no PTY, a positive Duration", piped)
+	}
+	if len(piped.Args) != 2 || piped.Args[1] != "hello" {
+		t.Errorf("pipeline Args = %q, want the left side [echo hello]", piped.Args)
+	}
+}
+
 // --- Pipe completion integration tests ---
 
 func TestIntegration_CompleterDo_AfterPipe(t *testing.T) {
@@ -454,3 +708,226 @@ func TestIntegration_Execute_EnvBuiltinNotForwarded(t *testing.T) {
 		t.Error("AfterExec should not be called for env built-in commands")
 	}
 }
+
+func TestIntegration_Run_PipeMode(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	go func() {
+		_, _ = w.WriteString("echo one\n\necho two\ngreet --name pipe\n")
+		_ = w.Close()
+	}()
+	origStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+
+	sh := newIntegrationShell()
+	var runErr error
+	out := captureStdout(t, func() { runErr = sh.Run() })
+	if runErr != nil {
+		t.Fatalf("Run in pipe mode returned %v, want nil at EOF", runErr)
+	}
+	if want := "one\ntwo\nHello, pipe!\n"; out != want {
+		t.Errorf("pipe mode output = %q, want %q", out, want)
+	}
+}
+
+func TestIntegration_RunLines_StopsAtExit(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	out := captureStdout(t, func() {
+		if err := sh.runLines(strings.NewReader("echo before\nexit\necho after\n")); err != nil {
+			t.Errorf("runLines: %v", err)
+		}
+	})
+	if out != "before\n" {
+		t.Errorf("runLines output = %q, want only the line before exit", out)
+	}
+}
+
+func TestIntegration_Exec_PropagatesExitCode(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := New(Config{BinaryPath: testBinary})
+
+	var code int
+	var err error
+	out := captureStdout(t, func() { code, err = sh.Exec("echo hello | cat") })
+	if err != nil || code != 0 {
+		t.Errorf("Exec(echo) = %d, %v; want 0, nil", code, err)
+	}
+	if out != "hello\n" {
+		t.Errorf("Exec(echo) output = %q, want %q", out, "hello\n")
+	}
+
+	captureStderr(t, func() { code, err = sh.Exec("fail") })
+	if err != nil || code == 0 {
+		t.Errorf("Exec(fail) = %d, %v; want a non-zero code", code, err)
+	}
+}
+
+func TestExec_ReturnsInitError(t *testing.T) {
+	sh := New(Config{BinaryPath: "cobra-shell-no-such-binary"})
+	if _, err := sh.Exec("greet"); err == nil {
+		t.Error("Exec with an unresolvable binary returned nil error")
+	}
+}
+
+func TestIntegration_LastOutput(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CaptureOutput = true
+
+	out := captureStdout(t, func() { sh.execute("echo hello") })
+	if out != "hello\n" {
+		t.Errorf("terminal output = %q, want output still shown", out)
+	}
+	if got := sh.LastOutput(); !strings.Contains(got, "hello") {
+		t.Errorf("LastOutput() = %q, want it to contain hello", got)
+	}
+
+	captureStdout(t, func() { sh.execute("echo second | cat") })
+	if got := sh.LastOutput(); got != "second\n" {
+		t.Errorf("LastOutput() after pipeline = %q, want %q", got, "second\n")
+	}
+}
+
+func TestIntegration_LastOutput_Disabled(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	captureStdout(t, func() { sh.execute("echo hello") })
+	if got := sh.LastOutput(); got != "" {
+		t.Errorf("LastOutput() with CaptureOutput off = %q, want empty", got)
+	}
+}
+
+func TestIntegration_CompleterDo_FlagEqualsValue(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	c := &completer{shell: newIntegrationShell()}
+
+	line := []rune("greet --namespace=kube")
+	got, length := c.Do(line, len(line))
+	if length != len("kube") || len(got) != 1 || string(got[0]) != "-system/" {
+		t.Errorf("Do(%q) = %q, %d; want [-system/], %d", string(line), got, length, len("kube"))
+	}
+
+	line = []rune("greet --namesp")
+	got, _ = c.Do(line, len(line))
+	if len(got) != 1 || string(got[0]) != "ace" {
+		t.Errorf("Do(%q) = %q, want [ace]", string(line), got)
+	}
+}
+
+func TestRunLines_CommentPrefix(t *testing.T) {
+	script, log := writeLoggingBinary(t, "")
+	prefix := "//"
+	s := New(Config{BinaryPath: script, CommentPrefix: &prefix, Tokenizer: func(line string) ([]string, error) {
+		return strings.Fields(line), nil
+	}})
+	input := "// a comment\n  // indented comment\n# real command\n"
+	captureStderr(t, func() {
+		if err := s.runLines(strings.NewReader(input)); err != nil {
+			t.Errorf("runLines: %v", err)
+		}
+	})
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "# real command\n" {
+		t.Errorf("binary invocations = %q, want only the # line", got)
+	}
+}
+
+func TestRunLines_DefaultCommentPrefix(t *testing.T) {
+	script, log := writeLoggingBinary(t, "")
+	tokenizer := func(line string) ([]string, error) { return strings.Fields(line), nil }
+
+	s := New(Config{BinaryPath: script, Tokenizer: tokenizer})
+	captureStderr(t, func() { _ = s.runLines(strings.NewReader("# skipped\n")) })
+	if n := countInvocations(t, log); n != 0 {
+		t.Errorf("binary ran %d times for a # comment, want 0", n)
+	}
+
+	s = New(Config{BinaryPath: script, Tokenizer: tokenizer, CommentPrefix: new(string)})
+	captureStderr(t, func() { _ = s.runLines(strings.NewReader("# run\n")) })
+	if n := countInvocations(t, log); n != 1 {
+		t.Errorf("binary ran %d times with an empty CommentPrefix, want 1", n)
+	}
+}
+
+// --- HistoryExpansion ---
+
+func TestIntegration_HistoryExpansion(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := New(Config{BinaryPath: testBinary, HistoryExpansion: true})
+
+	out := captureStdout(t, func() {
+		_, _ = sh.Exec("echo first last")
+		_, _ = sh.Exec("!!")
+		_, _ = sh.Exec("echo !$")
+	})
+	if want := "first\nlast\nfirst\nlast\nlast\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+
+	sh = New(Config{BinaryPath: testBinary, HistoryExpansion: true})
+	var code int
+	errOut := captureStderr(t, func() { code, _ = sh.Exec("!!") })
+	if code == 0 || !strings.Contains(errOut, "event not found") {
+		t.Errorf("Exec(!!) first = %d, stderr %q; want a failure naming the missing event", code, errOut)
+	}
+}
+
+// --- Stdout / Stderr ---
+
+func TestIntegration_ConfiguredOutputStreams(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	var stdout, stderr strings.Builder
+	sh := New(Config{BinaryPath: testBinary, EnvBuiltin: "env", Stdout: &stdout, Stderr: &stderr})
+
+	leaked := captureStdout(t, func() {
+		leakedErr := captureStderr(t, func() {
+			_, _ = sh.Exec("greet --name bob")
+			_, _ = sh.Exec("fail")
+			_, _ = sh.Exec("greet 'oops")
+			sh.SetEnv("K", "V")
+			_, _ = sh.Exec("env list")
+		})
+		if leakedErr != "" {
+			t.Errorf("os.Stderr received %q, want nothing", leakedErr)
+		}
+	})
+	if leaked != "" {
+		t.Errorf("os.Stdout received %q, want nothing", leaked)
+	}
+
+	for _, want := range []string{"Hello, bob!", "K=V"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Config.Stdout = %q, want it to contain %q", stdout.String(), want)
+		}
+	}
+	// The child's stderr and the shell's own parse error.
+	for _, want := range []string{"intentional failure", "unterminated"} {
+		if !strings.Contains(strings.ToLower(stderr.String()), want) {
+			t.Errorf("Config.Stderr = %q, want it to contain %q", stderr.String(), want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cobrashell
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// job is a command started in the background with a trailing "&".
+type job struct {
+	id   int
+	args []string
+	cmd  *exec.Cmd
+}
+
+// jobTable tracks the running background jobs of a Shell. Jobs remove
+// themselves when they exit, so the table only ever holds running commands.
+type jobTable struct {
+	mu     sync.Mutex
+	nextID int
+	jobs   []*job
+}
+
+// running returns the number of running jobs.
+func (t *jobTable) running() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.jobs)
+}
+
+// snapshot returns a copy of the running jobs, in start order.
+func (t *jobTable) snapshot() []*job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*job(nil), t.jobs...)
+}
+
+// add registers j under a new job ID.
+func (t *jobTable) add(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	j.id = t.nextID
+	t.jobs = append(t.jobs, j)
+}
+
+// remove drops j from the table.
+func (t *jobTable) remove(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, other := range t.jobs {
+		if other == j {
+			t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// isBackground reports whether tokens end with a standalone "&" while
+// background jobs are enabled, and returns the tokens without it.
+func (s *Shell) isBackground(tokens []string) ([]string, bool) {
+	if s.cfg.JobsBuiltin == "" || len(tokens) < 2 || tokens[len(tokens)-1] != "&" {
+		return tokens, false
+	}
+	return tokens[:len(tokens)-1], true
+}
+
+// startBackground starts the binary with tokens without waiting for it. The
+// job's stdout and stderr go to the terminal; it gets no stdin. BeforeExec
+// runs as usual, but AfterExec is not called, since the job finishes while
+// the user is typing other commands.
+//
+// When Config.MaxBackgroundJobs jobs are already running the command is
+// rejected before BeforeExec and nothing is started.
+func (s *Shell) startBackground(tokens []string, subs substitutions) {
+	if limit := s.cfg.MaxBackgroundJobs; limit > 0 && s.jobs.running() >= limit {
+		s.writeErr("cobra-shell: background job limit (%d) reached; command not started\n", limit)
+		s.lastExitCode = 1
+		return
+	}
+
+	if s.cfg.Hooks.BeforeExec != nil {
+		if err := s.cfg.Hooks.BeforeExec(subs.source(tokens)); err != nil {
+			reportHookError(s.stderr(), err)
+			return
+		}
+	}
+	tokens, err := s.expandSubstitutions(subs, tokens)
+	if err != nil {
+		s.writeErr("cobra-shell: %v\n", err)
+		s.lastExitCode = 1
+		return
+	}
+
+	cmd := exec.Command(s.binary, tokens...)
+	cmd.Dir = s.cfg.WorkingDir
+	cmd.Env = s.buildEnv()
+	cmd.Stdout = s.stdout()
+	cmd.Stderr = s.stderr()
+	if err := cmd.Start(); err != nil {
+		s.writeErr("cobra-shell: %v\n", err)
+		s.lastExitCode = 1
+		return
+	}
+
+	j := &job{args: tokens, cmd: cmd}
+	s.jobs.add(j)
+	fmt.Fprintf(s.stdout(), "[%d] %d\n", j.id, cmd.Process.Pid)
+	s.lastExitCode = 0
+
+	go func() {
+		_ = cmd.Wait()
+		s.jobs.remove(j)
+	}()
+}
+
+// killJobs kills all running background jobs. Run calls it on exit so that
+// no job outlives the shell.
+func (s *Shell) killJobs() {
+	for _, j := range s.jobs.snapshot() {
+		_ = j.cmd.Process.Kill()
+	}
+}
+
+// handleJobsBuiltin checks whether tokens[0] matches Config.JobsBuiltin. If
+// so, it lists the running background jobs and returns true.
+func (s *Shell) handleJobsBuiltin(tokens []string) bool {
+	if s.cfg.JobsBuiltin == "" || tokens[0] != s.cfg.JobsBuiltin {
+		return false
+	}
+	list := s.jobs.snapshot()
+	for _, j := range list {
+		fmt.Fprintf(s.stdout(), "[%d] %-8d %s\n", j.id, j.cmd.Process.Pid, strings.Join(j.args, " "))
+	}
+	if limit := s.cfg.MaxBackgroundJobs; limit > 0 {
+		fmt.Fprintf(s.stdout(), "%d of %d background jobs running\n", len(list), limit)
+	} else {
+		fmt.Fprintf(s.stdout(), "%d background jobs running\n", len(list))
+	}
+	return true
+}
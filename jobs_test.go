@@ -0,0 +1,100 @@
+package cobrashell
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeJobsShell(t *testing.T) *Shell {
+	t.Helper()
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.JobsBuiltin = "jobs"
+	sh.cfg.Env = []string{"TESTBIN_SLEEP=10s"}
+	t.Cleanup(sh.killJobs)
+	return sh
+}
+
+// discardStdout runs fn with os.Stdout pointed at the null device. Background
+// jobs inherit os.Stdout, so capturing it through a pipe would block until
+// they exit.
+func discardStdout(t *testing.T, fn func()) {
+	t.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	orig := os.Stdout
+	os.Stdout = null
+	defer func() { os.Stdout = orig }()
+	fn()
+}
+
+func TestIntegration_Background_LimitEnforced(t *testing.T) {
+	sh := makeJobsShell(t)
+	sh.cfg.MaxBackgroundJobs = 1
+	var started int
+	sh.cfg.Hooks.BeforeExec = func([]string) error { started++; return nil }
+
+	discardStdout(t, func() { sh.execute("greet &") })
+	if n := sh.jobs.running(); n != 1 {
+		t.Fatalf("running jobs = %d, want 1", n)
+	}
+
+	stderr := captureStderr(t, func() { sh.execute("greet &") })
+	if !strings.Contains(stderr, "limit (1) reached") {
+		t.Errorf("stderr = %q, want limit error", stderr)
+	}
+	if n := sh.jobs.running(); n != 1 {
+		t.Errorf("running jobs after rejected launch = %d, want 1", n)
+	}
+	if started != 1 {
+		t.Errorf("BeforeExec called %d times, want 1: the rejected command must not start", started)
+	}
+	if sh.lastExitCode == 0 {
+		t.Error("lastExitCode = 0 after rejected launch, want non-zero")
+	}
+}
+
+func TestIntegration_Background_JobsShowsCount(t *testing.T) {
+	sh := makeJobsShell(t)
+	sh.cfg.MaxBackgroundJobs = 3
+	discardStdout(t, func() {
+		sh.execute("greet &")
+		sh.execute("echo x &")
+	})
+
+	out := captureStdout(t, func() { sh.execute("jobs") })
+	if !strings.Contains(out, "2 of 3 background jobs running") {
+		t.Errorf("jobs output = %q, want count line", out)
+	}
+	if !strings.Contains(out, "[1]") || !strings.Contains(out, "echo x") {
+		t.Errorf("jobs output = %q, want both jobs listed", out)
+	}
+}
+
+func TestIntegration_Background_FinishedJobRemoved(t *testing.T) {
+	sh := makeJobsShell(t)
+	sh.cfg.Env = nil
+	discardStdout(t, func() { sh.execute("echo done &") })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sh.jobs.running() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("finished job still listed as running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIsBackground_DisabledWithoutJobsBuiltin(t *testing.T) {
+	s := &Shell{}
+	if _, ok := s.isBackground([]string{"greet", "&"}); ok {
+		t.Error("isBackground should be false when JobsBuiltin is empty")
+	}
+}
@@ -0,0 +1,164 @@
+package cobrashell
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// manPageFallback offers top-level subcommand names parsed from the binary's
+// man page. It is the last completion source, used only when
+// Config.ManPageFallback is set and the --help fallback found nothing.
+//
+// The man page is read once per binary and cached: man pages do not change
+// during a session and rendering one is comparatively slow. Switching the
+// binary with the use built-in reads the new binary's page.
+func (c *completer) manPageFallback(contextArgs []string, toComplete string) []string {
+	// Man pages document the top level only; deeper levels would need a page
+	// per subcommand, which few tools ship.
+	if len(contextArgs) > 0 {
+		return nil
+	}
+	if c.manPageBinary != c.shell.binary {
+		c.manPage = parseManPage(c.readManPage(), binaryName(c.shell.binary))
+		c.manPageBinary = c.shell.binary
+	}
+	var candidates []string
+	for _, name := range c.manPage {
+		if strings.HasPrefix(name, toComplete) {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// readManPage returns the plain-text man page for the wrapped binary, from
+// Config.ManPageFile when set or by running man otherwise. Errors yield "".
+func (c *completer) readManPage() string {
+	if c.shell.cfg.ManPageFile != "" {
+		b, err := os.ReadFile(c.shell.cfg.ManPageFile)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.shell.cfg.CompletionTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "man", binaryName(c.shell.binary))
+	// MANPAGER=cat prevents man from starting an interactive pager; a wide
+	// MANWIDTH keeps synopsis lines from wrapping.
+	cmd.Env = append(c.shell.buildEnv(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=200")
+	cmd.Stderr = io.Discard
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// parseManPage extracts subcommand names from a rendered man page for the
+// binary called name. It recognises:
+//   - SYNOPSIS lines of the form "name subcommand ...": the word after name.
+//   - COMMANDS / SUBCOMMANDS sections: the first word of each entry line,
+//     i.e. lines at the section's shallowest indentation.
+//
+// Overstrike sequences used by nroff for bold/underline ("x\bx", "_\bx")
+// are removed first. Only plain words (lowercase letters, digits, '-', '_')
+// are accepted, so placeholders like "[options]" or "<file>" are skipped.
+// Results are deduplicated and keep their order of appearance.
+func parseManPage(text, name string) []string {
+	type section int
+	const (
+		secNone section = iota
+		secSynopsis
+		secCommands
+	)
+
+	var candidates []string
+	seen := make(map[string]bool)
+	add := func(word string) {
+		if isManCommandWord(word) && !seen[word] {
+			seen[word] = true
+			candidates = append(candidates, word)
+		}
+	}
+
+	cur := secNone
+	entryIndent := -1
+	for _, line := range strings.Split(stripOverstrike(text), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if indent == 0 {
+			// Unindented lines are section headers.
+			switch strings.ToUpper(trimmed) {
+			case "SYNOPSIS":
+				cur = secSynopsis
+			case "COMMANDS", "SUBCOMMANDS", "AVAILABLE COMMANDS":
+				cur = secCommands
+				entryIndent = -1
+			default:
+				cur = secNone
+			}
+			continue
+		}
+
+		fields := strings.Fields(trimmed)
+		switch cur {
+		case secSynopsis:
+			if len(fields) >= 2 && fields[0] == name {
+				add(fields[1])
+			}
+		case secCommands:
+			if entryIndent < 0 {
+				entryIndent = indent
+			}
+			if indent == entryIndent {
+				add(fields[0])
+			}
+		}
+	}
+	return candidates
+}
+
+// stripOverstrike removes nroff overstrike sequences: "c\bc" (bold) and
+// "_\bc" (underline) both render as c.
+func stripOverstrike(s string) string {
+	if !strings.Contains(s, "\b") {
+		return s
+	}
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if i+2 < len(runes) && runes[i+1] == '\b' {
+			continue // drop the overstruck character and the backspace
+		}
+		if runes[i] == '\b' {
+			continue
+		}
+		b.WriteRune(runes[i])
+	}
+	return b.String()
+}
+
+// isManCommandWord reports whether word looks like a subcommand name.
+func isManCommandWord(word string) bool {
+	if word == "" || word[0] == '-' {
+		return false
+	}
+	for _, r := range word {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
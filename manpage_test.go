@@ -0,0 +1,89 @@
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sampleManPage is a plain-text rendering of a typical tool man page.
+const sampleManPage = `TOOL(1)                      User Commands                     TOOL(1)
+
+NAME
+       tool - manage widgets
+
+SYNOPSIS
+       tool [options] <command>
+       tool init [--force] <dir>
+       tool sync <remote>
+
+DESCRIPTION
+       tool manages widgets. See COMMANDS below.
+
+COMMANDS
+       init   Create a new widget store.
+
+       status Show the state of the store.
+
+       prune [--dry-run]
+              Remove unreferenced widgets. Lines like this one are
+              descriptions and must not yield candidates.
+
+OPTIONS
+       -v, --verbose
+              Print more output.
+`
+
+func TestParseManPage_SynopsisAndCommands(t *testing.T) {
+	got := parseManPage(sampleManPage, "tool")
+	assertSameElements(t, got, []string{"init", "sync", "status", "prune"})
+}
+
+func TestParseManPage_Overstrike(t *testing.T) {
+	// nroff bold: each character is printed, backspaced, and printed again.
+	page := "SYNOPSIS\n       t\bto\boo\bol\bl b\bbu\bui\bil\bld\bd _\bf_\bi_\bl_\be\n"
+	got := parseManPage(page, "tool")
+	assertSameElements(t, got, []string{"build"})
+}
+
+func TestParseManPage_Empty(t *testing.T) {
+	if got := parseManPage("", "tool"); len(got) != 0 {
+		t.Errorf("expected no candidates, got %v", got)
+	}
+}
+
+func TestManPageFallback_FromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool.1.txt")
+	if err := os.WriteFile(path, []byte(sampleManPage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Shell{
+		cfg:    Config{ManPageFallback: true, ManPageFile: path},
+		binary: "/usr/local/bin/tool",
+	}
+	c := &completer{shell: s}
+
+	assertSameElements(t, c.manPageFallback(nil, "s"), []string{"sync", "status"})
+	// Nested positions are not covered by man pages.
+	if got := c.manPageFallback([]string{"init"}, ""); len(got) != 0 {
+		t.Errorf("expected no candidates below the top level, got %v", got)
+	}
+}
+
+func TestManPageFallback_FollowsBinary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool.1.txt")
+	if err := os.WriteFile(path, []byte(sampleManPage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Shell{
+		cfg:    Config{ManPageFallback: true, ManPageFile: path},
+		binary: "/usr/local/bin/tool",
+	}
+	c := &completer{shell: s}
+
+	assertSameElements(t, c.manPageFallback(nil, "s"), []string{"sync", "status"})
+	// The page is parsed again for the new name: its SYNOPSIS lines name
+	// "tool", so only the COMMANDS section still yields candidates.
+	s.switchBinary("/usr/local/bin/other")
+	assertSameElements(t, c.manPageFallback(nil, "s"), []string{"status"})
+}
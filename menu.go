@@ -0,0 +1,155 @@
+package cobrashell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// completionItem is a completion candidate together with what the
+// descriptive menu shows for it. Description is the command's Short text and
+// Group is the title of its cobra command group; both are empty for
+// candidates that are not subcommands. Display, when set, is shown in the
+// menu in place of Value, which remains the text that is inserted.
+type completionItem struct {
+	Value       string
+	Description string
+	Group       string
+	Display     string
+}
+
+// label returns the text the menu shows for it.
+func (it completionItem) label() string {
+	if it.Display != "" {
+		return it.Display
+	}
+	return it.Value
+}
+
+// subcommandItems returns cmd's visible subcommands whose names start with
+// toComplete, each tagged with the title of the group it was added under
+// (see cobra.Command.AddGroup). Commands without a GroupID, or with one that
+// names no group of cmd, have an empty Group.
+func subcommandItems(cmd *cobra.Command, toComplete string) []completionItem {
+	titles := make(map[string]string, len(cmd.Groups()))
+	for _, g := range cmd.Groups() {
+		titles[g.ID] = g.Title
+	}
+	var items []completionItem
+	for _, child := range cmd.Commands() {
+		if child.Hidden || !strings.HasPrefix(child.Name(), toComplete) {
+			continue
+		}
+		items = append(items, completionItem{
+			Value:       child.Name(),
+			Description: stripANSI(child.Short),
+			Group:       titles[child.GroupID],
+		})
+	}
+	return items
+}
+
+// renderCompletionMenu writes items to w in the layout of cobra's help:
+// grouped items under their group titles, in the order the groups first
+// appear, followed by the ungrouped ones. Ungrouped items are headed
+// "Additional Commands:" when there are groups and "Available Commands:"
+// otherwise, as in cobra's usage template. Descriptions are aligned in a
+// column after the longest label. With a termWidth above 0, descriptions are
+// truncated (see truncateDescription) so that no line wraps in a terminal
+// that many columns wide.
+func renderCompletionMenu(w io.Writer, items []completionItem, termWidth int) {
+	width := 0
+	var groups []string
+	byGroup := make(map[string][]completionItem)
+	for _, it := range items {
+		width = max(width, len(it.label()))
+		if _, ok := byGroup[it.Group]; !ok && it.Group != "" {
+			groups = append(groups, it.Group)
+		}
+		byGroup[it.Group] = append(byGroup[it.Group], it)
+	}
+
+	// Two columns of indent, two between label and description, and one
+	// spare so that a full line does not trigger the terminal's auto-wrap.
+	descWidth := 0
+	if termWidth > 0 {
+		descWidth = max(termWidth-width-menuMargin, 1)
+	}
+	section := func(title string, items []completionItem) {
+		fmt.Fprintln(w, title)
+		for _, it := range items {
+			desc := it.Description
+			if descWidth > 0 {
+				desc = truncateDescription(desc, descWidth)
+			}
+			line := fmt.Sprintf("  %-*s  %s", width, it.label(), desc)
+			fmt.Fprintln(w, strings.TrimRight(line, " "))
+		}
+	}
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		section(g, byGroup[g])
+	}
+	if ungrouped := byGroup[""]; len(ungrouped) > 0 {
+		title := "Available Commands:"
+		if len(groups) > 0 {
+			fmt.Fprintln(w)
+			title = "Additional Commands:"
+		}
+		section(title, ungrouped)
+	}
+}
+
+// menuMargin is the number of columns of a menu line besides the label and
+// the description: see renderCompletionMenu.
+const menuMargin = 5
+
+// truncateDescription shortens desc to at most limit characters, replacing
+// the end with "…" when it is cut. A limit below 1 yields "".
+func truncateDescription(desc string, limit int) string {
+	if limit < 1 {
+		return ""
+	}
+	runes := []rune(desc)
+	if len(runes) <= limit {
+		return desc
+	}
+	return strings.TrimRight(string(runes[:limit-1]), " ") + "…"
+}
+
+// terminalWidth returns the width in columns of the terminal w writes to,
+// or 0 when w is not a terminal.
+func terminalWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// ansiEscape matches ANSI escape sequences: CSI sequences such as the color
+// codes "\033[31m", OSC sequences such as terminal hyperlinks, and the
+// \x01/\x02 markers used by [Colorize].
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|[\x01\x02]`)
+
+// stripANSI returns s without ANSI escape sequences, leaving only the
+// visible text. Descriptions are stripped before they are measured and
+// printed so that colors embedded by the binary do not break the menu's
+// column alignment.
+func stripANSI(s string) string {
+	if !strings.ContainsAny(s, "\x1b\x01\x02") {
+		return s
+	}
+	return ansiEscape.ReplaceAllString(s, "")
+}
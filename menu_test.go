@@ -0,0 +1,166 @@
+package cobrashell
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newGroupedTestRoot returns a tree whose subcommands are split across two
+// cobra command groups, with one command left ungrouped.
+func newGroupedTestRoot() *cobra.Command {
+	root := &cobra.Command{Use: "myapp"}
+	root.AddGroup(
+		&cobra.Group{ID: "manage", Title: "Management Commands:"},
+		&cobra.Group{ID: "query", Title: "Query Commands:"},
+	)
+	root.AddCommand(
+		&cobra.Command{Use: "create", Short: "Create a resource", GroupID: "manage"},
+		&cobra.Command{Use: "delete", Short: "Delete a resource", GroupID: "manage"},
+		&cobra.Command{Use: "get", Short: "Show a resource", GroupID: "query"},
+		&cobra.Command{Use: "version", Short: "Print version"},
+	)
+	return root
+}
+
+func TestSubcommandItems_GroupTitles(t *testing.T) {
+	items := subcommandItems(newGroupedTestRoot(), "")
+	want := map[string]completionItem{
+		"create":  {Value: "create", Description: "Create a resource", Group: "Management Commands:"},
+		"delete":  {Value: "delete", Description: "Delete a resource", Group: "Management Commands:"},
+		"get":     {Value: "get", Description: "Show a resource", Group: "Query Commands:"},
+		"version": {Value: "version", Description: "Print version", Group: ""},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items %v, want %d", len(items), items, len(want))
+	}
+	for _, it := range items {
+		if it != want[it.Value] {
+			t.Errorf("item %q = %+v, want %+v", it.Value, it, want[it.Value])
+		}
+	}
+}
+
+func TestRenderCompletionMenu(t *testing.T) {
+	var buf bytes.Buffer
+	renderCompletionMenu(&buf, subcommandItems(newGroupedTestRoot(), ""), 0)
+	want := "Management Commands:\n" +
+		"  create   Create a resource\n" +
+		"  delete   Delete a resource\n" +
+		"\n" +
+		"Query Commands:\n" +
+		"  get      Show a resource\n" +
+		"\n" +
+		"Additional Commands:\n" +
+		"  version  Print version\n"
+	if got := buf.String(); got != want {
+		t.Errorf("menu:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderCompletionMenu_NoGroups(t *testing.T) {
+	var buf bytes.Buffer
+	renderCompletionMenu(&buf, subcommandItems(newTestRoot(), ""), 0)
+	want := "Available Commands:\n" +
+		"  serve    Start the server\n" +
+		"  version  Print version\n"
+	if got := buf.String(); got != want {
+		t.Errorf("menu:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEmbeddedCompleter_ShowDescriptions(t *testing.T) {
+	var buf bytes.Buffer
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newGroupedTestRoot(), ShowDescriptions: true})
+	c := &embeddedCompleter{shell: sh, menu: &buf}
+
+	// Several candidates with no common prefix: the menu replaces them.
+	line := []rune("")
+	if got, _ := c.Do(line, len(line)); got != nil {
+		t.Errorf("Do returned %v, want nil while the menu is shown", got)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("Query Commands:\n  get")) {
+		t.Errorf("menu missing group; got:\n%s", buf.String())
+	}
+
+	// A unique match is still inserted without printing the menu.
+	buf.Reset()
+	line = []rune("ge")
+	got, _ := c.Do(line, len(line))
+	if len(got) != 1 || string(got[0]) != "t" {
+		t.Errorf("Do(ge) = %q, want [t]", got)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("menu printed for a unique match:\n%s", buf.String())
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"\033[31mdanger\033[0m zone", "danger zone"},
+		{"\033[1;32mbold green\033[0m", "bold green"},
+		{"\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{Colorize("prompt", ColorBlue), "prompt"},
+		{"plain text", "plain text"},
+	}
+	for _, tc := range cases {
+		if got := stripANSI(tc.in); got != tc.want {
+			t.Errorf("stripANSI(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRenderCompletionMenu_ColoredDescriptions(t *testing.T) {
+	root := &cobra.Command{Use: "myapp"}
+	root.AddCommand(
+		&cobra.Command{Use: "start", Short: "\033[32mStart\033[0m the server"},
+		&cobra.Command{Use: "stop", Short: "\033[31mStop\033[0m the server"},
+	)
+	var buf bytes.Buffer
+	renderCompletionMenu(&buf, subcommandItems(root, ""), 0)
+	want := "Available Commands:\n" +
+		"  start  Start the server\n" +
+		"  stop   Stop the server\n"
+	if got := buf.String(); got != want {
+		t.Errorf("menu:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestTruncateDescription(t *testing.T) {
+	long := "Create a resource from a file or from stdin, validating it first"
+	got := truncateDescription(long, 20)
+	if n := len([]rune(got)); n > 20 {
+		t.Errorf("truncateDescription(long, 20) has %d characters, want at most 20: %q", n, got)
+	}
+	if !strings.HasSuffix(got, "…") || !strings.HasPrefix(long, strings.TrimSuffix(got, "…")) {
+		t.Errorf("truncateDescription(long, 20) = %q, want a prefix of the text and an ellipsis", got)
+	}
+	if got := truncateDescription("Short", 20); got != "Short" {
+		t.Errorf("truncateDescription(Short, 20) = %q, want it unchanged", got)
+	}
+	if got := truncateDescription(long, 0); got != "" {
+		t.Errorf("truncateDescription(long, 0) = %q, want empty", got)
+	}
+}
+
+func TestRenderCompletionMenu_TruncatesToWidth(t *testing.T) {
+	items := []completionItem{
+		{Value: "create", Description: strings.Repeat("very long description ", 10)},
+		{Value: "get", Description: "Show"},
+	}
+	var buf bytes.Buffer
+	renderCompletionMenu(&buf, items, 40)
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if n := len([]rune(line)); n >= 40 {
+			t.Errorf("line %q is %d columns wide, want less than 40", line, n)
+		}
+	}
+	if !strings.Contains(buf.String(), "…") {
+		t.Errorf("menu does not mark the truncated description:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "  get     Show\n") {
+		t.Errorf("short description changed:\n%s", buf.String())
+	}
+}
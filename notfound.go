@@ -0,0 +1,44 @@
+package cobrashell
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// defaultCommandNotFoundPattern matches the error cobra prints for an
+// unknown subcommand, e.g. `Error: unknown command "gret" for "app"`.
+const defaultCommandNotFoundPattern = `unknown command "`
+
+// compileCommandNotFound compiles the stderr pattern used to detect unknown
+// commands for Hooks.OnCommandNotFound. It returns nil when the hook is not
+// set or only CommandNotFoundCode is configured.
+func compileCommandNotFound(cfg Config) (*regexp.Regexp, error) {
+	if cfg.Hooks.OnCommandNotFound == nil {
+		return nil, nil
+	}
+	pattern := cfg.CommandNotFoundPattern
+	if pattern == "" && cfg.CommandNotFoundCode == 0 {
+		pattern = defaultCommandNotFoundPattern
+	}
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("cobra-shell: CommandNotFoundPattern: invalid pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// commandNotFound reports whether a command that exited with code and wrote
+// stderr was rejected by the binary as unknown, with Hooks.OnCommandNotFound
+// set to handle it.
+func (s *Shell) commandNotFound(code int, stderr string) bool {
+	if s.cfg.Hooks.OnCommandNotFound == nil || code == 0 {
+		return false
+	}
+	if s.cfg.CommandNotFoundCode != 0 && code == s.cfg.CommandNotFoundCode {
+		return true
+	}
+	return s.notFoundPattern != nil && s.notFoundPattern.MatchString(stderr)
+}
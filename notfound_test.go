@@ -0,0 +1,77 @@
+package cobrashell
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileCommandNotFound(t *testing.T) {
+	hook := func([]string) ([]string, bool) { return nil, false }
+
+	if re, err := compileCommandNotFound(Config{}); re != nil || err != nil {
+		t.Errorf("without the hook = %v, %v; want nil, nil", re, err)
+	}
+	re, err := compileCommandNotFound(Config{Hooks: Hooks{OnCommandNotFound: hook}})
+	if err != nil || re == nil || !re.MatchString(`Error: unknown command "gret" for "app"`) {
+		t.Errorf("default pattern = %v, %v; want cobra's unknown command error matched", re, err)
+	}
+	if re, err := compileCommandNotFound(Config{CommandNotFoundCode: 127, Hooks: Hooks{OnCommandNotFound: hook}}); re != nil || err != nil {
+		t.Errorf("with only a code = %v, %v; want no pattern", re, err)
+	}
+	if _, err := compileCommandNotFound(Config{CommandNotFoundPattern: "(", Hooks: Hooks{OnCommandNotFound: hook}}); err == nil {
+		t.Error("invalid pattern returned nil error")
+	}
+}
+
+func TestCommandNotFound_Code(t *testing.T) {
+	s := &Shell{cfg: Config{
+		CommandNotFoundCode: 127,
+		Hooks:               Hooks{OnCommandNotFound: func([]string) ([]string, bool) { return nil, false }},
+	}}
+	if !s.commandNotFound(127, "") {
+		t.Error("exit code 127 not reported as command not found")
+	}
+	if s.commandNotFound(1, "unknown command \"x\"") {
+		t.Error("exit code 1 reported as command not found with only a code configured")
+	}
+}
+
+func TestIntegration_OnCommandNotFound_Retries(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	var calls [][]string
+	sh := New(Config{BinaryPath: testBinary, Hooks: Hooks{
+		OnCommandNotFound: func(tokens []string) ([]string, bool) {
+			calls = append(calls, tokens)
+			if tokens[0] == "gret" {
+				return append([]string{"greet"}, tokens[1:]...), true
+			}
+			return []string{"alsowrong"}, true
+		},
+	}})
+
+	var code int
+	var out string
+	captureStderr(t, func() { out = captureStdout(t, func() { code, _ = sh.Exec("gret --name bob") }) })
+	if code != 0 || !strings.Contains(out, "Hello, bob!") {
+		t.Errorf("Exec(gret) = %d, output %q; want the corrected greet to run", code, out)
+	}
+	if len(calls) != 1 || strings.Join(calls[0], " ") != "gret --name bob" {
+		t.Errorf("hook calls = %q, want one with the typed tokens", calls)
+	}
+
+	// A correction that is not found either is not retried again.
+	calls = nil
+	captureStderr(t, func() { code, _ = sh.Exec("nope") })
+	if code == 0 || len(calls) != 1 {
+		t.Errorf("Exec(nope) = %d with %d hook calls; want a failure and one call", code, len(calls))
+	}
+
+	// Other failures do not reach the hook.
+	calls = nil
+	captureStderr(t, func() { _, _ = sh.Exec("fail") })
+	if len(calls) != 0 {
+		t.Errorf("hook called for a failing known command: %q", calls)
+	}
+}
@@ -0,0 +1,215 @@
+package cobrashell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// Values for Config.PasteMode.
+const (
+	PasteConfirm = "confirm" // show a multi-line paste and ask before running it
+	PasteLines   = "lines"   // run each line of a multi-line paste in turn
+	PasteReject  = "reject"  // discard multi-line pastes
+)
+
+// Terminal bracketed-paste control sequences: the first pair switches the
+// mode on and off, the second delimits a pasted block in the input.
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+	pasteStart        = "\x1b[200~"
+	pasteEnd          = "\x1b[201~"
+)
+
+// validatePasteMode reports an error for a PasteMode that is not one of the
+// Paste* constants or "".
+func validatePasteMode(mode string) error {
+	switch mode {
+	case "", PasteConfirm, PasteLines, PasteReject:
+		return nil
+	}
+	return fmt.Errorf("cobra-shell: unknown PasteMode %q (want %q, %q or %q)", mode, PasteConfirm, PasteLines, PasteReject)
+}
+
+// pasteReader filters readline's input for bracketed pastes. Text outside a
+// paste, and single-line pastes, pass through unchanged. A paste containing
+// a line break is withheld: it is sent on pastes and replaced by a single
+// "\r", so that readline returns the line typed so far and the shell loop
+// can handle the block as a whole (see splitPaste and pasteAction).
+type pasteReader struct {
+	r      io.Reader
+	pastes chan string
+
+	pending []byte       // input not yet scanned; may end in a partial marker
+	out     []byte       // filtered bytes ready to be read
+	inPaste bool         // between pasteStart and pasteEnd
+	paste   bytes.Buffer // content of the current paste
+}
+
+func newPasteReader(r io.Reader) *pasteReader {
+	return &pasteReader{r: r, pastes: make(chan string, 1)}
+}
+
+// Read implements io.Reader.
+func (p *pasteReader) Read(b []byte) (int, error) {
+	for len(p.out) == 0 {
+		buf := make([]byte, 1024)
+		n, err := p.r.Read(buf)
+		p.pending = append(p.pending, buf[:n]...)
+		p.scan()
+		if err != nil {
+			if len(p.out) == 0 {
+				return 0, err
+			}
+			break
+		}
+	}
+	n := copy(b, p.out)
+	p.out = p.out[n:]
+	return n, nil
+}
+
+// take returns the multi-line paste that ended the line just read, if any.
+// It is safe to call on a nil pasteReader.
+func (p *pasteReader) take() (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	select {
+	case text := <-p.pastes:
+		return text, true
+	default:
+		return "", false
+	}
+}
+
+// scan moves the complete part of pending into out or the current paste,
+// leaving a trailing partial marker for the next read.
+func (p *pasteReader) scan() {
+	for len(p.pending) > 0 {
+		marker := pasteStart
+		if p.inPaste {
+			marker = pasteEnd
+		}
+		i := bytes.Index(p.pending, []byte(marker))
+		if i < 0 {
+			keep := partialSuffix(p.pending, marker)
+			p.emit(p.pending[:len(p.pending)-keep])
+			p.pending = p.pending[len(p.pending)-keep:]
+			return
+		}
+		p.emit(p.pending[:i])
+		p.pending = p.pending[i+len(marker):]
+		if p.inPaste {
+			p.finishPaste()
+		}
+		p.inPaste = !p.inPaste
+	}
+}
+
+func (p *pasteReader) emit(b []byte) {
+	if p.inPaste {
+		p.paste.Write(b)
+	} else {
+		p.out = append(p.out, b...)
+	}
+}
+
+func (p *pasteReader) finishPaste() {
+	text := p.paste.String()
+	p.paste.Reset()
+	if !strings.ContainsAny(text, "\r\n") {
+		p.out = append(p.out, text...)
+		return
+	}
+	p.pastes <- text
+	p.out = append(p.out, '\r')
+}
+
+// partialSuffix returns the length of the longest suffix of b that is a
+// proper prefix of marker.
+func partialSuffix(b []byte, marker string) int {
+	for n := min(len(b), len(marker)-1); n > 0; n-- {
+		if bytes.HasSuffix(b, []byte(marker[:n])) {
+			return n
+		}
+	}
+	return 0
+}
+
+// splitPaste splits a pasted block into lines, accepting "\n", "\r\n" and
+// "\r" line endings. typed, the text on the line before the paste began, is
+// joined to the first line. Blank lines are dropped.
+func splitPaste(typed, text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	var lines []string
+	for i, l := range strings.Split(text, "\n") {
+		if i == 0 {
+			l = typed + l
+		}
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// pasteDecision is what the shell does with a multi-line paste.
+type pasteDecision int
+
+const (
+	pasteRun     pasteDecision = iota // run the lines in turn
+	pasteAsk                          // show the lines and ask for confirmation
+	pasteDiscard                      // drop the paste with a notice
+)
+
+// pasteAction decides how a paste of lines is handled under mode. A paste
+// that amounts to a single command never needs confirmation.
+func pasteAction(mode string, lines []string) pasteDecision {
+	if len(lines) <= 1 {
+		return pasteRun
+	}
+	switch mode {
+	case PasteConfirm:
+		return pasteAsk
+	case PasteReject:
+		return pasteDiscard
+	}
+	return pasteRun
+}
+
+// confirmPrompt is the question asked before running a pasted block.
+func confirmPrompt(lines []string) string {
+	return fmt.Sprintf("Run %d pasted lines? [y/N] ", len(lines))
+}
+
+// handlePaste runs, confirms, or discards the lines of a multi-line paste
+// according to PasteMode. typed is what was on the line when the paste
+// began. It returns true when one of the lines ran "exit".
+func (s *Shell) handlePaste(rl *readline.Instance, typed, text string) (exit bool) {
+	lines := splitPaste(typed, text)
+	switch pasteAction(s.cfg.PasteMode, lines) {
+	case pasteDiscard:
+		s.writeErr("cobra-shell: discarded a paste of %d lines (PasteMode is %q)\n", len(lines), PasteReject)
+		return false
+	case pasteAsk:
+		for _, l := range lines {
+			fmt.Fprintln(s.stdout(), "  "+l)
+		}
+		if !s.readYesNo(confirmPrompt(lines)) {
+			return false
+		}
+	}
+	for _, l := range lines {
+		if s.execute(l) {
+			return true
+		}
+		rl.SetPrompt(s.prompt())
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package cobrashell
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSplitPaste(t *testing.T) {
+	cases := []struct {
+		typed, text string
+		want        []string
+	}{
+		{"", "echo one\necho two\n", []string{"echo one", "echo two"}},
+		{"", "echo one\r\n\r\necho two", []string{"echo one", "echo two"}},
+		{"", "echo one\recho two", []string{"echo one", "echo two"}},
+		{"echo ", "one\necho two", []string{"echo one", "echo two"}},
+		{"", "\n\n", nil},
+	}
+	for _, tc := range cases {
+		if got := splitPaste(tc.typed, tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitPaste(%q, %q) = %q, want %q", tc.typed, tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestPasteAction(t *testing.T) {
+	two := []string{"echo one", "echo two"}
+	cases := []struct {
+		mode  string
+		lines []string
+		want  pasteDecision
+	}{
+		{PasteConfirm, two, pasteAsk},
+		{PasteLines, two, pasteRun},
+		{PasteReject, two, pasteDiscard},
+		{PasteConfirm, []string{"echo one"}, pasteRun},
+		{PasteReject, []string{"echo one"}, pasteRun},
+	}
+	for _, tc := range cases {
+		if got := pasteAction(tc.mode, tc.lines); got != tc.want {
+			t.Errorf("pasteAction(%q, %d lines) = %v, want %v", tc.mode, len(tc.lines), got, tc.want)
+		}
+	}
+}
+
+func TestPasteReader(t *testing.T) {
+	in := "ab" + pasteStart + "single" + pasteEnd + "c" + pasteStart + "one\ntwo" + pasteEnd + "d"
+	// OneByteReader splits the markers across reads.
+	p := newPasteReader(iotest.OneByteReader(strings.NewReader(in)))
+
+	var out []byte
+	buf := make([]byte, 16)
+	var pastes []string
+	for {
+		n, err := p.Read(buf)
+		out = append(out, buf[:n]...)
+		if text, ok := p.take(); ok {
+			pastes = append(pastes, text)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "absinglec\rd"; string(out) != want {
+		t.Errorf("filtered input = %q, want %q", out, want)
+	}
+	if want := []string{"one\ntwo"}; !reflect.DeepEqual(pastes, want) {
+		t.Errorf("pastes = %q, want %q", pastes, want)
+	}
+}
+
+func TestNew_InvalidPasteMode(t *testing.T) {
+	s := New(Config{BinaryPath: "/usr/bin/true", PasteMode: "ask"})
+	if err := s.Run(); err == nil || !strings.Contains(err.Error(), "PasteMode") {
+		t.Errorf("Run() = %v, want a PasteMode error", err)
+	}
+}
+
+// runPaste drives the interactive loop with input under mode and returns
+// what the commands printed.
+func runPaste(t *testing.T, mode, input string) string {
+	t.Helper()
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	s := New(Config{
+		BinaryPath:  testBinary,
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+		PasteMode:   mode,
+	})
+	return captureStdout(t, func() {
+		if err := s.runInteractive(io.NopCloser(strings.NewReader(input))); err != nil {
+			t.Errorf("runInteractive: %v", err)
+		}
+	})
+}
+
+func TestRunInteractive_PasteModes(t *testing.T) {
+	paste := pasteStart + "greet --name one\ngreet --name two" + pasteEnd
+	ran := func(out string) bool {
+		return strings.Contains(out, "Hello, one!") && strings.Contains(out, "Hello, two!")
+	}
+
+	if out := runPaste(t, PasteLines, paste+"exit\n"); !ran(out) {
+		t.Errorf("lines mode: output %q should contain both pasted commands", out)
+	}
+	if out := runPaste(t, PasteConfirm, paste+"y\nexit\n"); !ran(out) {
+		t.Errorf("confirm mode, accepted: output %q should contain both pasted commands", out)
+	}
+	if out := runPaste(t, PasteConfirm, paste+"n\nexit\n"); strings.Contains(out, "Hello") {
+		t.Errorf("confirm mode, declined: output %q should not contain command output", out)
+	}
+	var out string
+	stderr := captureStderr(t, func() { out = runPaste(t, PasteReject, paste+"exit\n") })
+	if strings.Contains(out, "Hello") || !strings.Contains(stderr, "discarded") {
+		t.Errorf("reject mode: output %q, stderr %q; want no command output and a notice", out, stderr)
+	}
+}
@@ -2,7 +2,13 @@ package cobrashell
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -44,14 +50,145 @@ func Colorize(text, code string) string {
 	return "\x01" + code + "\x02" + text + "\x01" + ColorReset + "\x02"
 }
 
+// ExitIndicator returns a colored glyph summarizing the exit code of the last
+// command, for use in a DynamicPrompt: a green "✓" for 0 and a red "✗"
+// followed by the code otherwise. Codes of the form 128+n, where n is a
+// common signal (see exitStatus), show the signal name instead, e.g.
+// "✗ SIGINT" for 130. The colors are wrapped as by [Colorize].
+//
+//	cfg.DynamicPrompt = func(code int) string {
+//	    return cobrashell.ExitIndicator(code) + " › "
+//	}
+func ExitIndicator(code int) string {
+	if code == 0 {
+		return Colorize("✓", ColorGreen)
+	}
+	if name, ok := signalNames[syscall.Signal(code-128)]; ok && code > 128 {
+		return Colorize("✗ "+name, ColorRed)
+	}
+	return Colorize("✗ "+strconv.Itoa(code), ColorRed)
+}
+
+// PromptContext describes the session for [Config.PromptFunc] when it
+// renders the prompt for the next input line.
+type PromptContext struct {
+	// LastExitCode is the exit code of the most recently executed command,
+	// as returned by [Shell.LastExitCode].
+	LastExitCode int
+
+	// CommandCount is the number of commands run in the session, as
+	// returned by [Shell.CommandCount].
+	CommandCount int
+
+	// LastDuration is the wall-clock time the most recent run of the binary
+	// took, or 0 if it has not run yet. Built-ins do not change it.
+	LastDuration time.Duration
+
+	// WorkingDir is the directory commands run in: Config.WorkingDir when
+	// set, otherwise the shell's own working directory ("" if unknown).
+	WorkingDir string
+
+	// Binary is the absolute path of the wrapped binary.
+	Binary string
+}
+
+// promptData holds the values substituted into a Config.PromptTemplate.
+type promptData struct {
+	binary   string
+	exitCode int
+	now      time.Time
+	cwd      string
+}
+
+// promptColors maps PromptTemplate color tokens to their escape codes.
+var promptColors = map[string]string{
+	"{red}":     ColorRed,
+	"{green}":   ColorGreen,
+	"{yellow}":  ColorYellow,
+	"{blue}":    ColorBlue,
+	"{magenta}": ColorMagenta,
+	"{cyan}":    ColorCyan,
+	"{bold}":    ColorBold,
+	"{reset}":   ColorReset,
+}
+
+// renderPromptTemplate expands the placeholders and color tokens in tmpl.
+// Color codes are wrapped in \x01/\x02 markers, as in [Colorize], so
+// readline measures only the visible characters.
+func renderPromptTemplate(tmpl string, d promptData) string {
+	pairs := []string{
+		"{binary}", d.binary,
+		"{exit}", strconv.Itoa(d.exitCode),
+		"{time}", d.now.Format("15:04"),
+		"{cwd}", d.cwd,
+	}
+	for token, code := range promptColors {
+		pairs = append(pairs, token, "\x01"+code+"\x02")
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+// promptCwd returns wd, the shell's working directory, for the {cwd}
+// placeholder, with the home directory abbreviated to ~. An empty wd stays
+// empty.
+func promptCwd(wd string) string {
+	if wd == "" {
+		return ""
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		if wd == home {
+			return "~"
+		}
+		if rel, err := filepath.Rel(home, wd); err == nil && !strings.HasPrefix(rel, "..") {
+			return "~" + string(filepath.Separator) + rel
+		}
+	}
+	return wd
+}
+
 // writeErr prints a cobra-shell internal error message to stderr. When stderr
 // is a terminal the message is colored red; otherwise it is printed verbatim.
 // The format and args follow [fmt.Sprintf] conventions.
 func writeErr(format string, args ...any) {
+	writeErrTo(os.Stderr, format, args...)
+}
+
+// writeErrTo is writeErr printing to w, colored when w is a terminal.
+func writeErrTo(w io.Writer, format string, args ...any) {
 	msg := fmt.Sprintf(format, args...)
-	if term.IsTerminal(int(os.Stderr.Fd())) {
-		fmt.Fprint(os.Stderr, ColorRed+msg+ColorReset)
+	if isTerminal(w) {
+		fmt.Fprint(w, ColorRed+msg+ColorReset)
 	} else {
-		fmt.Fprint(os.Stderr, msg)
+		fmt.Fprint(w, msg)
+	}
+}
+
+// writeErr formats to the shell's stderr (Config.Stderr), colored when it
+// is a terminal.
+func (s *Shell) writeErr(format string, args ...any) {
+	writeErrTo(s.stderr(), format, args...)
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// stdout returns the shell's standard output: Config.Stdout, or os.Stdout
+// when it is nil. os.Stdout is read on every call rather than stored by New.
+func (s *Shell) stdout() io.Writer {
+	if s.cfg.Stdout != nil {
+		return s.cfg.Stdout
+	}
+	return os.Stdout
+}
+
+// stderr returns the shell's standard error: Config.Stderr, or os.Stderr
+// when it is nil.
+func (s *Shell) stderr() io.Writer {
+	if s.cfg.Stderr != nil {
+		return s.cfg.Stderr
 	}
+	return os.Stderr
 }
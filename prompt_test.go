@@ -1,8 +1,13 @@
 package cobrashell
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // --- Colorize ---
@@ -36,6 +41,25 @@ func TestColorize_EmptyText(t *testing.T) {
 	}
 }
 
+// --- ExitIndicator ---
+
+func TestExitIndicator(t *testing.T) {
+	cases := []struct {
+		code int
+		want string
+	}{
+		{0, "\x01" + ColorGreen + "\x02✓\x01" + ColorReset + "\x02"},
+		{1, "\x01" + ColorRed + "\x02✗ 1\x01" + ColorReset + "\x02"},
+		{130, "\x01" + ColorRed + "\x02✗ SIGINT\x01" + ColorReset + "\x02"},
+		{200, "\x01" + ColorRed + "\x02✗ 200\x01" + ColorReset + "\x02"},
+	}
+	for _, tc := range cases {
+		if got := ExitIndicator(tc.code); got != tc.want {
+			t.Errorf("ExitIndicator(%d) = %q, want %q", tc.code, got, tc.want)
+		}
+	}
+}
+
 // --- DynamicPrompt wiring (Shell) ---
 
 func TestDynamicPrompt_Shell_InitialPromptUsed(t *testing.T) {
@@ -68,6 +92,39 @@ func TestDynamicPrompt_Shell_StoredInConfig(t *testing.T) {
 	}
 }
 
+// --- PromptFunc ---
+
+func TestPromptFunc_ContextAfterCommand(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	dir := t.TempDir()
+	var got PromptContext
+	s := New(Config{
+		BinaryPath:    testBinary,
+		WorkingDir:    dir,
+		DynamicPrompt: func(int) string { return "dynamic> " },
+		PromptFunc: func(pc PromptContext) string {
+			got = pc
+			return fmt.Sprintf("[%d] > ", pc.CommandCount)
+		},
+	})
+	captureStderr(t, func() { discardStdout(t, func() { s.execute("greet ; fail") }) })
+
+	if p := s.prompt(); p != "[2] > " {
+		t.Errorf("prompt = %q, want PromptFunc's to take precedence", p)
+	}
+	if got.LastExitCode != 1 || got.CommandCount != 2 {
+		t.Errorf("PromptContext = %+v, want exit code 1 after 2 commands", got)
+	}
+	if got.LastDuration <= 0 || got.LastDuration > time.Minute {
+		t.Errorf("PromptContext.LastDuration = %v, want a plausible positive value", got.LastDuration)
+	}
+	if got.WorkingDir != dir || got.Binary != s.binary {
+		t.Errorf("PromptContext = %+v, want WorkingDir %q and Binary %q", got, dir, s.binary)
+	}
+}
+
 // --- DynamicPrompt wiring (EmbeddedShell) ---
 
 func TestDynamicPrompt_Embedded_StoredInConfig(t *testing.T) {
@@ -103,3 +160,118 @@ func TestLastExitCode_EmbeddedShell_NonZeroOnError(t *testing.T) {
 		t.Error("expected non-zero lastExitCode for unknown command")
 	}
 }
+
+// --- PromptTemplate ---
+
+func TestRenderPromptTemplate_Placeholders(t *testing.T) {
+	d := promptData{
+		binary:   "kubectl",
+		exitCode: 2,
+		now:      time.Date(2024, 5, 1, 9, 7, 0, 0, time.Local),
+		cwd:      "~/src",
+	}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"{binary}> ", "kubectl> "},
+		{"[{exit}]> ", "[2]> "},
+		{"{time} $ ", "09:07 $ "},
+		{"{cwd}> ", "~/src> "},
+		{"{binary}[{exit}]> ", "kubectl[2]> "},
+		{"{unknown}> ", "{unknown}> "},
+	}
+	for _, tt := range tests {
+		if got := renderPromptTemplate(tt.tmpl, d); got != tt.want {
+			t.Errorf("renderPromptTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPromptTemplate_ColorTokens(t *testing.T) {
+	got := renderPromptTemplate("{green}{binary}{reset}> ", promptData{binary: "app"})
+	want := Colorize("app", ColorGreen) + "> "
+	if got != want {
+		t.Errorf("renderPromptTemplate with colors = %q, want %q", got, want)
+	}
+}
+
+func TestPromptCwd_Home(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if got := promptCwd(home); got != "~" {
+		t.Errorf("promptCwd(%q) = %q, want ~", home, got)
+	}
+}
+
+func TestShellPrompt_CwdFollowsWorkingDir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", os.Getenv("HOME"))
+	dir := t.TempDir()
+	s := &Shell{cfg: Config{PromptTemplate: "{cwd}> ", WorkingDir: dir}}
+	if got := s.prompt(); got != dir+"> " {
+		t.Errorf("prompt() = %q, want %q", got, dir+"> ")
+	}
+	if got := s.promptContext().WorkingDir; got != dir {
+		t.Errorf("PromptContext.WorkingDir = %q, want %q", got, dir)
+	}
+}
+
+func TestShellPrompt_Priority(t *testing.T) {
+	s := &Shell{cfg: Config{Prompt: "static> ", PromptTemplate: "{binary}[{exit}]> "}, binary: "/usr/bin/app", lastExitCode: 1}
+	if got := s.prompt(); got != "app[1]> " {
+		t.Errorf("prompt() with PromptTemplate = %q, want %q", got, "app[1]> ")
+	}
+	s.cfg.DynamicPrompt = func(int) string { return "dyn> " }
+	if got := s.prompt(); got != "dyn> " {
+		t.Errorf("prompt() with DynamicPrompt and PromptTemplate = %q, want dyn> ", got)
+	}
+}
+
+// --- Prompt accessor ---
+
+func TestShellPromptAccessor(t *testing.T) {
+	s := New(Config{
+		BinaryPath:  "/usr/bin/false",
+		Prompt:      "static> ",
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+	})
+	if got := s.Prompt(); got != "static> " {
+		t.Errorf("Prompt() before Run = %q, want static> ", got)
+	}
+
+	s.cfg.DynamicPrompt = func(code int) string { return fmt.Sprintf("[%d]> ", code) }
+	var during string
+	s.cfg.Hooks.BeforeExec = func([]string) error { during = s.Prompt(); return nil }
+	if err := s.runInteractive(io.NopCloser(strings.NewReader("status\nexit\n"))); err != nil {
+		t.Fatalf("runInteractive: %v", err)
+	}
+	if during != "[0]> " {
+		t.Errorf("Prompt() while the command ran = %q, want [0]> ", during)
+	}
+	if got := s.Prompt(); got != "[1]> " {
+		t.Errorf("Prompt() after a failed command = %q, want [1]> ", got)
+	}
+}
+
+func TestEmbeddedShellPromptAccessor(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{
+		RootCmd:     newTestRoot(),
+		Prompt:      "static> ",
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+	})
+	if got := sh.Prompt(); got != "static> " {
+		t.Errorf("Prompt() before Run = %q, want static> ", got)
+	}
+
+	sh.cfg.DynamicPrompt = func(code int) string { return fmt.Sprintf("[%d]> ", code) }
+	captureStderr(t, func() {
+		if err := sh.run(io.NopCloser(strings.NewReader("nonexistentcmd\nexit\n"))); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	})
+	if got := sh.Prompt(); got != "[1]> " {
+		t.Errorf("Prompt() after a failed command = %q, want [1]> ", got)
+	}
+}
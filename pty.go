@@ -1,7 +1,9 @@
+//go:build !windows
+
 package cobrashell
 
 import (
-	"errors"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -13,28 +15,34 @@ import (
 	"golang.org/x/term"
 )
 
-// spawnCommand runs binary with tokens, using a PTY when stdin is a real
-// terminal and falling back to a plain subprocess otherwise.
+// spawnCommand runs binary with tokens in dir (the current directory when
+// empty), using a PTY when stdin is a real
+// terminal and falling back to a plain subprocess otherwise. Output is also
+// copied into taps.
 //
 // PTY mode enables colour output for binaries that check isatty, and allows
 // interactive subcommands (vim, less, ssh) to work correctly. When stdin is
 // not a terminal (tests, pipelines) or PTY creation fails, plain mode is used
 // with direct stdin/stdout/stderr inheritance.
-func spawnCommand(binary string, tokens []string, env []string) (exitCode int, err error) {
+func spawnCommand(binary string, tokens []string, dir string, env []string, taps outputTaps) (status exitStatus, err error) {
 	if term.IsTerminal(int(os.Stdin.Fd())) {
 		cmd := exec.Command(binary, tokens...)
+		cmd.Dir = dir
 		cmd.Env = env
 		// pty.Start sets cmd.Stdin/Stdout/Stderr to the slave end and calls
 		// cmd.Start. If it returns an error, cmd has not been started, so we
 		// can safely fall through to runPlain with a fresh exec.Cmd.
 		if ptmx, ptErr := pty.Start(cmd); ptErr == nil {
-			return runWithPTY(cmd, ptmx)
+			status, err = runWithPTY(cmd, ptmx, taps)
+			status.pty = true
+			return status, err
 		}
 	}
 
 	cmd := exec.Command(binary, tokens...)
+	cmd.Dir = dir
 	cmd.Env = env
-	return runPlain(cmd)
+	return runPlain(cmd, taps)
 }
 
 // runWithPTY drives an already-started subprocess through its PTY master.
@@ -44,7 +52,7 @@ func spawnCommand(binary string, tokens []string, env []string) (exitCode int, e
 // master; the slave's line discipline converts it to SIGINT for the subprocess
 // process group. The cobra-shell parent process never receives SIGINT while in
 // raw mode, so no explicit SIGINT suppression is needed here.
-func runWithPTY(cmd *exec.Cmd, ptmx *os.File) (exitCode int, err error) {
+func runWithPTY(cmd *exec.Cmd, ptmx *os.File, taps outputTaps) (status exitStatus, err error) {
 	defer func() { _ = ptmx.Close() }()
 
 	// Propagate terminal size changes to the PTY so the subprocess sees the
@@ -69,7 +77,7 @@ func runWithPTY(cmd *exec.Cmd, ptmx *os.File) (exitCode int, err error) {
 	if err != nil {
 		// Should not happen after IsTerminal check, but handle gracefully.
 		_ = cmd.Wait()
-		return 0, fmt.Errorf("cobra-shell: set raw mode: %w", err)
+		return exitStatus{}, fmt.Errorf("cobra-shell: set raw mode: %w", err)
 	}
 	defer func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }()
 
@@ -77,37 +85,27 @@ func runWithPTY(cmd *exec.Cmd, ptmx *os.File) (exitCode int, err error) {
 	// The stdin→ptmx goroutine exits when ptmx is closed.
 	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
 	// ptmx→stdout returns with EIO when the slave is closed (subprocess exits).
-	_, _ = io.Copy(os.Stdout, ptmx)
+	// The PTY merges stdout and stderr, so the stderr tap sees both.
+	_, _ = io.Copy(taps.stderrTo(taps.stdoutDest()), ptmx)
 
-	if err := cmd.Wait(); err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return exitErr.ExitCode(), nil
-		}
-		return 0, err
-	}
-	return 0, nil
+	return statusFromWait(cmd.Wait())
 }
 
-// runPlain runs cmd with inherited stdin/stdout/stderr and no PTY.
-// SIGINT is suppressed in the parent while the child runs: the terminal
-// delivers SIGINT to the entire foreground process group, so the child
-// still receives it and can handle or be killed by it normally.
-func runPlain(cmd *exec.Cmd) (exitCode int, err error) {
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	defer signal.Stop(sig)
-
-	if err := cmd.Run(); err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return exitErr.ExitCode(), nil
-		}
-		return 0, err
+// runCaptureWithPTY runs cmd with its stdin and stdout attached to a new PTY
+// and copies everything the child prints into out, converting the line
+// discipline's CRLF line endings back to LF. cmd.Stderr is left as configured
+// by the caller. A PTY that cannot be allocated is reported as an error.
+func runCaptureWithPTY(cmd *exec.Cmd, out *bytes.Buffer) error {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return fmt.Errorf("cobra-shell: start pty: %w", err)
 	}
-	return 0, nil
+	defer func() { _ = ptmx.Close() }()
+
+	var raw bytes.Buffer
+	// Returns with EIO once the child exits and the slave end is closed.
+	_, _ = io.Copy(&raw, ptmx)
+	err = cmd.Wait()
+	out.Write(bytes.ReplaceAll(raw.Bytes(), []byte("\r\n"), []byte("\n")))
+	return err
 }
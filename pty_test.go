@@ -0,0 +1,41 @@
+//go:build !windows
+
+package cobrashell
+
+import "testing"
+
+func TestIntegration_TryComplete_RequireTTY_PlainPipe(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Env = []string{"TESTBIN_REQUIRE_TTY=1"}
+	c := &completer{shell: sh}
+
+	candidates, _, ok := c.tryComplete(nil, "gr")
+	if !ok {
+		t.Fatal("tryComplete returned ok=false")
+	}
+	if len(candidates) != 0 {
+		t.Errorf("tryComplete without a PTY = %v, want empty", candidates)
+	}
+}
+
+func TestIntegration_TryComplete_PTYCompletion(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Env = []string{"TESTBIN_REQUIRE_TTY=1"}
+	sh.cfg.PTYCompletion = true
+	c := &completer{shell: sh}
+
+	candidates, directive, ok := c.tryComplete([]string{"serve"}, "")
+	if !ok {
+		t.Fatal("tryComplete returned ok=false")
+	}
+	assertSameElements(t, candidates, []string{"start", "stop"})
+	if directive&compDirectiveNoFileComp == 0 {
+		t.Errorf("directive = %d, want NoFileComp bit set", directive)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package cobrashell
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// spawnCommand runs binary with tokens in dir as a plain subprocess. Windows has no
+// PTY slave semantics comparable to Unix, so the PTY path is never used; the
+// child inherits the console directly unless output is tapped.
+func spawnCommand(binary string, tokens []string, dir string, env []string, taps outputTaps) (status exitStatus, err error) {
+	cmd := exec.Command(binary, tokens...)
+	cmd.Dir = dir
+	cmd.Env = env
+	return runPlain(cmd, taps)
+}
+
+// runCaptureWithPTY runs cmd with its output captured into out. Windows has
+// no PTY to attach, so Config.PTYCompletion is ignored and a plain pipe is
+// used.
+func runCaptureWithPTY(cmd *exec.Cmd, out *bytes.Buffer) error {
+	cmd.Stdout = out
+	return cmd.Run()
+}
@@ -0,0 +1,91 @@
+package cobrashell
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// completionRecord is one line of a completion recording written when
+// Config.CompletionRecordFile is set.
+type completionRecord struct {
+	Args       []string `json:"args"`
+	ToComplete string   `json:"toComplete"`
+	Candidates []string `json:"candidates"`
+	Directive  int      `json:"directive"`
+}
+
+// record appends a completion request and its result to
+// Config.CompletionRecordFile. Errors are ignored: recording is a debugging
+// aid and must never interfere with completion.
+func (c *completer) record(contextArgs []string, toComplete string, candidates []string, directive int) {
+	line, err := json.Marshal(completionRecord{
+		Args:       contextArgs,
+		ToComplete: toComplete,
+		Candidates: candidates,
+		Directive:  directive,
+	})
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(c.shell.cfg.CompletionRecordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(line, '\n'))
+}
+
+// ReplayCompletions re-runs every completion request stored in the recording
+// at path (as written via Config.CompletionRecordFile) and compares the
+// results with the recorded ones. It returns nil when every request yields the
+// same candidates, in the same order, and the same directive; otherwise the
+// error describes each mismatch.
+//
+// ReplayCompletions is intended for golden-file tests of a wrapped binary:
+//
+//	sh := cobrashell.New(cobrashell.Config{BinaryPath: "./myapp"})
+//	if err := sh.ReplayCompletions("testdata/completions.jsonl"); err != nil {
+//	    t.Fatal(err)
+//	}
+//
+// Replaying never appends to Config.CompletionRecordFile.
+func (s *Shell) ReplayCompletions(path string) error {
+	if s.initErr != nil {
+		return s.initErr
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cobra-shell: open recording: %w", err)
+	}
+	defer f.Close()
+
+	c := &completer{shell: s, replay: true}
+	var mismatches []error
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec completionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("cobra-shell: recording line %d: %w", n, err)
+		}
+		candidates, directive := c.complete(rec.Args, rec.ToComplete)
+		if !slices.Equal(candidates, rec.Candidates) || directive != rec.Directive {
+			mismatches = append(mismatches, fmt.Errorf(
+				"line %d: complete(%q, %q) = %q :%d, recorded %q :%d",
+				n, rec.Args, rec.ToComplete, candidates, directive, rec.Candidates, rec.Directive))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cobra-shell: read recording: %w", err)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("cobra-shell: completion replay mismatch:\n%w", errors.Join(mismatches...))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIntegration_RecordAndReplay(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	file := filepath.Join(t.TempDir(), "completions.jsonl")
+	sh := newIntegrationShell()
+	sh.cfg.CompletionRecordFile = file
+	c := &completer{shell: sh}
+
+	c.complete(nil, "gr")
+	c.complete([]string{"greet"}, "--na")
+	c.complete([]string{"help", "serve"}, "")
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read recording: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("recording has %d lines, want 3:\n%s", lines, data)
+	}
+
+	if err := sh.ReplayCompletions(file); err != nil {
+		t.Errorf("ReplayCompletions: %v", err)
+	}
+
+	// Replaying must not append to the recording.
+	after, _ := os.ReadFile(file)
+	if string(after) != string(data) {
+		t.Error("ReplayCompletions modified the recording file")
+	}
+}
+
+func TestIntegration_ReplayMismatch(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	file := filepath.Join(t.TempDir(), "completions.jsonl")
+	golden := `{"args":null,"toComplete":"gr","candidates":["grumble"],"directive":4}` + "\n"
+	if err := os.WriteFile(file, []byte(golden), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := newIntegrationShell().ReplayCompletions(file)
+	if err == nil {
+		t.Fatal("ReplayCompletions = nil, want mismatch error")
+	}
+	if !strings.Contains(err.Error(), "grumble") || !strings.Contains(err.Error(), "greet") {
+		t.Errorf("error = %v, want recorded and actual candidates described", err)
+	}
+}
+
+func TestReplayCompletions_MissingFile(t *testing.T) {
+	s := makeEnvShell("")
+	if err := s.ReplayCompletions(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("ReplayCompletions on a missing file = nil, want error")
+	}
+}
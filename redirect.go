@@ -0,0 +1,58 @@
+package cobrashell
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// splitInputRedirect removes an input redirection "< file" from tokens and
+// returns the remaining arguments and the file. Like "|", "<" must stand
+// alone between spaces; it may appear anywhere after the command name. path
+// is "" when there is no redirection.
+func splitInputRedirect(tokens []string) (args []string, path string, err error) {
+	for i, t := range tokens {
+		if t != "<" {
+			continue
+		}
+		if path != "" {
+			return nil, "", errors.New("more than one input redirection")
+		}
+		if i+1 >= len(tokens) || tokens[i+1] == "<" {
+			return nil, "", errors.New("missing file name after <")
+		}
+		path = tokens[i+1]
+	}
+	if path == "" {
+		return tokens, "", nil
+	}
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] == "<" {
+			i++
+			continue
+		}
+		args = append(args, tokens[i])
+	}
+	return args, path, nil
+}
+
+// openInput opens the file of an input redirection. A relative path is
+// resolved against Config.WorkingDir, where the binary runs.
+func (s *Shell) openInput(path string) (*os.File, error) {
+	if s.cfg.WorkingDir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(s.cfg.WorkingDir, path)
+	}
+	return os.Open(path)
+}
+
+// spawnWithInput runs the binary with tokens like spawnCommand, but with
+// input as its stdin. No PTY is used: the child's stdin is the file rather
+// than the terminal.
+func (s *Shell) spawnWithInput(tokens []string, input *os.File, taps outputTaps) (exitStatus, error) {
+	cmd := exec.Command(s.binary, tokens...)
+	cmd.Dir = s.cfg.WorkingDir
+	cmd.Env = s.buildEnv()
+	cmd.Stdin = input
+	return runPlain(cmd, taps)
+}
@@ -0,0 +1,63 @@
+package cobrashell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitInputRedirect(t *testing.T) {
+	cases := []struct {
+		tokens []string
+		args   string
+		path   string
+		err    bool
+	}{
+		{[]string{"import", "--dry-run"}, "import --dry-run", "", false},
+		{[]string{"import", "<", "data.txt"}, "import", "data.txt", false},
+		{[]string{"import", "<", "data.txt", "--dry-run"}, "import --dry-run", "data.txt", false},
+		{[]string{"import", "<"}, "", "", true},
+		{[]string{"import", "<", "a", "<", "b"}, "", "", true},
+	}
+	for _, tc := range cases {
+		args, path, err := splitInputRedirect(tc.tokens)
+		if (err != nil) != tc.err {
+			t.Errorf("splitInputRedirect(%q) error = %v, want error %v", tc.tokens, err, tc.err)
+			continue
+		}
+		if strings.Join(args, " ") != tc.args || path != tc.path {
+			t.Errorf("splitInputRedirect(%q) = %q, %q; want %q, %q", tc.tokens, args, path, tc.args, tc.path)
+		}
+	}
+}
+
+func TestIntegration_InputRedirect(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("line one\nline two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sh := newIntegrationShell()
+	sh.cfg.WorkingDir = dir
+	var got []string
+	sh.cfg.Hooks.BeforeExec = func(tokens []string) error { got = tokens; return nil }
+
+	out := captureStdout(t, func() { sh.executeOne("cat < data.txt") })
+	if out != "line one\nline two\n" {
+		t.Errorf("output = %q, want the file contents", out)
+	}
+	if len(got) != 1 || got[0] != "cat" {
+		t.Errorf("BeforeExec tokens = %q, want [cat]", got)
+	}
+
+	stderr := captureStderr(t, func() { sh.executeOne("cat < missing.txt") })
+	if !strings.Contains(stderr, "missing.txt") || sh.lastExitCode != 1 {
+		t.Errorf("missing file: stderr %q, exit %d; want an open error and exit 1", stderr, sh.lastExitCode)
+	}
+	if sh.unreachable {
+		t.Error("a missing input file marked the binary unreachable")
+	}
+}
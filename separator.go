@@ -0,0 +1,72 @@
+package cobrashell
+
+// splitCommands splits line into the commands separated by sep, e.g. "a ; b"
+// with sep ";" yields "a " and " b". Like "|", the separator is recognised
+// only as a standalone, unquoted word outside $(...) and `...` — "a;b",
+// "a ';' b" and "a $(b ; c)" are single commands. Segments are returned
+// verbatim (untrimmed) so that pipes and quoting inside each one are
+// preserved for execution. When sep is empty or does not occur, the result
+// is []string{line}.
+func splitCommands(line, sep string) []string {
+	if sep == "" {
+		return []string{line}
+	}
+
+	var segments []string
+	segStart := 0
+	wordStart := -1
+	quoted := false // the current word contains quoting or escapes
+	var quote byte  // active quote character, 0 outside quotes
+	escaped := false
+
+	endWord := func(end int) {
+		if wordStart >= 0 && !quoted && line[wordStart:end] == sep {
+			segments = append(segments, line[segStart:wordStart])
+			segStart = end
+		}
+		wordStart = -1
+		quoted = false
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			switch {
+			case ch == quote:
+				quote = 0
+			case quote == '"' && ch == '\\':
+				escaped = true
+			case quote == '"':
+				if end, ok := substitutionEnd(line, i); ok {
+					i = end
+				}
+			}
+		case ch == '$' || ch == '`':
+			if end, ok := substitutionEnd(line, i); ok {
+				if wordStart < 0 {
+					wordStart = i
+				}
+				quoted = true
+				i = end
+				continue
+			}
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			endWord(i)
+			continue
+		case ch == '\'' || ch == '"':
+			quote = ch
+			quoted = true
+		case ch == '\\':
+			escaped = true
+			quoted = true
+		}
+		if wordStart < 0 {
+			wordStart = i
+		}
+	}
+	endWord(len(line))
+	return append(segments, line[segStart:])
+}
@@ -0,0 +1,111 @@
+package cobrashell
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		line string
+		sep  string
+		want []string
+	}{
+		{"greet ; fail ; echo done", ";", []string{"greet ", " fail ", " echo done"}},
+		{"greet", ";", []string{"greet"}},
+		{"echo a;b", ";", []string{"echo a;b"}},
+		{"echo ';' x", ";", []string{"echo ';' x"}},
+		{`echo "a ; b" ; greet`, ";", []string{`echo "a ; b" `, " greet"}},
+		{`echo \; x`, ";", []string{`echo \; x`}},
+		{"get | grep a ; greet", ";", []string{"get | grep a ", " greet"}},
+		{"greet && fail", "&&", []string{"greet ", " fail"}},
+		{"greet ; fail", "", []string{"greet ; fail"}},
+		{"greet ; ", ";", []string{"greet ", " "}},
+		{"echo $(echo a ; echo b) ; greet", ";", []string{"echo $(echo a ; echo b) ", " greet"}},
+		{"echo `echo a ; echo b`", ";", []string{"echo `echo a ; echo b`"}},
+		{`echo "$(echo "a ; b")" ; greet`, ";", []string{`echo "$(echo "a ; b")" `, " greet"}},
+		{"echo $(echo a ; b", ";", []string{"echo $(echo a ", " b"}},
+	}
+	for _, tt := range tests {
+		if got := splitCommands(tt.line, tt.sep); !slices.Equal(got, tt.want) {
+			t.Errorf("splitCommands(%q, %q) = %q, want %q", tt.line, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestIntegration_Execute_CommandSeparator(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	type call struct {
+		args []string
+		code int
+	}
+	var calls []call
+	sh := newIntegrationShell()
+	sh.cfg.CommandSeparator = ";"
+	sh.cfg.Hooks.AfterExec = func(args []string, code int) { calls = append(calls, call{args, code}) }
+
+	out := captureStdout(t, func() { sh.execute("greet ; fail ; echo done | cat") })
+
+	if len(calls) != 3 {
+		t.Fatalf("AfterExec called %d times, want 3: %v", len(calls), calls)
+	}
+	wantArgs := [][]string{{"greet"}, {"fail"}, {"echo", "done"}}
+	for i, c := range calls {
+		if !slices.Equal(c.args, wantArgs[i]) {
+			t.Errorf("segment %d args = %q, want %q", i, c.args, wantArgs[i])
+		}
+	}
+	if calls[1].code == 0 {
+		t.Error("fail segment exit code = 0, want non-zero")
+	}
+	if want := "Hello, world!\ndone\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestIntegration_CompleterDo_AfterSeparator(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CommandSeparator = ";"
+	c := &completer{shell: sh}
+
+	line := []rune("echo hi ; gr")
+	got, length := c.Do(line, len(line))
+	if length != 2 || len(got) != 1 || string(got[0]) != "eet" {
+		t.Errorf("Do(%q) = %q, %d; want [eet], 2", string(line), got, length)
+	}
+}
+
+func TestIntegration_RunLines_ExitAfterSeparator(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CommandSeparator = ";"
+	out := captureStdout(t, func() {
+		if err := sh.runLines(strings.NewReader("greet ; exit ; greet --name after\ngreet --name next\n")); err != nil {
+			t.Errorf("runLines: %v", err)
+		}
+	})
+	if want := "Hello, world!\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestIntegration_Execute_DisableCommandSeparator(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CommandSeparator = ";"
+	sh.cfg.DisableCommandSeparator = true
+	out := captureStdout(t, func() { sh.execute("echo a ; b") })
+	if want := "a\n;\nb\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
@@ -1,32 +1,61 @@
 package cobrashell
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/chzyer/readline"
 	"github.com/google/shlex"
+	"golang.org/x/term"
 )
 
 const (
 	defaultPrompt            = "> "
 	defaultCompletionTimeout = 500 * time.Millisecond
+	defaultCommandSeparator  = ";"
+	defaultCommentPrefix     = "#"
 )
 
 // Shell wraps a Cobra binary in an interactive readline loop. Create one with
 // [New] and start it with [Run].
 type Shell struct {
-	cfg          Config
-	binary       string            // resolved absolute path; empty when initErr is set
-	initErr      error             // deferred error from New, returned by Run
-	sessionEnv   map[string]string // runtime env overrides; set via SetEnv/UnsetEnv
-	lastExitCode int               // exit code of the most recently executed command
+	cfg              Config
+	binary           string             // resolved absolute path; empty when initErr is set
+	binaryArg        string             // BinaryPath or use argument the binary was resolved from
+	initErr          error              // deferred error from New, returned by Run
+	envMu            sync.RWMutex       // guards sessionEnv
+	sessionEnv       map[string]string  // runtime env overrides; set via SetEnv/UnsetEnv
+	lastExitCode     int                // exit code of the most recently executed command
+	commandCount     int                // commands accepted this session; see CommandCount
+	lastDuration     time.Duration      // run time of the most recent command; see PromptContext
+	prevLine         string             // previous input line, after preprocessing; see PreprocessLine
+	rl               *readline.Instance // active readline instance; nil outside Run
+	promptDefaulted  bool               // Prompt was not configured; follows the active binary
+	historyDefaulted bool               // HistoryFile was not configured; follows the active binary
+	jobs             jobTable           // running background jobs; see JobsBuiltin
+	lastOutput       *outputBuffer      // output of the last command; nil unless CaptureOutput
+	compCache        *completionCache   // nil unless PersistentCompletionCache
+	errorHints       []compiledHint     // compiled Config.ErrorHints
+	notFoundPattern  *regexp.Regexp     // compiled CommandNotFoundPattern; nil unless OnCommandNotFound is set
+	confirmPatterns  []*regexp.Regexp   // compiled Config.ConfirmPatterns
+	contexts         [][]string         // entered contexts, outermost first; see ContextBuiltin
+	lastSource       string             // source of the last completion; see CompletionSourceBuiltin
+	forcedSource     string             // completion source forced by completion-source; "" for auto
+	unreachable      bool               // the last attempt to run the binary failed to start it
+	shownPrompt      string             // most recently rendered prompt; see Prompt
 }
 
 // New creates a Shell from cfg. BinaryPath is resolved to an absolute path
@@ -44,16 +73,54 @@ func New(cfg Config) *Shell {
 		return s
 	}
 	s.binary = binary
+	s.binaryArg = cfg.BinaryPath
 	s.sessionEnv = make(map[string]string)
 
 	if cfg.Prompt == "" {
 		cfg.Prompt = defaultPrompt
+		s.promptDefaulted = true
 	}
 	if cfg.CompletionTimeout == 0 {
 		cfg.CompletionTimeout = defaultCompletionTimeout
 	}
 	if cfg.HistoryFile == "" {
 		cfg.HistoryFile = defaultHistoryFilePath(binary)
+		s.historyDefaulted = true
+	}
+	if cfg.CommandSeparator == "" {
+		cfg.CommandSeparator = defaultCommandSeparator
+	}
+	if cfg.CommentPrefix == nil {
+		prefix := defaultCommentPrefix
+		cfg.CommentPrefix = &prefix
+	}
+	if err := validateWorkingDir(cfg.WorkingDir); err != nil {
+		s.initErr = err
+		s.cfg = cfg
+		return s
+	}
+	if err := validatePasteMode(cfg.PasteMode); err != nil {
+		s.initErr = err
+		s.cfg = cfg
+		return s
+	}
+	if s.errorHints, err = compileErrorHints(cfg.ErrorHints); err != nil {
+		s.initErr = err
+		s.cfg = cfg
+		return s
+	}
+	if s.notFoundPattern, err = compileCommandNotFound(cfg); err != nil {
+		s.initErr = err
+		s.cfg = cfg
+		return s
+	}
+	if s.confirmPatterns, err = compileConfirmPatterns(cfg.ConfirmPatterns); err != nil {
+		s.initErr = err
+		s.cfg = cfg
+		return s
+	}
+	if cfg.PersistentCompletionCache != "" {
+		s.compCache = loadCompletionCache(cfg.PersistentCompletionCache, binary, cfg.WorkingDir)
 	}
 
 	s.cfg = cfg
@@ -61,42 +128,138 @@ func New(cfg Config) *Shell {
 }
 
 // Run starts the interactive shell loop. It blocks until the user exits via
-// Ctrl-D or the built-in "exit" command.
+// Ctrl-D or the built-in "exit" command. A line ending in an unescaped
+// backslash continues on the next line, read with a "> " prompt.
+//
+// When stdin is not a terminal (e.g. "echo greet | cobra-shell ..."), Run
+// skips readline and executes each input line in order until EOF; see
+// runLines. When Config.DemoScript is set, Run plays the script instead of
+// reading input.
 //
 // Run returns a non-nil error if:
 //   - BinaryPath could not be resolved (error stored by [New])
 //   - readline fails to initialise (e.g. history file is unwritable)
+//   - reading stdin fails in pipe mode
 //
-// A clean exit (Ctrl-D, "exit") returns nil.
+// A clean exit (Ctrl-D, "exit", EOF) returns nil.
 func (s *Shell) Run() error {
 	if s.initErr != nil {
 		return s.initErr
 	}
+	s.commandCount = 0
 
-	initialPrompt := s.cfg.Prompt
-	if s.cfg.DynamicPrompt != nil {
-		initialPrompt = s.cfg.DynamicPrompt(0)
+	if s.cfg.WarmupOnStart {
+		go s.warmup(s.buildEnv())
+	}
+	if len(s.cfg.DemoScript) > 0 {
+		return s.runDemo()
 	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return s.runLines(os.Stdin)
+	}
+	return s.runInteractive(nil)
+}
 
+// Exec runs a single line exactly as if it had been typed at the prompt —
+// aliases, separators, pipes, redirections, the session env, built-ins, and
+// the BeforeExec/AfterExec hooks all apply — and returns the exit code of
+// the last command it ran (see [Shell.LastExitCode]). It does not start the
+// input loop, so OnStart and OnExit are not called, and an "exit" command
+// only skips the rest of line. It is meant for scripts and tests that need
+// one command and its result:
+//
+//	code, err := sh.Exec("greet --name bob")
+//
+// Exec returns the error stored by [New], if any, without running line.
+func (s *Shell) Exec(line string) (int, error) {
+	if s.initErr != nil {
+		return 0, s.initErr
+	}
+	s.execute(strings.TrimSpace(line))
+	return s.lastExitCode, nil
+}
+
+// warmup runs a cheap completion request against the binary for
+// WarmupOnStart, discarding the result. It is bounded by CompletionTimeout
+// like a real completion. env is built by the caller so that the goroutine
+// does not read the session env while commands modify it.
+func (s *Shell) warmup(env []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.CompletionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.binary, "__completeNoDesc", "")
+	cmd.Dir = s.cfg.WorkingDir
+	cmd.Env = env
+	_ = cmd.Run()
+}
+
+// runInteractive is the readline loop behind Run. stdin, when non-nil,
+// replaces os.Stdin as readline's input; tests use it to drive the loop
+// without a terminal.
+func (s *Shell) runInteractive(stdin io.ReadCloser) error {
+	s.cfg.HistoryFile = prepareHistoryFile(s.stderr(), s.cfg.HistoryFile)
+	seedHistory := len(s.cfg.AdditionalHistoryFiles) > 0 && s.cfg.HistoryFile == ""
+	if len(s.cfg.AdditionalHistoryFiles) > 0 && s.cfg.HistoryFile != "" {
+		merged, err := mergeHistoryFiles(s.cfg.HistoryFile, s.cfg.AdditionalHistoryFiles)
+		if err != nil {
+			s.writeErr("cobra-shell: merge history: %v\n", err)
+		}
+		seedHistory = !merged && err == nil
+	}
+
+	var paste *pasteReader
+	if s.cfg.PasteMode != "" {
+		var in io.Reader = os.Stdin
+		if stdin != nil {
+			in = stdin
+		}
+		paste = newPasteReader(in)
+		stdin = io.NopCloser(paste)
+	}
+
+	comp := &completer{shell: s}
+	if s.cfg.CompletionSpinner && isTerminal(s.stdout()) {
+		comp.spinner = s.stdout()
+	}
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          initialPrompt,
+		Prompt:          s.prompt(),
 		HistoryFile:     s.cfg.HistoryFile,
-		AutoComplete:    &completer{shell: s},
+		AutoComplete:    comp,
 		InterruptPrompt: "",
 		EOFPrompt:       "exit",
+		Stdin:           stdin,
+		Stdout:          s.stdout(),
+		Stderr:          s.stderr(),
 	})
 	if err != nil {
 		return fmt.Errorf("cobra-shell: initialise readline: %w", err)
 	}
 	defer rl.Close()
+	if s.cfg.ConfigureReadline != nil {
+		s.cfg.ConfigureReadline(rl)
+	}
+	if paste != nil {
+		fmt.Fprint(s.stdout(), bracketedPasteOn)
+		defer fmt.Fprint(s.stdout(), bracketedPasteOff)
+	}
+	s.rl = rl
+	defer func() { s.rl = nil }()
+
+	if seedHistory {
+		// No persistence, or a history file that is not a regular file and
+		// so cannot be rewritten: seed the in-memory history instead.
+		for _, entry := range mergeHistory(readHistoryFiles(s.cfg.AdditionalHistoryFiles)) {
+			_ = rl.SaveHistory(entry)
+		}
+	}
 
+	s.printBanner()
 	if s.cfg.Hooks.OnStart != nil {
 		s.cfg.Hooks.OnStart(s)
 	}
 
 	for {
 		if s.cfg.PrePrompt != "" {
-			fmt.Print(s.cfg.PrePrompt)
+			fmt.Fprint(s.stdout(), s.cfg.PrePrompt)
 		}
 		line, err := rl.Readline()
 		if err == io.EOF {
@@ -110,73 +273,457 @@ func (s *Shell) Run() error {
 		if err != nil {
 			return fmt.Errorf("cobra-shell: readline: %w", err)
 		}
+		if text, ok := paste.take(); ok {
+			// line is what was typed before a multi-line paste began.
+			if s.handlePaste(rl, line, text) {
+				break
+			}
+			continue
+		}
+		if continues(line) {
+			line, err = joinContinued(line, func() (string, error) {
+				rl.SetPrompt(continuationPrompt)
+				return rl.Readline()
+			})
+			rl.SetPrompt(s.prompt())
+			if err == io.EOF {
+				break
+			}
+			if errors.Is(err, readline.ErrInterrupt) {
+				// Ctrl-C abandons the whole command, not just this line.
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("cobra-shell: readline: %w", err)
+			}
+		}
 
 		line = strings.TrimSpace(line)
 		if line == "" {
 			// Empty input is a no-op: no subprocess, no history entry.
 			continue
 		}
-		if line == "exit" {
+		if s.execute(line) {
 			break
 		}
+		rl.SetPrompt(s.prompt())
+	}
+
+	s.killJobs()
+	if s.cfg.Hooks.OnExit != nil {
+		s.cfg.Hooks.OnExit()
+	}
+	return nil
+}
+
+// maxCapturedOutput bounds the output retained by Config.CaptureOutput.
+const maxCapturedOutput = 1 << 20
+
+// outputTaps returns the taps for the command about to run. With
+// CaptureOutput, a fresh LastOutput buffer replaces the previous command's.
+// With ErrorHints or a command-not-found pattern, stderr is collected into
+// the returned buffer for hint matching; otherwise the buffer stays empty.
+func (s *Shell) outputTaps() (outputTaps, *outputBuffer) {
+	taps := outputTaps{out: s.cfg.Stdout, errOut: s.cfg.Stderr}
+	if s.cfg.CaptureOutput {
+		s.lastOutput = &outputBuffer{limit: maxCapturedOutput}
+		taps.output = s.lastOutput
+	}
+	stderr := &outputBuffer{limit: maxCapturedOutput}
+	if len(s.errorHints) > 0 || s.notFoundPattern != nil {
+		taps.stderr = stderr
+	}
+	return taps, stderr
+}
 
-		s.execute(line)
-		if s.cfg.DynamicPrompt != nil {
-			rl.SetPrompt(s.cfg.DynamicPrompt(s.lastExitCode))
+// LastOutput returns the combined stdout and stderr of the most recent
+// command that ran the binary (including pipelines), when Config.CaptureOutput
+// is set. Only the last 1 MiB is kept. It returns "" when capture is off or
+// no command has run yet.
+func (s *Shell) LastOutput() string {
+	if s.lastOutput == nil {
+		return ""
+	}
+	return s.lastOutput.String()
+}
+
+// LastExitCode returns the exit code of the most recently executed command,
+// or 0 when none has run. After Run returns it is the result of the last
+// command of the session, for callers that want to exit with it.
+func (s *Shell) LastExitCode() int {
+	return s.lastExitCode
+}
+
+// CommandCount returns the number of commands run in the current session,
+// like bash's \# prompt escape: every command that parses counts, built-ins
+// included, and each command of a separated line counts on its own. It is
+// reset to 0 when Run starts. During BeforeExec, AfterExec, and the next
+// prompt it is the number of the command just run.
+func (s *Shell) CommandCount() int {
+	return s.commandCount
+}
+
+// Readline returns the readline instance driving the interactive loop, for
+// advanced hooks that need to adjust the prompt, history, or input buffer
+// (e.g. rl.WriteStdin to pre-fill the next line). It is nil before Run
+// starts and after it returns, and also in pipe mode, where readline is not
+// used. It is valid from OnStart onwards, including inside BeforeExec and
+// AfterExec.
+func (s *Shell) Readline() *readline.Instance {
+	return s.rl
+}
+
+// runLines is the non-interactive loop used when stdin is not a terminal. It
+// reads r line by line and executes each one exactly as the interactive loop
+// would, without prompts, completion, or history. Lines starting with
+// Config.CommentPrefix are skipped, and a line ending in a backslash
+// continues on the next one. It stops at EOF or on an "exit" command.
+// OnStart and OnExit are called as in interactive mode.
+func (s *Shell) runLines(r io.Reader) error {
+	if s.cfg.Hooks.OnStart != nil {
+		s.cfg.Hooks.OnStart(s)
+	}
+
+	scanner := bufio.NewScanner(r)
+	next := func() (string, error) {
+		if !scanner.Scan() {
+			return "", io.EOF
+		}
+		return scanner.Text(), nil
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || s.isComment(line) {
+			continue
+		}
+		// A script ending mid-command runs what it has.
+		line, _ = joinContinued(scanner.Text(), next)
+		if s.execute(strings.TrimSpace(line)) {
+			break
 		}
 	}
 
+	s.killJobs()
 	if s.cfg.Hooks.OnExit != nil {
 		s.cfg.Hooks.OnExit()
 	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cobra-shell: read stdin: %w", err)
+	}
 	return nil
 }
 
-// execute tokenises line, runs BeforeExec, spawns the binary, and runs
-// AfterExec. SIGINT is caught in the parent while the child runs so that
-// Ctrl-C cancels the child but does not exit the shell.
-func (s *Shell) execute(line string) {
-	tokens, err := shlex.Split(line)
+// isComment reports whether line, already trimmed, is a comment line of
+// the non-interactive loop.
+func (s *Shell) isComment(line string) bool {
+	prefix := s.cfg.CommentPrefix
+	return prefix != nil && *prefix != "" && strings.HasPrefix(line, *prefix)
+}
+
+// Prompt returns the prompt currently in effect: the one most recently
+// rendered for an input line, after PromptFunc, DynamicPrompt,
+// PromptTemplate and the active context have been applied. Before Run
+// renders one it is the static Prompt. Hooks may use it, for instance, to
+// restore the prompt after changing it through [Shell.Readline].
+func (s *Shell) Prompt() string {
+	if s.shownPrompt == "" {
+		return s.cfg.Prompt
+	}
+	return s.shownPrompt
+}
+
+// prompt renders the prompt for the next input line (see buildPrompt) and
+// records it for Prompt.
+func (s *Shell) prompt() string {
+	s.shownPrompt = s.buildPrompt()
+	return s.shownPrompt
+}
+
+// buildPrompt returns the prompt for the next input line: the result of
+// PromptFunc or else DynamicPrompt when set, then UnreachablePrompt while
+// the binary cannot be run, then the expanded PromptTemplate, otherwise the
+// static Prompt, prefixed with the active context (see ContextBuiltin).
+func (s *Shell) buildPrompt() string {
+	if s.cfg.PromptFunc != nil {
+		return s.contextPrompt(s.cfg.PromptFunc(s.promptContext()))
+	}
+	if s.cfg.DynamicPrompt != nil {
+		return s.contextPrompt(s.cfg.DynamicPrompt(s.lastExitCode))
+	}
+	if s.unreachable && s.cfg.UnreachablePrompt != "" {
+		return s.contextPrompt(s.cfg.UnreachablePrompt)
+	}
+	if s.cfg.PromptTemplate != "" {
+		return s.contextPrompt(renderPromptTemplate(s.cfg.PromptTemplate, promptData{
+			binary:   binaryName(s.binary),
+			exitCode: s.lastExitCode,
+			now:      time.Now(),
+			cwd:      promptCwd(s.workingDir()),
+		}))
+	}
+	return s.contextPrompt(s.cfg.Prompt)
+}
+
+// promptContext describes the session for Config.PromptFunc.
+func (s *Shell) promptContext() PromptContext {
+	return PromptContext{
+		LastExitCode: s.lastExitCode,
+		CommandCount: s.commandCount,
+		LastDuration: s.lastDuration,
+		WorkingDir:   s.workingDir(),
+		Binary:       s.binary,
+	}
+}
+
+// workingDir returns the directory commands run in: Config.WorkingDir, or
+// the process's working directory when it is unset. It returns "" if that
+// cannot be determined.
+func (s *Shell) workingDir() string {
+	if s.cfg.WorkingDir != "" {
+		return s.cfg.WorkingDir
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
+// execute runs each command of line in order. The line is first passed
+// through Config.PreprocessLine or history expansion. Commands are separated
+// by Config.CommandSeparator; every one runs regardless of the exit codes of
+// the previous ones, and each fires its own hooks. An "exit" command leaves
+// the current context, or else stops the line and reports exit, so the
+// caller ends its input loop.
+func (s *Shell) execute(line string) (exit bool) {
+	line = s.preprocess(line)
+	for _, segment := range splitCommands(line, s.commandSeparator()) {
+		switch segment = strings.TrimSpace(segment); segment {
+		case "":
+		case "exit":
+			if !s.leaveContext() {
+				return true
+			}
+		default:
+			s.executeOne(segment)
+		}
+	}
+	return false
+}
+
+// commandSeparator returns Config.CommandSeparator, or "" when
+// DisableCommandSeparator is set.
+func (s *Shell) commandSeparator() string {
+	if s.cfg.DisableCommandSeparator {
+		return ""
+	}
+	return s.cfg.CommandSeparator
+}
+
+// executeOne expands aliases, tokenises line, runs BeforeExec, spawns the
+// binary, and runs AfterExec. A "< file" redirection is removed from the
+// arguments and the file becomes the binary's stdin. SIGINT is caught in the
+// parent while the child runs so that Ctrl-C cancels the child but does not
+// exit the shell.
+func (s *Shell) executeOne(line string) {
+	line = expandAliasLine(s.cfg.Aliases, line)
+	protected, subs := line, substitutions(nil)
+	if s.cfg.CommandSubstitution {
+		var err error
+		if protected, subs, err = protectSubstitutions(line); err != nil {
+			s.writeErr("cobra-shell: %v\n", err)
+			s.lastExitCode = 1
+			return
+		}
+	}
+	tokens, err := s.tokenize(protected)
 	if err != nil {
-		writeErr("cobra-shell: parse error: %v\n", err)
+		s.reportParseError(line, err)
 		return
 	}
 	if len(tokens) == 0 {
 		return
 	}
+	s.commandCount++
+	tokens = expandTilde(tokens)
+
+	// Built-ins are handled entirely in-process; they do not invoke the
+	// binary and do not trigger BeforeExec/AfterExec hooks. They see
+	// substitution expressions as typed and never run them.
+	if src := subs.source(tokens); s.handleEnvBuiltin(src) || s.handleUseBuiltin(src) || s.handleHelpBuiltin(src) ||
+		s.handleExplainBuiltin(line, src) || s.handleJobsBuiltin(src) || s.handleContextBuiltin(src) ||
+		s.handleCompletionSourceBuiltin(src) || s.handleVersionBuiltin(src) {
+		return
+	}
+	tokens = s.withContext(tokens)
+	line = s.withContextLine(line)
+	if notPermitted(s.stderr(), s.cfg.AllowedCommands, subs.source(tokens)) {
+		s.lastExitCode = 1
+		return
+	}
+	if !s.confirmed(line) {
+		s.lastExitCode = 1
+		return
+	}
 
-	// The env built-in is handled entirely in-process; it does not invoke the
-	// binary and does not trigger BeforeExec/AfterExec hooks.
-	if s.handleEnvBuiltin(tokens) {
+	if args, ok := s.isBackground(tokens); ok {
+		if hasPipe(args) {
+			s.writeErr("cobra-shell: background pipelines are not supported\n")
+			s.lastExitCode = 1
+			return
+		}
+		s.startBackground(args, subs)
 		return
 	}
 
 	if hasPipe(tokens) {
-		s.executePipeline(line, tokens)
+		s.executePipeline(line, tokens, subs)
 		return
 	}
 
-	if s.cfg.Hooks.BeforeExec != nil {
-		if err := s.cfg.Hooks.BeforeExec(tokens); err != nil {
-			writeErr("%v\n", err)
+	// "< file" feeds the file to the binary's stdin.
+	tokens, inputPath, err := splitInputRedirect(tokens)
+	if err != nil {
+		s.writeErr("cobra-shell: %v\n", err)
+		s.lastExitCode = 1
+		return
+	}
+	inputPath = subs.source([]string{inputPath})[0]
+	var input *os.File
+	if inputPath != "" {
+		if input, err = s.openInput(inputPath); err != nil {
+			s.writeErr("cobra-shell: %v\n", err)
+			s.lastExitCode = 1
 			return
 		}
+		defer func() { _ = input.Close() }()
 	}
+	s.run(tokens, subs, input, true)
+}
 
-	exitCode, err := spawnCommand(s.binary, tokens, s.buildEnv())
+// run runs BeforeExec, expands the substitutions in tokens, spawns the
+// binary with them, and runs AfterExec. input, when non-nil, becomes the
+// binary's stdin. When the binary reports that it does not know the command
+// and retry is set, Hooks.OnCommandNotFound may supply corrected tokens,
+// which are run in turn without another retry.
+func (s *Shell) run(tokens []string, subs substitutions, input *os.File, retry bool) {
+	if s.cfg.Hooks.BeforeExec != nil {
+		if err := s.cfg.Hooks.BeforeExec(subs.source(tokens)); err != nil {
+			reportHookError(s.stderr(), err)
+			return
+		}
+	}
+	tokens, err := s.expandSubstitutions(subs, tokens)
 	if err != nil {
-		writeErr("cobra-shell: %v\n", err)
+		s.writeErr("cobra-shell: %v\n", err)
+		s.lastExitCode = 1
+		return
 	}
-	s.lastExitCode = exitCode
 
-	if s.cfg.EnvBuiltin != "" && isRootHelp(tokens) {
-		fmt.Printf("\nShell built-ins:\n  %-12s %s\n", s.cfg.EnvBuiltin,
-			"Manage session-scoped environment variables")
+	start := time.Now()
+	taps, stderr := s.outputTaps()
+	spawn := func() (exitStatus, error) {
+		if input != nil {
+			return s.spawnWithInput(tokens, input, taps)
+		}
+		return spawnCommand(s.binary, tokens, s.cfg.WorkingDir, s.buildEnv(), taps)
+	}
+	status, err := spawn()
+	if binaryGone(err) {
+		if old := s.binary; s.reresolveBinary() {
+			s.writeErr("cobra-shell: binary no longer available at %s; now using %s\n", old, s.binary)
+			status, err = spawn()
+		}
 	}
+	switch {
+	case binaryGone(err):
+		s.writeErr("cobra-shell: binary no longer available at %s; it may have been updated or removed\n", s.binary)
+	case err != nil:
+		s.writeErr("cobra-shell: %v\n", err)
+	}
+	s.unreachable = isSpawnFailure(err)
+	s.lastExitCode = status.code
+	s.printErrorHints(status.code, stderr.String())
 
-	if s.cfg.Hooks.AfterExec != nil {
-		s.cfg.Hooks.AfterExec(tokens, exitCode)
+	if isRootHelp(tokens) {
+		s.printBuiltinsHelp()
 	}
+
+	s.afterExec(tokens, status, time.Since(start), false)
+
+	if retry && s.commandNotFound(status.code, stderr.String()) {
+		corrected, ok := s.cfg.Hooks.OnCommandNotFound(tokens)
+		if !ok || len(corrected) == 0 || notPermitted(s.stderr(), s.cfg.AllowedCommands, corrected) {
+			return
+		}
+		if input != nil {
+			if _, err := input.Seek(0, io.SeekStart); err != nil {
+				s.writeErr("cobra-shell: %v\n", err)
+				return
+			}
+		}
+		s.run(corrected, nil, input, false)
+	}
+}
+
+// tokenize splits line into arguments with Config.Tokenizer, or with POSIX
+// shell quoting when none is set.
+func (s *Shell) tokenize(line string) ([]string, error) {
+	if s.cfg.Tokenizer != nil {
+		return s.cfg.Tokenizer(line)
+	}
+	return shlex.Split(line)
+}
+
+// reportParseError prints the error tokenize returned for line. When the
+// default tokenizer failed on an unclosed quote, the line is echoed with a
+// caret under the opening quote instead of shlex's terse message.
+func (s *Shell) reportParseError(line string, err error) {
+	col := -1
+	if s.cfg.Tokenizer == nil {
+		col = unterminatedQuote(line)
+	}
+	if col < 0 {
+		s.writeErr("cobra-shell: parse error: %v\n", err)
+		return
+	}
+	quote := []rune(line)[col]
+	s.writeErr("cobra-shell: parse error: unterminated %c quote\n  %s\n  %s^\n",
+		quote, line, strings.Repeat(" ", col))
+}
+
+// unterminatedQuote returns the column, in runes, of the quote that opens
+// an unterminated quoted string in line, or -1 if every quote is closed.
+// It follows the POSIX rules shlex applies: a backslash escapes the next
+// character outside single quotes, single quotes are literal inside double
+// quotes and vice versa, and a '#' starting a word begins a comment.
+func unterminatedQuote(line string) int {
+	var quote rune
+	open := -1
+	escaped := false
+	wordStart := true
+	for i, r := range []rune(line) {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			}
+		case r == '\\':
+			escaped = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote, open = r, i
+		case r == '#' && wordStart:
+			return -1
+		}
+		wordStart = quote == 0 && !escaped && unicode.IsSpace(r)
+	}
+	if quote == 0 {
+		return -1
+	}
+	return open
 }
 
 // hasPipe reports whether any token is a standalone "|".
@@ -209,37 +756,43 @@ func leftOfFirstPipe(tokens []string) []string {
 	return tokens
 }
 
-// executePipeline handles lines containing "|" by delegating to sh -c.
-// The raw user line is passed verbatim; the binary path is single-quoted
-// and prepended (s.binary is an absolute path and cannot contain a single-quote).
-// BeforeExec and AfterExec receive only the left-side (cobra) tokens.
-func (s *Shell) executePipeline(line string, tokens []string) {
+// executePipeline handles lines containing "|" by delegating to the platform
+// shell (sh -c, or cmd.exe on Windows). The binary and the tokens left of the
+// first pipe are quoted, so the shell cannot expand them (cmd.exe still
+// expands %VAR%; see cmdQuote); the raw line after the first pipe is passed
+// verbatim (see pipelineScript).
+// BeforeExec and AfterExec receive only the left-side (cobra) tokens, whose
+// substitutions are expanded once BeforeExec has passed.
+func (s *Shell) executePipeline(line string, tokens []string, subs substitutions) {
 	leftTokens := leftOfFirstPipe(tokens)
 
 	if s.cfg.Hooks.BeforeExec != nil {
-		if err := s.cfg.Hooks.BeforeExec(leftTokens); err != nil {
-			writeErr("%v\n", err)
+		if err := s.cfg.Hooks.BeforeExec(subs.source(leftTokens)); err != nil {
+			reportHookError(s.stderr(), err)
 			return
 		}
 	}
+	leftTokens, err := s.expandSubstitutions(subs, leftTokens)
+	if err != nil {
+		s.writeErr("cobra-shell: %v\n", err)
+		s.lastExitCode = 1
+		return
+	}
 
-	// Single-quote the binary path so sh treats it as a literal.
-	// s.binary is always an absolute path produced by filepath.Abs or
-	// exec.LookPath, which never yields a path containing a single-quote.
-	script := "'" + s.binary + "' " + line
-
-	cmd := exec.Command("sh", "-c", script)
+	cmd := newShellCommand(pipelineScript(runtime.GOOS, s.binary, leftTokens, afterNthPipe(line, 1)))
+	cmd.Dir = s.cfg.WorkingDir
 	cmd.Env = s.buildEnv()
 
-	exitCode, err := runPlain(cmd)
+	start := time.Now()
+	taps, stderr := s.outputTaps()
+	status, err := runPlain(cmd, taps)
 	if err != nil {
-		writeErr("cobra-shell: %v\n", err)
+		s.writeErr("cobra-shell: %v\n", err)
 	}
-	s.lastExitCode = exitCode
+	s.lastExitCode = status.code
+	s.printErrorHints(status.code, stderr.String())
 
-	if s.cfg.Hooks.AfterExec != nil {
-		s.cfg.Hooks.AfterExec(leftTokens, exitCode)
-	}
+	s.afterExec(leftTokens, status, time.Since(start), true)
 }
 
 // resolveBinary resolves path to an absolute path. Bare names (no path
@@ -255,6 +808,44 @@ func resolveBinary(path string) (string, error) {
 	return exec.LookPath(path)
 }
 
+// binaryGone reports whether err, from starting the binary, means that the
+// file at the resolved path no longer exists or can no longer be executed,
+// as when the binary is upgraded or removed during a session.
+func binaryGone(err error) bool {
+	return isSpawnFailure(err) && (errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission))
+}
+
+// reresolveBinary looks the binary up again on PATH when it was given as a
+// bare name, and switches to it if it is now found somewhere else. It
+// reports whether the binary changed; explicit paths are never re-resolved.
+func (s *Shell) reresolveBinary() bool {
+	if s.binaryArg == "" || strings.ContainsRune(s.binaryArg, filepath.Separator) {
+		return false
+	}
+	binary, err := resolveBinary(s.binaryArg)
+	if err != nil || binary == s.binary {
+		return false
+	}
+	s.switchBinary(binary)
+	return true
+}
+
+// validateWorkingDir reports an error if dir is set but is not an existing
+// directory.
+func validateWorkingDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("cobra-shell: working directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cobra-shell: working directory %q is not a directory", dir)
+	}
+	return nil
+}
+
 // defaultHistoryFilePath returns ~/.{basename}_history for the given resolved
 // binary path. Errors from os.UserHomeDir are silently ignored; readline
 // handles an empty HistoryFile gracefully (no persistence).
@@ -263,7 +854,38 @@ func defaultHistoryFilePath(binary string) string {
 	if err != nil {
 		return ""
 	}
+	return filepath.Join(home, "."+binaryName(binary)+"_history")
+}
+
+// binaryName returns the base name of binary with any extension stripped,
+// e.g. "/usr/local/bin/kubectl" → "kubectl".
+func binaryName(binary string) string {
 	base := filepath.Base(binary)
-	base = strings.TrimSuffix(base, filepath.Ext(base))
-	return filepath.Join(home, "."+base+"_history")
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// afterExec records elapsed for PromptContext and runs the AfterExec,
+// AfterExecDetailed and AfterExecResult hooks for a command that ran for
+// elapsed and ended with status. piped reports whether it ran as the left
+// side of a pipeline.
+func (s *Shell) afterExec(args []string, status exitStatus, elapsed time.Duration, piped bool) {
+	s.lastDuration = elapsed
+	if s.cfg.Hooks.AfterExec != nil {
+		s.cfg.Hooks.AfterExec(args, status.code)
+	}
+	result := ExecResult{
+		Args:     args,
+		ExitCode: status.code,
+		Signal:   status.signal,
+		Duration: elapsed,
+		Number:   s.commandCount,
+		UsedPTY:  status.pty,
+		Piped:    piped,
+	}
+	if s.cfg.Hooks.AfterExecDetailed != nil {
+		s.cfg.Hooks.AfterExecDetailed(args, result)
+	}
+	if s.cfg.Hooks.AfterExecResult != nil {
+		s.cfg.Hooks.AfterExecResult(result)
+	}
 }
@@ -0,0 +1,441 @@
+package cobrashell
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+func TestReadline_NilBeforeRun(t *testing.T) {
+	s := New(Config{BinaryPath: "/usr/bin/true"})
+	if s.Readline() != nil {
+		t.Error("Readline() before Run should be nil")
+	}
+}
+
+func TestReadline_AvailableInOnStart(t *testing.T) {
+	s := New(Config{
+		BinaryPath:  "/usr/bin/true",
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+	})
+	var inHook bool
+	s.cfg.Hooks.OnStart = func(sh *Shell) { inHook = sh.Readline() != nil }
+
+	if err := s.runInteractive(io.NopCloser(strings.NewReader("exit\n"))); err != nil {
+		t.Fatalf("runInteractive: %v", err)
+	}
+	if !inHook {
+		t.Error("Readline() inside OnStart should be non-nil")
+	}
+	if s.Readline() != nil {
+		t.Error("Readline() after Run returns should be nil")
+	}
+}
+
+func TestRun_WarmupOnStart(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	script, log := writeLoggingBinary(t, testBinary)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	_ = w.Close() // empty input: Run returns at once in pipe mode
+	origStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+
+	s := New(Config{BinaryPath: script, WarmupOnStart: true})
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for countInvocations(t, log) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("warmup completion was not invoked after Run began")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b, _ := os.ReadFile(log)
+	if got := strings.TrimSpace(string(b)); got != "__completeNoDesc" {
+		t.Errorf("warmup invoked the binary with %q, want __completeNoDesc", got)
+	}
+}
+
+func TestRun_NoWarmupByDefault(t *testing.T) {
+	script, log := writeLoggingBinary(t, "")
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	_ = w.Close()
+	origStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+
+	if err := New(Config{BinaryPath: script}).Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := countInvocations(t, log); n != 0 {
+		t.Errorf("binary invoked %d times without WarmupOnStart, want 0", n)
+	}
+}
+
+func TestRunInteractive_ConfigureReadline(t *testing.T) {
+	s := New(Config{
+		BinaryPath:  "/usr/bin/true",
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+	})
+	var got *readline.Instance
+	var beforeStart bool
+	s.cfg.ConfigureReadline = func(rl *readline.Instance) { got = rl }
+	s.cfg.Hooks.OnStart = func(*Shell) { beforeStart = got != nil }
+
+	if err := s.runInteractive(io.NopCloser(strings.NewReader("exit\n"))); err != nil {
+		t.Fatalf("runInteractive: %v", err)
+	}
+	if got == nil {
+		t.Fatal("ConfigureReadline was not called with a readline instance")
+	}
+	if !beforeStart {
+		t.Error("ConfigureReadline should run before OnStart")
+	}
+}
+
+func TestPrompt_UnreachableAfterSpawnFailure(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Prompt = "> "
+	sh.cfg.UnreachablePrompt = "(offline) > "
+	sh.binary = filepath.Join(t.TempDir(), "missing")
+
+	captureStderr(t, func() { sh.executeOne("greet") })
+	if got := sh.prompt(); got != "(offline) > " {
+		t.Errorf("prompt after spawn failure = %q, want %q", got, "(offline) > ")
+	}
+
+	sh.binary = testBinary
+	discardStdout(t, func() { sh.executeOne("greet") })
+	if got := sh.prompt(); got != "> " {
+		t.Errorf("prompt after successful run = %q, want %q", got, "> ")
+	}
+
+	sh.binary = filepath.Join(t.TempDir(), "missing")
+	c := &completer{shell: sh}
+	c.tryComplete(nil, "gr")
+	if got := sh.prompt(); got != "(offline) > " {
+		t.Errorf("prompt after failed completion = %q, want %q", got, "(offline) > ")
+	}
+}
+
+func TestPrompt_NonZeroExitIsNotUnreachable(t *testing.T) {
+	sh := &Shell{
+		cfg:        Config{Prompt: "> ", UnreachablePrompt: "(offline) > "},
+		binary:     "/usr/bin/false",
+		sessionEnv: make(map[string]string),
+	}
+	sh.executeOne("anything")
+	if got := sh.prompt(); got != "> " {
+		t.Errorf("prompt after non-zero exit = %q, want %q", got, "> ")
+	}
+}
+
+func TestNew_WorkingDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	wd := filepath.Join(dir, "project")
+	if err := os.Mkdir(wd, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "pwdbin")
+	log := filepath.Join(dir, "pwd.log")
+	body := "#!/bin/sh\npwd >> '" + log + "'\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(Config{BinaryPath: script, WorkingDir: wd})
+	if s.initErr != nil {
+		t.Fatalf("New: %v", s.initErr)
+	}
+	s.executeOne("run")
+	discardStdout(t, func() { s.executeOne("run | cat") })
+
+	got, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := filepath.EvalSymlinks(wd)
+	for _, line := range strings.Split(strings.TrimSpace(string(got)), "\n") {
+		if resolved, _ := filepath.EvalSymlinks(line); resolved != want {
+			t.Errorf("child ran in %q, want %q", line, wd)
+		}
+	}
+	if n := strings.Count(string(got), "\n"); n != 2 {
+		t.Errorf("binary ran %d times, want 2", n)
+	}
+}
+
+func TestNew_InvalidWorkingDir(t *testing.T) {
+	s := New(Config{BinaryPath: "/usr/bin/true", WorkingDir: filepath.Join(t.TempDir(), "missing")})
+	if err := s.Run(); err == nil || !strings.Contains(err.Error(), "working directory") {
+		t.Errorf("Run() = %v, want a working directory error", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s = New(Config{BinaryPath: "/usr/bin/true", WorkingDir: file})
+	if err := s.Run(); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("Run() = %v, want a not-a-directory error", err)
+	}
+}
+
+// splitCommas is a Tokenizer that splits on commas, so spaces are part of an
+// argument.
+func splitCommas(line string) ([]string, error) {
+	return strings.Split(line, ","), nil
+}
+
+func TestTokenizer_Execute(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Tokenizer = splitCommas
+	var got []string
+	sh.cfg.Hooks.BeforeExec = func(tokens []string) error { got = tokens; return nil }
+
+	out := captureStdout(t, func() { sh.executeOne("greet,--name,Ann Lee") })
+	if !strings.Contains(out, "Hello, Ann Lee!") {
+		t.Errorf("output = %q, want the greeting for Ann Lee", out)
+	}
+	if len(got) != 3 || got[2] != "Ann Lee" {
+		t.Errorf("BeforeExec tokens = %q, want [greet --name Ann Lee]", got)
+	}
+}
+
+func TestTokenizer_Completion(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Tokenizer = splitCommas
+	c := &completer{shell: sh}
+
+	line := []rune("greet,--namespace,kube")
+	got, length := c.Do(line, len(line))
+	if length != len("kube") || len(got) != 1 || string(got[0]) != "-system/" {
+		t.Errorf("Do(%q) = %q, %d; want [-system/], %d", string(line), got, length, len("kube"))
+	}
+}
+
+func TestTokenizer_CompletionAlias(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.Tokenizer = splitCommas
+	sh.cfg.Aliases = map[string]string{"gn": "greet,--namespace"}
+	c := &completer{shell: sh}
+
+	line := []rune("gn,kube")
+	got, length := c.Do(line, len(line))
+	if length != len("kube") || len(got) != 1 || string(got[0]) != "-system/" {
+		t.Errorf("Do(%q) = %q, %d; want [-system/], %d", string(line), got, length, len("kube"))
+	}
+}
+
+func TestUnterminatedQuote(t *testing.T) {
+	cases := []struct {
+		line string
+		want int
+	}{
+		{`echo "oops`, 5},
+		{`echo 'a'b"c`, 9},
+		{`echo "it's"`, -1},
+		{`echo 'say "hi'`, -1},
+		{`echo a\"b`, -1},
+		{`echo "a\"b`, 5},
+		{`echo # it's a comment`, -1},
+		{`echo a#'b`, 7},
+		{`héllo "x`, 6},
+	}
+	for _, tc := range cases {
+		if got := unterminatedQuote(tc.line); got != tc.want {
+			t.Errorf("unterminatedQuote(%q) = %d, want %d", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestExecuteOne_ParseErrorCaret(t *testing.T) {
+	sh := newIntegrationShell()
+	out := captureStderr(t, func() { sh.executeOne(`echo 'a'b"c`) })
+	want := "cobra-shell: parse error: unterminated \" quote\n  echo 'a'b\"c\n           ^\n"
+	if out != want {
+		t.Errorf("stderr = %q, want %q", out, want)
+	}
+}
+
+// copyTestBinary copies testBinary to dir/name and returns its path.
+func copyTestBinary(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(testBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, b, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecuteOne_BinaryRemoved(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	path := copyTestBinary(t, t.TempDir(), "testbin-copy")
+	s := New(Config{BinaryPath: path})
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStderr(t, func() { s.executeOne("greet") })
+	want := "cobra-shell: binary no longer available at " + s.binary + "; it may have been updated or removed\n"
+	if out != want {
+		t.Errorf("stderr = %q, want %q", out, want)
+	}
+	if !s.unreachable {
+		t.Error("unreachable = false after the binary was removed")
+	}
+}
+
+func TestExecuteOne_BinaryMovedOnPath(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("PATH lookup of the copied binary needs an .exe name on Windows")
+	}
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	t.Setenv("PATH", oldDir+string(os.PathListSeparator)+newDir)
+	oldPath := copyTestBinary(t, oldDir, "cs-moved-bin")
+	s := New(Config{BinaryPath: "cs-moved-bin"})
+	if s.binary != oldPath {
+		t.Fatalf("resolved %q, want %q", s.binary, oldPath)
+	}
+	if err := os.Remove(oldPath); err != nil {
+		t.Fatal(err)
+	}
+	newPath := copyTestBinary(t, newDir, "cs-moved-bin")
+
+	var out string
+	errOut := captureStderr(t, func() { out = captureStdout(t, func() { s.executeOne("greet") }) })
+	if !strings.Contains(out, "Hello, world!") {
+		t.Errorf("stdout = %q, want the command to run from the new location", out)
+	}
+	if !strings.Contains(errOut, "now using "+newPath) || s.binary != newPath {
+		t.Errorf("stderr = %q, binary = %q; want a switch to %q", errOut, s.binary, newPath)
+	}
+}
+
+func TestRun_LastExitCode(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	for _, tc := range []struct {
+		script string
+		want   int
+	}{
+		{"fail\ngreet\n", 0},
+		{"greet\nfail\n", 1},
+	} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("os.Pipe: %v", err)
+		}
+		_, _ = w.WriteString(tc.script)
+		_ = w.Close()
+		origStdin := os.Stdin
+		os.Stdin = r
+
+		s := New(Config{BinaryPath: testBinary})
+		if s.LastExitCode() != 0 {
+			t.Errorf("LastExitCode() before Run = %d, want 0", s.LastExitCode())
+		}
+		captureStderr(t, func() {
+			discardStdout(t, func() {
+				if err := s.Run(); err != nil {
+					t.Errorf("Run: %v", err)
+				}
+			})
+		})
+		os.Stdin = origStdin
+		if got := s.LastExitCode(); got != tc.want {
+			t.Errorf("script %q: LastExitCode() = %d, want %d", tc.script, got, tc.want)
+		}
+	}
+}
+
+func TestCommandCount(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	var numbers []int
+	s := New(Config{BinaryPath: testBinary, Hooks: Hooks{
+		AfterExecResult: func(r ExecResult) { numbers = append(numbers, r.Number) },
+	}})
+	run := func(script string) {
+		t.Helper()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("os.Pipe: %v", err)
+		}
+		_, _ = w.WriteString(script)
+		_ = w.Close()
+		origStdin := os.Stdin
+		os.Stdin = r
+		defer func() { os.Stdin = origStdin }()
+		captureStderr(t, func() {
+			discardStdout(t, func() {
+				if err := s.Run(); err != nil {
+					t.Errorf("Run: %v", err)
+				}
+			})
+		})
+	}
+
+	// Blank lines and parse errors do not count; each separated command does.
+	run("greet\n\nfail ; echo a\necho 'oops\n")
+	if got := s.CommandCount(); got != 3 {
+		t.Errorf("CommandCount() = %d, want 3", got)
+	}
+	if !slices.Equal(numbers, []int{1, 2, 3}) {
+		t.Errorf("ExecResult.Number = %v, want [1 2 3]", numbers)
+	}
+
+	// A new session starts counting again.
+	numbers = nil
+	run("greet\n")
+	if got := s.CommandCount(); got != 1 {
+		t.Errorf("CommandCount() in a new session = %d, want 1", got)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package cobrashell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// newShellCommand returns a command that runs script with the POSIX shell.
+func newShellCommand(script string) *exec.Cmd {
+	return exec.Command("sh", "-c", script)
+}
+
+// detachTTY makes cmd start in a new session, without a controlling
+// terminal; see Config.IsolateCompletionTTY.
+func detachTTY(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+}
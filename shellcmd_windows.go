@@ -0,0 +1,25 @@
+//go:build windows
+
+package cobrashell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// newShellCommand returns a command that runs script with cmd.exe.
+//
+// cmd.exe does not parse its command line with the CommandLineToArgvW rules
+// that os/exec uses to quote arguments, so the command line is set verbatim.
+// "/S /C" followed by a fully quoted script makes cmd.exe strip only the
+// outermost quotes and keep any quotes inside the script intact.
+func newShellCommand(script string) *exec.Cmd {
+	cmd := exec.Command("cmd")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: `cmd /S /C "` + script + `"`,
+	}
+	return cmd
+}
+
+// detachTTY is a no-op: Windows processes have no controlling terminal.
+func detachTTY(cmd *exec.Cmd) {}
@@ -0,0 +1,62 @@
+package cobrashell
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// spinnerFrames are the glyphs of the CompletionSpinner animation, shown in
+// turn every spinnerInterval.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const spinnerInterval = 80 * time.Millisecond
+
+// spinnerFrame returns the glyph to show once the spinner has been running
+// for elapsed.
+func spinnerFrame(elapsed time.Duration) string {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return spinnerFrames[int(elapsed/spinnerInterval)%len(spinnerFrames)]
+}
+
+// startSpinner draws the spinner on w at the cursor position once delay has
+// passed, until the returned stop is called. Every frame is written between
+// cursor save and restore sequences, so the cursor stays where readline left
+// it. stop waits for the drawing goroutine to finish and reports whether a
+// frame was drawn, in which case the caller redraws the input line to erase
+// it.
+func startSpinner(w io.Writer, delay time.Duration) (stop func() bool) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	drawn := false
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		start := time.Now()
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for {
+			_, _ = io.WriteString(w, "\x1b7"+spinnerFrame(time.Since(start))+"\x1b8")
+			drawn = true
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() bool {
+		close(done)
+		wg.Wait()
+		return drawn
+	}
+}
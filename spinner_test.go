@@ -0,0 +1,45 @@
+package cobrashell
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpinnerFrame(t *testing.T) {
+	cases := []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{0, "⠋"},
+		{spinnerInterval - time.Millisecond, "⠋"},
+		{spinnerInterval, "⠙"},
+		{3 * spinnerInterval, "⠸"},
+		{time.Duration(len(spinnerFrames)) * spinnerInterval, "⠋"},
+		{-time.Second, "⠋"},
+	}
+	for _, tc := range cases {
+		if got := spinnerFrame(tc.elapsed); got != tc.want {
+			t.Errorf("spinnerFrame(%v) = %q, want %q", tc.elapsed, got, tc.want)
+		}
+	}
+}
+
+func TestStartSpinner(t *testing.T) {
+	var buf bytes.Buffer
+	stop := startSpinner(&buf, time.Hour)
+	if stop() || buf.Len() != 0 {
+		t.Errorf("spinner stopped before its delay drew %q", buf.String())
+	}
+
+	buf.Reset()
+	stop = startSpinner(&buf, 0)
+	time.Sleep(2 * spinnerInterval)
+	if !stop() {
+		t.Fatal("spinner past its delay reported nothing drawn")
+	}
+	if !strings.HasPrefix(buf.String(), "\x1b7⠋\x1b8") {
+		t.Errorf("spinner output = %q, want frames wrapped in cursor save/restore", buf.String())
+	}
+}
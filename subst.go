@@ -0,0 +1,252 @@
+package cobrashell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Placeholders stand in for substitution expressions while a line is
+// tokenised. They use private-use runes, which neither shlex nor a typical
+// custom tokenizer treats specially.
+const (
+	placeholderOpen  = "\uE000"
+	placeholderClose = "\uE001"
+)
+
+// substitution is one $(...) or `...` expression found in a line.
+type substitution struct {
+	script string // the command to run
+	source string // the expression as typed, for hooks and built-ins
+	quoted bool   // inside double quotes, so the output is not split
+}
+
+// substitutions holds the expressions protectSubstitutions took out of a
+// line, indexed by the number in each placeholder. A nil substitutions has
+// no expressions and leaves tokens unchanged.
+type substitutions []substitution
+
+// protectSubstitutions replaces each $(...) and `...` expression in line
+// with a placeholder, so that the line can be tokenised, checked and shown
+// to hooks before any expression runs. Expressions inside single quotes or
+// escaped with a backslash are left alone.
+func protectSubstitutions(line string) (string, substitutions, error) {
+	if !strings.Contains(line, "$(") && !strings.Contains(line, "`") {
+		return line, nil, nil
+	}
+
+	var b strings.Builder
+	var subs substitutions
+	add := func(script, source string, quoted bool) {
+		b.WriteString(placeholderOpen + strconv.Itoa(len(subs)) + placeholderClose)
+		subs = append(subs, substitution{script: script, source: source, quoted: quoted})
+	}
+	inSingle, inDouble := false, false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '\\' && !inSingle && i+1 < len(line):
+			b.WriteByte(ch)
+			b.WriteByte(line[i+1])
+			i++
+			continue
+		case ch == '\'' && !inDouble:
+			inSingle = !inSingle
+		case ch == '"' && !inSingle:
+			inDouble = !inDouble
+		case !inSingle && ch == '$' && i+1 < len(line) && line[i+1] == '(':
+			end, err := matchParen(line, i+1)
+			if err != nil {
+				return "", nil, err
+			}
+			add(line[i+2:end], line[i:end+1], inDouble)
+			i = end
+			continue
+		case !inSingle && ch == '`':
+			end := strings.IndexByte(line[i+1:], '`')
+			if end < 0 {
+				return "", nil, errors.New("unterminated ` in command substitution")
+			}
+			end += i + 1
+			add(line[i+1:end], line[i:end+1], inDouble)
+			i = end
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String(), subs, nil
+}
+
+// source returns tokens with each placeholder replaced by the expression
+// as typed.
+func (subs substitutions) source(tokens []string) []string {
+	if len(subs) == 0 {
+		return tokens
+	}
+	out := make([]string, len(tokens))
+	for i, tok := range tokens {
+		var b strings.Builder
+		for _, p := range splitPlaceholders(tok) {
+			if p.index < 0 {
+				b.WriteString(p.text)
+			} else {
+				b.WriteString(subs[p.index].source)
+			}
+		}
+		out[i] = b.String()
+	}
+	return out
+}
+
+// expandSubstitutions runs each expression in subs and replaces its
+// placeholder in tokens with the trimmed output, as literal text: quotes,
+// backslashes and characters such as "#", ";" and "|" in the output have no
+// special meaning. Output of an expression outside double quotes is split
+// on whitespace into separate arguments, and a token that consists only of
+// such expressions and expands to nothing is dropped, as in a POSIX shell.
+//
+// A substitution command that fails (non-zero exit or cannot start) aborts
+// the whole command with an error naming the expression; its stderr is
+// passed through to the user.
+func (s *Shell) expandSubstitutions(subs substitutions, tokens []string) ([]string, error) {
+	if len(subs) == 0 {
+		return tokens, nil
+	}
+	var out []string
+	for _, tok := range tokens {
+		parts := splitPlaceholders(tok)
+		if len(parts) == 1 && parts[0].index < 0 {
+			out = append(out, tok)
+			continue
+		}
+		var cur strings.Builder
+		keep := false
+		for _, p := range parts {
+			if p.index < 0 {
+				cur.WriteString(p.text)
+				keep = keep || p.text != ""
+				continue
+			}
+			sub := subs[p.index]
+			text, err := s.runSubstitution(sub.script)
+			if err != nil {
+				return nil, err
+			}
+			if sub.quoted {
+				cur.WriteString(text)
+				keep = true
+				continue
+			}
+			for j, field := range strings.Fields(text) {
+				if j > 0 {
+					out = append(out, cur.String())
+					cur.Reset()
+				}
+				cur.WriteString(field)
+				keep = true
+			}
+		}
+		if keep {
+			out = append(out, cur.String())
+		}
+	}
+	return out, nil
+}
+
+// placeholderPart is a piece of a token: literal text, or the placeholder
+// for the expression at index.
+type placeholderPart struct {
+	text  string
+	index int // -1 for literal text
+}
+
+// splitPlaceholders splits tok into literal text and placeholders.
+func splitPlaceholders(tok string) []placeholderPart {
+	var parts []placeholderPart
+	for {
+		start := strings.Index(tok, placeholderOpen)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(tok[start:], placeholderClose)
+		if end < 0 {
+			break
+		}
+		end += start
+		index, err := strconv.Atoi(tok[start+len(placeholderOpen) : end])
+		if err != nil {
+			break
+		}
+		if start > 0 {
+			parts = append(parts, placeholderPart{text: tok[:start], index: -1})
+		}
+		parts = append(parts, placeholderPart{index: index})
+		tok = tok[end+len(placeholderClose):]
+	}
+	if tok != "" || len(parts) == 0 {
+		parts = append(parts, placeholderPart{text: tok, index: -1})
+	}
+	return parts
+}
+
+// substitutionEnd returns the index of the byte closing the $(...) or
+// `...` expression that starts at line[i]. ok is false when no expression
+// starts there or it is unterminated. splitCommands and afterNthPipe use it
+// so that a ";" or "|" inside an expression does not split the line.
+func substitutionEnd(line string, i int) (end int, ok bool) {
+	switch {
+	case line[i] == '$' && i+1 < len(line) && line[i+1] == '(':
+		end, err := matchParen(line, i+1)
+		return end, err == nil
+	case line[i] == '`':
+		end := strings.IndexByte(line[i+1:], '`')
+		return end + i + 1, end >= 0
+	}
+	return 0, false
+}
+
+// matchParen returns the index of the ")" closing the "(" at open, skipping
+// nested parentheses and quoted text.
+func matchParen(line string, open int) (int, error) {
+	depth := 0
+	var quote byte
+	for i := open; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '\\':
+			i++
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.New("unterminated $( in command substitution")
+}
+
+// runSubstitution runs script with the platform shell, the session
+// environment and Config.WorkingDir, and returns its stdout with
+// surrounding whitespace removed.
+func (s *Shell) runSubstitution(script string) (string, error) {
+	cmd := newShellCommand(script)
+	cmd.Dir = s.cfg.WorkingDir
+	cmd.Env = s.buildEnv()
+	cmd.Stderr = s.stderr()
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("command substitution %q: %w", script, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
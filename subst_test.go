@@ -0,0 +1,210 @@
+package cobrashell
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/shlex"
+)
+
+// substitute protects, tokenises and expands line as executeOne does.
+func substitute(s *Shell, line string) ([]string, error) {
+	protected, subs, err := protectSubstitutions(line)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := shlex.Split(protected)
+	if err != nil {
+		return nil, err
+	}
+	return s.expandSubstitutions(subs, tokens)
+}
+
+func TestExpandSubstitutions(t *testing.T) {
+	s := &Shell{sessionEnv: map[string]string{"WHO": "session"}}
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"greet --name $(echo world)", []string{"greet", "--name", "world"}},
+		{"greet --name `echo world`", []string{"greet", "--name", "world"}},
+		{"greet --name $(echo $WHO)", []string{"greet", "--name", "session"}},
+		{`greet --name "$(echo a b)"`, []string{"greet", "--name", "a b"}},
+		{"greet --name $(echo a b)", []string{"greet", "--name", "a", "b"}},
+		{"greet --name=$(echo a b)!", []string{"greet", "--name=a", "b!"}},
+		{"greet --name '$(echo world)'", []string{"greet", "--name", "$(echo world)"}},
+		{`greet --name \$(echo world)`, []string{"greet", "--name", "$(echo", "world)"}},
+		{"echo $(echo $(echo nested))", []string{"echo", "nested"}},
+		{`echo "$(echo "it's # a ; b | c \\")"`, []string{"echo", `it's # a ; b | c \`}},
+		{`echo $(echo "'a b" '"c')`, []string{"echo", "'a", "b", `"c`}},
+		{"greet $(true)", []string{"greet"}},
+		{"greet", []string{"greet"}},
+	}
+	for _, tt := range tests {
+		got, err := substitute(s, tt.line)
+		if err != nil {
+			t.Errorf("substitute(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("substitute(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestExpandSubstitutions_Errors(t *testing.T) {
+	s := &Shell{}
+	for _, line := range []string{"greet $(exit 3)", "greet $(echo x", "greet `echo x"} {
+		if _, err := substitute(s, line); err == nil {
+			t.Errorf("substitute(%q) returned nil error", line)
+		}
+	}
+}
+
+func TestSubstitutions_Source(t *testing.T) {
+	protected, subs, err := protectSubstitutions(`greet --name="$(echo a)" ` + "`date`")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := shlex.Split(protected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"greet", "--name=$(echo a)", "`date`"}
+	if got := subs.source(tokens); !reflect.DeepEqual(got, want) {
+		t.Errorf("source = %q, want %q", got, want)
+	}
+}
+
+func TestIntegration_Execute_CommandSubstitution(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CommandSubstitution = true
+	out := captureStdout(t, func() { sh.execute("greet --name $(echo world)") })
+	if out != "Hello, world!\n" {
+		t.Errorf("output = %q, want %q", out, "Hello, world!\n")
+	}
+
+	var stderr string
+	out = captureStdout(t, func() {
+		stderr = captureStderr(t, func() { sh.execute("greet --name $(exit 1)") })
+	})
+	if out != "" {
+		t.Errorf("binary ran although the substitution failed; output = %q", out)
+	}
+	if !strings.Contains(stderr, "command substitution") {
+		t.Errorf("stderr = %q, want a command substitution error", stderr)
+	}
+}
+
+func TestIntegration_Execute_CommandSubstitutionLiteralOutput(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CommandSubstitution = true
+	out := captureStdout(t, func() { sh.execute(`echo $(echo "it's" '#x' '\' '|')`) })
+	if want := "it's\n#x\n\\\n|\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+// Separators and pipes inside an expression belong to it, not to the line.
+func TestIntegration_Execute_CommandSubstitutionSeparatorAndPipe(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	tests := []struct{ line, want string }{
+		{"echo $(echo a ; echo b)", "a\nb\n"},
+		{"echo $(echo xy | tr a-z A-Z) | cat", "XY\n"},
+	}
+	for _, tt := range tests {
+		sh := newIntegrationShell()
+		sh.cfg.CommandSeparator = ";"
+		sh.cfg.CommandSubstitution = true
+		var stderr string
+		out := captureStdout(t, func() { stderr = captureStderr(t, func() { sh.execute(tt.line) }) })
+		if out != tt.want || stderr != "" {
+			t.Errorf("%q: output = %q, stderr = %q; want %q and no errors", tt.line, out, stderr, tt.want)
+		}
+	}
+}
+
+func TestIntegration_Execute_CommandSubstitutionWorkingDir(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.CommandSubstitution = true
+	sh.cfg.WorkingDir = t.TempDir()
+	discardStdout(t, func() { sh.execute("greet --name $(touch made)") })
+	if _, err := os.Stat(filepath.Join(sh.cfg.WorkingDir, "made")); err != nil {
+		t.Errorf("substitution did not run in WorkingDir: %v", err)
+	}
+}
+
+// Substitutions run only once a command has passed the allow-list,
+// confirmation and BeforeExec, and never for explain.
+func TestIntegration_Execute_CommandSubstitutionAfterChecks(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "marker")
+	touch := " $(touch " + marker + ")"
+
+	tests := []struct {
+		name  string
+		setup func(*Shell)
+		line  string
+	}{
+		{"not permitted", func(s *Shell) { s.cfg.AllowedCommands = []string{"echo"} }, "greet" + touch},
+		{"BeforeExec", func(s *Shell) {
+			s.cfg.Hooks.BeforeExec = func(tokens []string) error {
+				if tokens[len(tokens)-1] != strings.TrimSpace(touch) {
+					t.Errorf("BeforeExec tokens = %q, want the expression as typed", tokens)
+				}
+				return errors.New("blocked")
+			}
+		}, "greet" + touch},
+		{"background BeforeExec", func(s *Shell) {
+			s.cfg.Hooks.BeforeExec = func([]string) error { return errors.New("blocked") }
+		}, "greet" + touch + " &"},
+		{"pipeline BeforeExec", func(s *Shell) {
+			s.cfg.Hooks.BeforeExec = func([]string) error { return errors.New("blocked") }
+		}, "greet" + touch + " | cat"},
+		{"confirmation", func(s *Shell) {
+			s.confirmPatterns = []*regexp.Regexp{regexp.MustCompile(`^greet`)}
+		}, "greet" + touch},
+		{"explain", func(s *Shell) { s.cfg.ExplainBuiltin = true }, "explain greet" + touch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := newIntegrationShell()
+			sh.cfg.CommandSubstitution = true
+			tt.setup(sh)
+			discardStdout(t, func() { captureStderr(t, func() { sh.execute(tt.line) }) })
+			if _, err := os.Stat(marker); err == nil {
+				t.Errorf("%q ran its substitution", tt.line)
+				_ = os.Remove(marker)
+			}
+		})
+	}
+}
+
+func TestIntegration_Execute_CommandSubstitutionOff(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	out := captureStdout(t, func() { newIntegrationShell().execute("echo $(whoami)") })
+	if out != "$(whoami)\n" {
+		t.Errorf("output = %q, want the literal expression", out)
+	}
+}
@@ -1,19 +1,47 @@
 // testbin is a minimal Cobra binary used by cobra-shell integration tests.
 // It exposes known commands and completions so tests can make deterministic
 // assertions about __completeNoDesc output and execution behaviour.
+//
+// Behaviour can be altered through environment variables so that tests can
+// simulate non-standard binaries without a separate executable:
+//
+//	TESTBIN_COMPLETE_STDERR=1  write all command output (including
+//	                           __completeNoDesc results) to stderr
+//	TESTBIN_SLEEP=<duration>   sleep before doing anything, to simulate a
+//	                           slow binary
+//	TESTBIN_FAIL_ONCE=<file>   exit 1 without output when <file> does not
+//	                           exist, creating it, so that the next run
+//	                           succeeds: a transient failure
+//	TESTBIN_REQUIRE_TTY=1      discard all command output (including
+//	                           completions) unless stdout is a terminal
 package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func main() {
+	if d, err := time.ParseDuration(os.Getenv("TESTBIN_SLEEP")); err == nil {
+		time.Sleep(d)
+	}
+	if marker := os.Getenv("TESTBIN_FAIL_ONCE"); marker != "" {
+		if _, err := os.Stat(marker); err != nil {
+			_ = os.WriteFile(marker, nil, 0o644)
+			os.Exit(1)
+		}
+	}
+
 	root := &cobra.Command{
-		Use:   "testbin",
-		Short: "cobra-shell integration test binary",
+		Use:     "testbin",
+		Short:   "cobra-shell integration test binary",
+		Version: "1.2.3",
 	}
 
 	var name string
@@ -26,6 +54,20 @@ func main() {
 		},
 	}
 	greet.Flags().StringVar(&name, "name", "world", "Name to greet")
+	greet.Flags().String("namespace", "", "Namespace (completions end in \"/\")")
+	_ = greet.RegisterFlagCompletionFunc("namespace", func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var out []string
+		for _, ns := range []string{"default/", "kube-system/"} {
+			if strings.HasPrefix(ns, toComplete) {
+				out = append(out, ns)
+			}
+		}
+		return out, cobra.ShellCompDirectiveNoFileComp
+	})
+	greet.Flags().String("config", "", "Config file (completes local files)")
+	_ = greet.RegisterFlagCompletionFunc("config", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveDefault
+	})
 	root.AddCommand(greet)
 
 	root.AddCommand(&cobra.Command{
@@ -46,12 +88,52 @@ func main() {
 		},
 	})
 
+	root.AddCommand(&cobra.Command{
+		Use:   "cat",
+		Short: "Copy stdin to stdout",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := io.Copy(os.Stdout, os.Stdin)
+			return err
+		},
+	})
+
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "Manage the server",
+	}
+	serve.AddCommand(
+		&cobra.Command{Use: "start", Short: "Start the server", Run: func(*cobra.Command, []string) {}},
+		&cobra.Command{Use: "stop", Short: "Stop the server", Run: func(*cobra.Command, []string) {}},
+	)
+	root.AddCommand(serve)
+
+	// env shares its name with the shell's usual env built-in, so tests can
+	// check that the built-in shadows it.
+	env := &cobra.Command{
+		Use:   "env",
+		Short: "Manage the environment (clashes with the env built-in)",
+	}
+	env.AddCommand(
+		&cobra.Command{Use: "show", Short: "Show the environment", Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("testbin env show")
+		}},
+		&cobra.Command{Use: "reset", Short: "Reset the environment", Run: func(*cobra.Command, []string) {}},
+	)
+	root.AddCommand(env)
+
 	root.AddCommand(&cobra.Command{
 		Use:    "hidden",
 		Short:  "Hidden command (should not appear in completions)",
 		Hidden: true,
 	})
 
+	if os.Getenv("TESTBIN_COMPLETE_STDERR") == "1" {
+		root.SetOut(os.Stderr)
+	}
+	if os.Getenv("TESTBIN_REQUIRE_TTY") == "1" && !term.IsTerminal(int(os.Stdout.Fd())) {
+		root.SetOut(io.Discard)
+	}
+
 	if err := root.Execute(); err != nil {
 		os.Exit(1)
 	}
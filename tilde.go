@@ -0,0 +1,29 @@
+package cobrashell
+
+import (
+	"os"
+	"strings"
+)
+
+// expandTilde replaces a leading "~" in each token with the user's home
+// directory, the way a shell expands "~" and "~/path". Tokens such as "a~b"
+// or "~user" are left alone, as are all tokens when the home directory is
+// unknown.
+//
+// shlex has already removed quotes by the time this runs, so a quoted "~" is
+// expanded too; unlike POSIX shells there is no way to pass a literal
+// leading "~" other than writing "./~" or the full path.
+func expandTilde(tokens []string) []string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return tokens
+	}
+	for i, t := range tokens {
+		if t == "~" {
+			tokens[i] = home
+		} else if strings.HasPrefix(t, "~/") {
+			tokens[i] = home + t[1:]
+		}
+	}
+	return tokens
+}
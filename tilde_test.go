@@ -0,0 +1,31 @@
+package cobrashell
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandTilde(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	got := expandTilde([]string{"load", "~", "~/sub/data.json", "a~b", "~user", "--file=~/x"})
+	want := []string{"load", home, home + "/sub/data.json", "a~b", "~user", "--file=~/x"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expandTilde = %q, want %q", got, want)
+	}
+}
+
+func TestIntegration_Execute_ExpandsTilde(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	out := captureStdout(t, func() { newIntegrationShell().execute("echo ~/data.json a~b") })
+	if want := home + "/data.json\na~b\n"; out != want {
+		t.Errorf("execute output = %q, want %q", out, want)
+	}
+}
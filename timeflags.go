@@ -0,0 +1,68 @@
+package cobrashell
+
+import (
+	"strings"
+	"time"
+)
+
+// relativeTimeTemplates are the duration values offered for time flags.
+var relativeTimeTemplates = []string{"5m", "15m", "30m", "1h", "6h", "24h"}
+
+// timeTemplates returns the values offered for a time flag at now: the
+// relative durations, followed by today's and yesterday's date and the start
+// of the current hour in RFC 3339 form.
+func timeTemplates(now time.Time) []string {
+	templates := append([]string(nil), relativeTimeTemplates...)
+	return append(templates,
+		now.Format(time.DateOnly),
+		now.AddDate(0, 0, -1).Format(time.DateOnly),
+		now.Truncate(time.Hour).Format(time.RFC3339),
+	)
+}
+
+// timeFlagHints returns the time templates matching toComplete when the word
+// being completed is the value of a flag listed in Config.TimeFlagNames:
+// either the previous argument is that flag, or toComplete is "--flag=...".
+// ok is false when the word is not a time flag value, in which case normal
+// completion applies.
+func (c *completer) timeFlagHints(contextArgs []string, toComplete string) (hints []string, ok bool) {
+	names := c.shell.cfg.TimeFlagNames
+	if len(names) == 0 {
+		return nil, false
+	}
+
+	prefix, value := "", toComplete
+	switch {
+	case strings.HasPrefix(toComplete, "-") && strings.Contains(toComplete, "="):
+		flag, v, _ := strings.Cut(toComplete, "=")
+		if !isNamedFlag(names, flag) {
+			return nil, false
+		}
+		prefix, value = flag+"=", v
+	case len(contextArgs) > 0 && isNamedFlag(names, contextArgs[len(contextArgs)-1]) &&
+		!strings.HasPrefix(toComplete, "-"):
+	default:
+		return nil, false
+	}
+
+	for _, t := range timeTemplates(time.Now()) {
+		if strings.HasPrefix(t, value) {
+			hints = append(hints, prefix+t)
+		}
+	}
+	return hints, true
+}
+
+// isNamedFlag reports whether arg is a long flag ("--since") named in names.
+// Names may be given with or without leading dashes.
+func isNamedFlag(names []string, arg string) bool {
+	if !strings.HasPrefix(arg, "--") || strings.Contains(arg, "=") {
+		return false
+	}
+	for _, n := range names {
+		if strings.TrimLeft(n, "-") == arg[2:] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package cobrashell
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimeTemplates(t *testing.T) {
+	now := time.Date(2024, 3, 10, 14, 25, 0, 0, time.UTC)
+	got := timeTemplates(now)
+	for _, want := range []string{"1h", "30m", "2024-03-10", "2024-03-09", "2024-03-10T14:00:00Z"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("timeTemplates = %v, missing %q", got, want)
+		}
+	}
+}
+
+func makeTimeFlagCompleter() *completer {
+	return &completer{shell: &Shell{cfg: Config{TimeFlagNames: []string{"since", "--until"}}}}
+}
+
+func TestTimeFlagHints_AfterFlag(t *testing.T) {
+	c := makeTimeFlagCompleter()
+	got, ok := c.timeFlagHints([]string{"logs", "--since"}, "")
+	if !ok {
+		t.Fatal("timeFlagHints ok = false after --since")
+	}
+	if !slices.Contains(got, "1h") || !slices.Contains(got, time.Now().Format(time.DateOnly)) {
+		t.Errorf("timeFlagHints = %v, want relative and absolute templates", got)
+	}
+
+	got, _ = c.timeFlagHints([]string{"logs", "--until"}, "1")
+	assertSameElements(t, got, []string{"15m", "1h"})
+}
+
+func TestTimeFlagHints_EqualsForm(t *testing.T) {
+	c := makeTimeFlagCompleter()
+	got, ok := c.timeFlagHints([]string{"logs"}, "--since=3")
+	if !ok {
+		t.Fatal("timeFlagHints ok = false for --since=")
+	}
+	assertSameElements(t, got, []string{"--since=30m"})
+}
+
+func TestTimeFlagHints_OtherFlags(t *testing.T) {
+	c := makeTimeFlagCompleter()
+	for _, tt := range []struct {
+		args       []string
+		toComplete string
+	}{
+		{[]string{"logs", "--tail"}, ""},
+		{[]string{"logs"}, "--tail=1"},
+		{[]string{"logs", "--since"}, "--"},
+		{[]string{"logs"}, ""},
+	} {
+		if got, ok := c.timeFlagHints(tt.args, tt.toComplete); ok {
+			t.Errorf("timeFlagHints(%v, %q) = %v, true; want not handled", tt.args, tt.toComplete, got)
+		}
+	}
+}
+
+func TestIntegration_CompleterDo_TimeFlag(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	sh := newIntegrationShell()
+	sh.cfg.TimeFlagNames = []string{"since"}
+	c := &completer{shell: sh}
+
+	line := []rune("greet --since 6")
+	got, length := c.Do(line, len(line))
+	if length != 1 || len(got) != 1 || string(got[0]) != "h" {
+		t.Errorf("Do(%q) = %q, %d; want [h], 1", string(line), got, length)
+	}
+}
@@ -0,0 +1,70 @@
+package cobrashell
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// ValidationError is an error a BeforeExec hook can return to reject a
+// command for one or more reasons. The shell prints it as a block with one
+// bulleted line per reason rather than as a single line:
+//
+//	BeforeExec: func(args []string) error {
+//	    var reasons []string
+//	    if !hasFlag(args, "--namespace") {
+//	        reasons = append(reasons, "--namespace is required")
+//	    }
+//	    if len(reasons) > 0 {
+//	        return &cobrashell.ValidationError{Reasons: reasons}
+//	    }
+//	    return nil
+//	},
+type ValidationError struct {
+	// Message heads the block. Defaults to "command rejected".
+	Message string
+
+	// Reasons are the individual problems, one per line.
+	Reasons []string
+}
+
+// Error returns the message and reasons on a single line, for callers that
+// print the error themselves.
+func (e *ValidationError) Error() string {
+	if len(e.Reasons) == 0 {
+		return e.message()
+	}
+	return e.message() + ": " + strings.Join(e.Reasons, "; ")
+}
+
+func (e *ValidationError) message() string {
+	if e.Message == "" {
+		return "command rejected"
+	}
+	return e.Message
+}
+
+// render formats e as printed by the shell: the message followed by one
+// "  • reason" line per reason.
+func (e *ValidationError) render() string {
+	var b strings.Builder
+	b.WriteString(e.message())
+	b.WriteString(":\n")
+	for _, r := range e.Reasons {
+		b.WriteString("  • ")
+		b.WriteString(r)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// reportHookError prints an error returned by a BeforeExec hook: a
+// [ValidationError] as a bulleted block, any other error on one line, to w.
+func reportHookError(w io.Writer, err error) {
+	var ve *ValidationError
+	if errors.As(err, &ve) && len(ve.Reasons) > 0 {
+		writeErrTo(w, "%s", ve.render())
+		return
+	}
+	writeErrTo(w, "%v\n", err)
+}
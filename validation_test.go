@@ -0,0 +1,67 @@
+package cobrashell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReportHookError_ValidationError(t *testing.T) {
+	err := &ValidationError{Reasons: []string{"--namespace is required", "--port must be positive"}}
+	out := captureStderr(t, func() { reportHookError(os.Stderr, err) })
+	want := "command rejected:\n  • --namespace is required\n  • --port must be positive\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+
+	// Wrapped, and with a custom message.
+	err = &ValidationError{Message: "deploy blocked", Reasons: []string{"frozen"}}
+	out = captureStderr(t, func() { reportHookError(os.Stderr, fmt.Errorf("policy: %w", err)) })
+	if out != "deploy blocked:\n  • frozen\n" {
+		t.Errorf("wrapped output = %q", out)
+	}
+}
+
+func TestReportHookError_PlainError(t *testing.T) {
+	out := captureStderr(t, func() { reportHookError(os.Stderr, errors.New("not logged in")) })
+	if out != "not logged in\n" {
+		t.Errorf("output = %q, want the error printed once", out)
+	}
+}
+
+func TestValidationError_Error(t *testing.T) {
+	err := &ValidationError{Reasons: []string{"a", "b"}}
+	if got := err.Error(); got != "command rejected: a; b" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestBeforeExec_ValidationErrorRendered(t *testing.T) {
+	sh := NewEmbedded(EmbeddedConfig{RootCmd: newTestRoot(), Hooks: EmbeddedHooks{
+		BeforeExec: func([]string) error {
+			return &ValidationError{Reasons: []string{"first", "second"}}
+		},
+	}})
+	out := captureStderr(t, func() { sh.execute("serve") })
+	if !strings.Contains(out, "  • first\n  • second\n") {
+		t.Errorf("stderr = %q, want one line per reason", out)
+	}
+}
+
+func TestIntegration_BeforeExec_ValidationErrorRendered(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	for _, line := range []string{"greet", "greet &", "greet | cat"} {
+		sh := newIntegrationShell()
+		sh.cfg.Hooks.BeforeExec = func([]string) error {
+			return &ValidationError{Reasons: []string{"first", "second"}}
+		}
+		out := captureStderr(t, func() { sh.execute(line) })
+		if !strings.Contains(out, "  • first\n  • second\n") {
+			t.Errorf("%q: stderr = %q, want one line per reason", line, out)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package cobrashell
+
+import "fmt"
+
+// Version is the version of cobra-shell reported by the VersionBuiltin. It is
+// "dev" unless set at build time with
+//
+//	go build -ldflags "-X github.com/pable/cobra-shell.Version=v1.2.3"
+var Version = "dev"
+
+// handleVersionBuiltin checks whether tokens[0] matches Config.VersionBuiltin.
+// If so, it prints the versions of cobra-shell and of the wrapped binary, as
+// reported by the first line of "binary --version", and returns true.
+func (s *Shell) handleVersionBuiltin(tokens []string) bool {
+	if s.cfg.VersionBuiltin == "" || tokens[0] != s.cfg.VersionBuiltin {
+		return false
+	}
+	binary := s.binaryVersionLine()
+	if binary == "" {
+		binary = "unknown (no output from --version)"
+	}
+	fmt.Fprintf(s.stdout(), "cobra-shell: %s\n", Version)
+	fmt.Fprintf(s.stdout(), "%s: %s\n", binaryName(s.binary), binary)
+	s.lastExitCode = 0
+	return true
+}
@@ -0,0 +1,46 @@
+package cobrashell
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleVersionBuiltin(t *testing.T) {
+	if testBinary == "" {
+		t.Skip("testbin not compiled")
+	}
+	orig := Version
+	Version = "v9.9.9-test"
+	defer func() { Version = orig }()
+
+	sh := newIntegrationShell()
+	if sh.handleVersionBuiltin([]string{"version"}) {
+		t.Error("handled with VersionBuiltin unset")
+	}
+
+	sh.cfg.VersionBuiltin = "version"
+	var handled bool
+	out := captureStdout(t, func() { handled = sh.handleVersionBuiltin([]string{"version"}) })
+	if !handled {
+		t.Fatal("version built-in not handled")
+	}
+	if !strings.Contains(out, "cobra-shell: v9.9.9-test\n") {
+		t.Errorf("output = %q, want the cobra-shell version", out)
+	}
+	if !strings.Contains(out, "testbin: testbin version 1.2.3\n") {
+		t.Errorf("output = %q, want the binary's --version line", out)
+	}
+}
+
+func TestHandleVersionBuiltin_NoBinaryVersion(t *testing.T) {
+	script, _ := writeLoggingBinary(t, "")
+	sh := &Shell{
+		cfg:        Config{VersionBuiltin: "version", CompletionTimeout: defaultCompletionTimeout},
+		binary:     script,
+		sessionEnv: make(map[string]string),
+	}
+	out := captureStdout(t, func() { sh.handleVersionBuiltin([]string{"version"}) })
+	if !strings.Contains(out, "fakebin: unknown") {
+		t.Errorf("output = %q, want the binary version reported as unknown", out)
+	}
+}